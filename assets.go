@@ -0,0 +1,88 @@
+// Package booking holds files the application needs at runtime, built into the binary,
+// so deployment is a single file (templates, static assets, migrations, translations)
+package booking
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Files starting with "." or "_" are not embedded (.DS_Store, scss partials)
+//
+//go:embed templates static migrations email-templates sms-templates locales
+var embedded embed.FS
+
+// Assets are directories the application reads at runtime
+type Assets struct {
+	Templates      fs.FS // pages and layouts (templates)
+	EmailTemplates fs.FS // email-templates
+	SMSTemplates   fs.FS // sms-templates
+	Static         fs.FS // css, js and images served under /static
+	Migrations     fs.FS // fizz migrations for soda (see "web migrations DIR")
+	Locales        fs.FS // message catalogs (see package i18n)
+}
+
+// Embedded returns assets built into the binary
+func Embedded() Assets {
+	a, err := load(embedded)
+	if err != nil {
+		//All directories are embedded above, so this can't happen
+		panic(err)
+	}
+
+	return a
+}
+
+// Load returns assets built into the binary, or the ones in dir when it is not empty
+// (development: edited templates and css are seen without rebuilding, see server.assets_dir)
+func Load(dir string) (Assets, error) {
+	if dir == "" {
+		return Embedded(), nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return Assets{}, fmt.Errorf("assets: %w", err)
+	}
+
+	if !info.IsDir() {
+		return Assets{}, fmt.Errorf("assets: %s is not a directory", dir)
+	}
+
+	return load(os.DirFS(dir))
+}
+
+// load takes every directory of Assets from root, all of them must exist
+func load(root fs.FS) (Assets, error) {
+	var a Assets
+
+	dirs := []struct {
+		name string
+		fsys *fs.FS
+	}{
+		{"templates", &a.Templates},
+		{"email-templates", &a.EmailTemplates},
+		{"sms-templates", &a.SMSTemplates},
+		{"static", &a.Static},
+		{"migrations", &a.Migrations},
+		{"locales", &a.Locales},
+	}
+
+	for _, d := range dirs {
+		_, err := fs.Stat(root, d.name)
+		if err != nil {
+			return Assets{}, fmt.Errorf("assets: %w", err)
+		}
+
+		sub, err := fs.Sub(root, d.name)
+		if err != nil {
+			return Assets{}, err
+		}
+
+		*d.fsys = sub
+	}
+
+	return a, nil
+}
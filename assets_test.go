@@ -0,0 +1,50 @@
+package booking
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+
+	//Built into binary
+	a, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := fs.Glob(a.Templates, "*.page.html")
+	if err != nil || len(pages) == 0 {
+		t.Errorf("no pages in binary: %v", err)
+	}
+
+	//From disk, the checkout has the same directories
+	a, err = Load(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fs.Stat(a.Static, "css/styles.css")
+	if err != nil {
+		t.Error(err)
+	}
+
+	//Directory without templates is refused at start, not on the first request
+	_, err = Load(t.TempDir())
+	if err == nil {
+		t.Error("expected error for directory without assets")
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	err = os.WriteFile(file, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Load(file)
+	if err == nil {
+		t.Error("expected error for file")
+	}
+}
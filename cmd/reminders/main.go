@@ -0,0 +1,146 @@
+// Command reminders queues arrival reminders and follow-ups once and exits.
+// The web application does the same every day, this is for testing and for running from cron.
+//
+// Usage (application flags go after --):
+//
+//	go run ./cmd/reminders -date 2026-10-20 -- -config config.yml
+//
+// Emails are put to mail outbox, mail workers of the web application send them.
+// Text messages (when SMS is switched on) are sent by this command before it exits.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/victorluk72/booking"
+	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/driver"
+	"github.com/victorluk72/booking/internal/emails"
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/logging"
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
+	"github.com/victorluk72/booking/internal/reminders"
+	"github.com/victorluk72/booking/internal/repository/dbrepo"
+	"github.com/victorluk72/booking/internal/sms"
+	"github.com/victorluk72/booking/internal/tracing"
+)
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("reminders", flag.ContinueOnError)
+	date := fs.String("date", "", "Pretend that today is this day (YYYY-MM-DD) for every property, default is today of each property")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	//Same configuration as web application (file, environment, flags)
+	var app config.AppConfig
+
+	_, err = config.Load(&app, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	clock, err := property.NewClock(app.Property)
+	if err != nil {
+		return err
+	}
+
+	app.Clock = clock
+
+	//Zero day means today of each property (see reminders.Scheduler.Run)
+	var day time.Time
+	if *date != "" {
+		day, err = property.ParseDate(*date)
+		if err != nil {
+			return fmt.Errorf("-date: %w", err)
+		}
+	}
+
+	app.UseCache = true
+	app.Logger = logging.New(os.Stdout, logging.ResolveFormat(app.Log.Format, app.InProduction), logging.ParseLevel(app.Log.Level))
+	app.InfoLog = slog.NewLogLogger(app.Logger.Handler(), slog.LevelInfo)
+	app.ErrorLog = slog.NewLogLogger(app.Logger.Handler(), slog.LevelError)
+	slog.SetDefault(app.Logger)
+
+	//Run is one trace, spans are exported before exit
+	stopTracing, err := tracing.Setup(context.Background(), app.Tracing, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer stopTracing(context.Background())
+
+	//Email and SMS templates are built into binary (or read from server.assets_dir)
+	app.Assets, err = booking.Load(app.Server.AssetsDir)
+	if err != nil {
+		return err
+	}
+
+	//Reminders are in language guest booked in
+	err = i18n.Load(app.Assets.Locales)
+	if err != nil {
+		return err
+	}
+
+	err = emails.NewEmails(&app)
+	if err != nil {
+		return err
+	}
+
+	db, err := driver.ConnectSQL(app.DB.DSN())
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	//Text messages are collected here and sent after the run
+	sender, err := sms.New(app.SMS, app.InfoLog)
+	if err != nil {
+		return err
+	}
+
+	var notifier *sms.Notifier
+	smsChan := make(chan models.SMSData, 10000)
+
+	if sender != nil {
+		t, err := sms.NewTemplates(app.Assets.SMSTemplates)
+		if err != nil {
+			return err
+		}
+		notifier = sms.NewNotifier(t, smsChan)
+	}
+
+	scheduler := reminders.New(app.Reminders, app.Clock, dbrepo.NewPostgresRepo(db.SQL, &app), emails.Message, notifier.Reservation, app.InfoLog, app.ErrorLog)
+
+	n, err := scheduler.Run(context.Background(), day)
+	close(smsChan)
+
+	for msg := range smsChan {
+		smsErr := sender.Send(msg)
+		if smsErr != nil {
+			app.Logger.Error("can't send sms", "to", msg.To, "error", smsErr)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	app.Logger.Info("reminders queued", "date", day.Format("2006-01-02"), "count", n)
+	return nil
+}
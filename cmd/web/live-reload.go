@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/livereload"
+	"github.com/victorluk72/booking/internal/render"
+)
+
+// startLiveReload watches templates, translations and static files when they are read from disk and not cached
+// (-cache=false -assets-dir .): changed templates are parsed again and open pages reload themselves
+func startLiveReload() error {
+	if app.UseCache {
+		return nil
+	}
+
+	if app.Server.AssetsDir == "" {
+		app.Logger.Info("templates are built into binary, set -assets-dir to reload them when they change")
+		return nil
+	}
+
+	reloader, err := livereload.New(app.Logger)
+	if err != nil {
+		return err
+	}
+
+	err = reloader.Watch(filepath.Join(app.Server.AssetsDir, "templates"), func() {
+		err := render.Reload()
+		if err != nil {
+			app.Logger.Error("templates don't parse", "error", err)
+		}
+	})
+	if err != nil {
+		reloader.Close()
+		return err
+	}
+
+	err = reloader.Watch(filepath.Join(app.Server.AssetsDir, "locales"), func() {
+		err := i18n.Load(app.Assets.Locales)
+		if err != nil {
+			app.Logger.Error("translations don't load", "error", err)
+		}
+	})
+	if err != nil {
+		reloader.Close()
+		return err
+	}
+
+	err = reloader.Watch(filepath.Join(app.Server.AssetsDir, "static"), nil)
+	if err != nil {
+		reloader.Close()
+		return err
+	}
+
+	app.Logger.Info("live reload is on", "dir", app.Server.AssetsDir)
+	app.LiveReload = reloader
+
+	return nil
+}
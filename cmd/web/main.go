@@ -1,25 +1,40 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/victorluk72/booking"
 	"github.com/victorluk72/booking/internal/config"
 	"github.com/victorluk72/booking/internal/driver"
+	"github.com/victorluk72/booking/internal/emails"
 	"github.com/victorluk72/booking/internal/handlers"
+	"github.com/victorluk72/booking/internal/health"
 	"github.com/victorluk72/booking/internal/helpers"
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/logging"
+	"github.com/victorluk72/booking/internal/metrics"
 	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
+	"github.com/victorluk72/booking/internal/reminders"
 	"github.com/victorluk72/booking/internal/render"
+	"github.com/victorluk72/booking/internal/repository/dbrepo"
+	"github.com/victorluk72/booking/internal/sessionstore"
+	"github.com/victorluk72/booking/internal/sso"
+	"github.com/victorluk72/booking/internal/tracing"
 )
 
-const portNumber = ":8080"
-
 //Varuiable that controls the session (from package scs)
 var session *scs.SessionManager
 
@@ -27,6 +42,9 @@ var session *scs.SessionManager
 var infoLog *log.Logger
 var errorLog *log.Logger
 
+// stopTracing exports spans that are not sent yet (see package tracing)
+var stopTracing = func(context.Context) error { return nil }
+
 // Get all configuration values (from package "config")
 // Now this variable availabe for whole "main" package
 var app config.AppConfig
@@ -35,37 +53,160 @@ func main() {
 
 	//Entry point of application
 
+	//"web migrations DIR" writes migrations built into binary to DIR for soda and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrations" {
+		err := writeMigrations(booking.Embedded().Migrations, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	//return db connection and erro from function run()
-	db, err := run()
+	db, err := run(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		//Usage was requested with -h, it is already printed
+		os.Exit(0)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	//CLose connection to DB (any type)
+	//Stop on Ctrl+C (SIGINT) or SIGTERM (e.g. from docker or systemd)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = serve(ctx, db)
+	if err != nil {
+		app.Logger.Error("application failed", "error", err)
+		os.Exit(1)
+	}
+
+	app.Logger.Info("application stopped")
+}
+
+// serve starts background jobs and web server and runs until ctx is cancelled
+// Then everything is stopped in order, so nothing is lost:
+//  1. server stops accepting connections, requests in progress can finish (server.shutdown_timeout);
+//     after timeout connections are dropped and we still wait for handlers, they can send email and SMS;
+//     handlers that are still running after one more timeout are abandoned (and logged)
+//  2. reminders scheduler stops, nothing new is queued after that
+//  3. mail channel is drained to outbox, mail workers finish messages in progress
+//  4. SMS channel is drained, SMS workers send what is left
+//  5. session cleanup stops and database connection is closed
+//  6. spans that are not exported yet are sent to tracing
+func serve(ctx context.Context, db *driver.DB) error {
+
+	//Spans of the last requests and emails are exported after everything else stopped
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := stopTracing(flushCtx)
+		if err != nil {
+			app.Logger.Error("can't export spans", "error", err)
+		}
+	}()
+
+	//Close connection to DB (any type), it is the last thing to stop
 	defer db.SQL.Close()
 
-	//Close connection to my mailChan (chennal created for sending emails)
-	defer close(app.MailChan)
+	//Start mail workers (see send-mail.go)
+	app.Logger.Info("starting mail workers", "workers", app.Outbox.Workers, "transport", app.Mail.Transport)
+	mailPool, err := startMailWorkers(db)
+	if err != nil {
+		return err
+	}
 
-	//Start listenning my email messages (go routine from send email.go)
-	fmt.Println("...Starting email listener....")
-	listenForMail()
+	//Start text messages queue (see send-sms.go)
+	smsQueue, err := startSMSQueue()
+	if err != nil {
+		close(app.MailChan)
+		mailPool.Stop()
+		return err
+	}
+	if smsQueue != nil {
+		app.Logger.Info("starting SMS workers", "workers", app.SMS.Workers, "provider", app.SMS.Provider)
+	}
 
-	fmt.Println("...Starting applicaton on port", portNumber, "...")
+	//Start daily arrival reminders and follow-ups (see package reminders)
+	app.Logger.Info("starting reminders scheduler", "run_at", app.Reminders.RunAt, "time_zone", app.Property.TimeZone)
+	scheduler := reminders.New(app.Reminders, app.Clock, dbrepo.NewPostgresRepo(db.SQL, &app), emails.Message, app.SMSNotifier.Reservation, infoLog, errorLog)
+	scheduler.Start()
 
 	// Define my http Server
+	// Timeouts protect us from slow (or malicious) clients keeping connections forever
 	srv := &http.Server{
-		Addr:    portNumber,
-		Handler: routes(&app),
+		Addr:         app.Server.Addr,
+		Handler:      routes(&app),
+		ReadTimeout:  app.Server.ReadTimeout,
+		WriteTimeout: app.Server.WriteTimeout,
+		IdleTimeout:  app.Server.IdleTimeout,
+		ErrorLog:     errorLog,
+	}
+
+	//Live reload streams never end by themselves, they must not hold shutdown
+	if app.LiveReload != nil {
+		srv.RegisterOnShutdown(func() { app.LiveReload.Close() })
+	}
+
+	app.Logger.Info("starting application", "addr", app.Server.Addr, "production", app.InProduction)
+
+	//Run web server that would listen and serve (in background, we wait for the signal here)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		//Server couldn't start (e.g. port is busy), stop the rest anyway
+	case <-ctx.Done():
+		app.Logger.Info("shutting down, waiting for requests in progress", "timeout", app.Server.ShutdownTimeout)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), app.Server.ShutdownTimeout)
+		defer cancel()
+
+		err = srv.Shutdown(shutdownCtx)
+		if err != nil {
+			//Requests didn't finish in time, drop their connections
+			app.Logger.Error("server shutdown", "error", err)
+			err = srv.Close()
+
+			app.Logger.Info("waiting for handlers that are still running")
+		}
+	}
+
+	//Handlers send to mail and SMS channels, these must not be closed while any of them runs
+	//Handler that hangs must not hold shutdown forever, so we wait one more shutdown timeout at most
+	abandoned := waitInFlight(app.Server.ShutdownTimeout)
+	if abandoned > 0 {
+		app.Logger.Error("handlers didn't finish in time, abandoning them", "handlers", abandoned, "timeout", app.Server.ShutdownTimeout)
+	}
+
+	scheduler.Stop()
+
+	//Nobody sends email anymore, what is left in the channel goes to outbox
+	close(app.MailChan)
+	mailPool.Stop()
+
+	if smsQueue != nil {
+		close(app.SMSChan)
+		smsQueue.Stop()
+	}
+
+	if store, ok := session.Store.(*sessionstore.PostgresStore); ok {
+		store.StopCleanup()
 	}
 
-	//Run web server that would listen and serve
-	err = srv.ListenAndServe()
-	log.Fatal(err)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
 
+	return err
 }
 
-func run() (*driver.DB, error) {
+func run(args []string) (*driver.DB, error) {
 	// What I'm going to put into my session? - I'm passing Reservation, User, Room models
 	// You need this to pass the content of the reservation form to page reservation-summary
 	// See handlers.go m.App.Session.Put(r.Context(), "reservation-details", reservation)
@@ -76,24 +217,57 @@ func run() (*driver.DB, error) {
 	gob.Register(models.Restriction{})
 	gob.Register(map[string]int{})
 
-	// Read flags from CLI (replace hardcoded values)
-	//First flag for "production - true or false"
-	InProduction := flag.Bool("production", true, "Application is in Production")
-	useCache := flag.Bool("cache", true, "Use cache for templates")
-	dbHost := flag.String("dbhost", "localhost", "Database host")
-	dbName := flag.String("dbname", "", "Database name")
-	dbUser := flag.String("dbuser", "", "Database user")
-	dbPass := flag.String("dbpass", "", "Database password")
-	dbPort := flag.Int("dbport", 5432, "Database port")
-	dbSSL := flag.String("dbssl", "disable", "Database SSL (disable, prefer, require")
-
-	flag.Parse()
-
-	//Check if all mandatory parameters are provided
-	if *dbName == "" || *dbUser == "" || *dbPass == "" {
-		fmt.Println("Missing mandatory flags")
-		os.Exit(1)
+	// Read configuration from config file, environment and flags (see package config)
+	// Flags win over environment, environment wins over config file
+	settings, err := config.Load(&app, args)
+	if err != nil {
+		return nil, err
+	}
+
+	//Days of stays, the calendar and reminders are in time zone of the property, not of the server
+	app.Clock, err = property.NewClock(app.Property)
+	if err != nil {
+		return nil, err
+	}
+
+	//Structured logger: text is easier to read in development, JSON is easier to search in production
+	format := logging.ResolveFormat(app.Log.Format, app.InProduction)
+	app.Logger = logging.New(os.Stdout, format, logging.ParseLevel(app.Log.Level))
 
+	//Standard log package (and everybody who uses it) writes through our logger too
+	slog.SetDefault(app.Logger)
+
+	//INFO and ERROR loggers for packages that take *log.Logger, lines go to the same structured log
+	infoLog = slog.NewLogLogger(app.Logger.Handler(), slog.LevelInfo)
+	app.InfoLog = infoLog
+
+	errorLog = slog.NewLogLogger(app.Logger.Handler(), slog.LevelError)
+	app.ErrorLog = errorLog
+
+	//Tracing of requests, queries and emails (spans go to stdout or OpenTelemetry collector)
+	stopTracing, err = tracing.Setup(context.Background(), app.Tracing, os.Stdout)
+	if err != nil {
+		return nil, fmt.Errorf("can't set up tracing: %w", err)
+	}
+
+	//Show what we are running with (passwords are hidden)
+	app.Logger.Info("configuration", config.Attrs(settings)...)
+
+	//Templates, static files and migrations are built into binary
+	//In development server.assets_dir reads them from disk, so changes are seen without rebuilding
+	app.Assets, err = booking.Load(app.Server.AssetsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.Server.AssetsDir != "" {
+		app.Logger.Info("reading assets from disk", "dir", app.Server.AssetsDir)
+	}
+
+	//Translations of pages, emails and text messages
+	err = i18n.Load(app.Assets.Locales)
+	if err != nil {
+		return nil, err
 	}
 
 	//Create new channel for my mail chaneel
@@ -102,66 +276,87 @@ func run() (*driver.DB, error) {
 	//Make it avaialble for other parts of package
 	app.MailChan = mailChan
 
-	//Change these to "true" when in Production
-	app.InProduction = *InProduction
-	// Don't use template cache (for example during dev process)
-	// false for Dev, true for Prod
-	app.UseCache = *useCache
+	//----Single sign-on-----------------------
+	if app.OIDC.IssuerURL != "" {
+		app.Logger.Info("discovering single sign-on provider", "issuer", app.OIDC.IssuerURL)
 
-	//Define new INFO and ERROR logger and make it avaialble for whole application (vial app.Infolog)
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
+		provider, err := sso.New(context.Background(), app.OIDC)
+		if err != nil {
+			return nil, err
+		}
 
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+		app.SSO = provider
+	}
+
+	//Initialize my database connection
+	app.Logger.Info("connecting to database", "host", app.DB.Host, "name", app.DB.Name)
+
+	db, err := driver.ConnectSQL(app.DB.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+
+	//Connection pool stats for /metrics
+	metrics.RegisterDB(db.SQL)
 
 	//----Session managment-----------------------
 	session = scs.New()
-	session.Lifetime = 24 * time.Hour              //make session valid for 24 hours
+	session.Lifetime = app.Sessions.Lifetime       //how long session is valid (24 hours by default)
 	session.Cookie.Persist = true                  //Pesist session data in the cookies
 	session.Cookie.SameSite = http.SameSiteLaxMode //WTF?
 	session.Cookie.Secure = app.InProduction       //This is haandling https. Set true for Prod
 
+	//Keep sessions in database, so restart doesn't log everybody out
+	//and several instances of application can share them
+	//(scs uses in-memory store by default)
+	if app.Sessions.Store == "postgres" {
+		session.Store = sessionstore.New(db.SQL, app.Sessions.CleanupInterval, errorLog)
+	}
+
 	// Now asign whatever you have for session in main to app.Config variable
 	// This will make it accessable from all part of application
 	app.Session = session
 
-	//Initialize my database connection
-	log.Println("Connecting to database...")
-
-	dsn := fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
-
-	db, err := driver.ConnectSQL(dsn)
-	if err != nil {
-		log.Fatal("Cannot connect to database. Shuttiong down...")
-	}
-
 	//----Session managment Ends------------------
 
 	//----Tempalte cache managment-------------------
 	//Call my template cache (tc) from package render
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
-		log.Fatal("Can't create template cache", err)
-		return nil, err
+		return nil, fmt.Errorf("can't create template cache: %w", err)
 	}
 
 	// Assign my tempalte cache to configuration variable app.TemplateCache
 	// This allows get cache once and do not reach it every time we browse
 	app.TemplateCache = tc
 
-	//--TEMP:Print list of all pages from tempalte cache
-	fmt.Println("---This is my template cache:---")
-	for pg := range tc {
-		fmt.Println(pg)
-	}
-	fmt.Println("---End my template cache:---")
+	//Readiness checks for load balancer (see /readyz), mail workers add their own check
+	app.Health = health.New()
+	app.Health.Add("database", db.Ping)
+	app.Health.Add("templates", func(ctx context.Context) error {
+		if len(app.TemplateCache) == 0 {
+			return errors.New("template cache is empty")
+		}
+		return nil
+	})
 
-	//--TEMP ENDS:Print list of all pages from tempalte cache
+	app.Logger.Debug("template cache is ready", "pages", len(tc))
 
 	//This give render package access to our app variable
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
+
+	//Development: templates are parsed again and pages reload when files in assets dir are saved
+	err = startLiveReload()
+	if err != nil {
+		return nil, err
+	}
+
+	//Email templates are cached the same way as pages
+	err = emails.NewEmails(&app)
+	if err != nil {
+		return nil, err
+	}
 	//----Tempalte cache managment Ends----------------
 
 	// This is to create repository variable
@@ -1,13 +1,116 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/driver"
+	"github.com/victorluk72/booking/internal/health"
+	"github.com/victorluk72/booking/internal/logging"
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
+)
 
 func TestRun(t *testing.T) {
 
-	_, err := run()
+	//run() connects to real database, configure it with BOOKING_DB_* variables to run this test
+	if os.Getenv("BOOKING_DB_NAME") == "" {
+		t.Skip("BOOKING_DB_NAME is not set, skipping test that needs database")
+	}
+
+	_, err := run([]string{})
+	if err != nil {
+
+		t.Error("failed run(", err)
+	}
+
+}
+
+func TestRunMissingConfig(t *testing.T) {
+
+	//No database settings at all - run() must stop with clear message (and not exit)
+	t.Setenv("BOOKING_DB_NAME", "")
+	t.Setenv("BOOKING_DB_USER", "")
+	t.Setenv("BOOKING_DB_PASSWORD", "")
+
+	_, err := run([]string{})
+	if err == nil {
+		t.Fatal("expected error for missing database settings")
+	}
+
+	if !strings.Contains(err.Error(), "db.name is required") {
+		t.Errorf("unexpected error message: %s", err)
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+
+	//Database that can't be reached: background jobs only log errors
+	conn, err := sql.Open("pgx", "host=127.0.0.1 port=1 dbname=none user=none connect_timeout=1")
 	if err != nil {
+		t.Fatal(err)
+	}
 
-		t.Error("failed run(")
+	_, err = config.Load(&app, []string{"-dbname=booking", "-dbuser=booking", "-dbpass=secret",
+		"-addr=127.0.0.1:0", "-mail-transport=log", "-production=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.Clock, err = property.NewClock(app.Property)
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	app.Logger = logging.New(io.Discard, "text", slog.LevelInfo)
+	infoLog = log.New(io.Discard, "", 0)
+	errorLog = log.New(io.Discard, "", 0)
+	app.MailChan = make(chan models.MailData)
+	session = scs.New()
+	app.Session = session
+	app.Health = health.New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, &driver.DB{SQL: conn})
+	}()
+
+	//Mail workers take messages from the channel while server is running
+	app.MailChan <- models.MailData{To: "me@here.ca"}
+
+	//This is what SIGINT or SIGTERM does
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve didn't stop")
+	}
+
+	if _, ok := <-app.MailChan; ok {
+		t.Error("mail channel is not closed")
+	}
+
+	//Readiness shows that mail workers are stopped
+	if ok, _ := app.Health.Run(context.Background()); ok {
+		t.Error("expected failed readiness after shutdown")
+	}
+
+	if err := conn.Ping(); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("database is not closed: %v", err)
+	}
 }
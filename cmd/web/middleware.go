@@ -1,24 +1,113 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
 	"github.com/victorluk72/booking/internal/helpers"
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/logging"
+	"github.com/victorluk72/booking/internal/tracing"
 )
 
-// WriteToConcole is a "middleware" type of function that
-// will write something to console when page is hit
-func WriteToConcole(next http.Handler) http.Handler {
+// inFlight counts handlers that are running (see TrackRequests)
+// WaitGroup doesn't fit here: shutdown may stop waiting while handlers still run
+var inFlight atomic.Int64
 
-	//Return anonimouse function, cast it to type "http.HandlerFunc"
+// TrackRequests counts running handlers, so shutdown can wait for them before mail and SMS channels are closed
+// srv.Close drops connections but doesn't stop handlers, they can still send email after that
+func TrackRequests(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("Hit the page")
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// waitInFlight waits for running handlers, but not longer than timeout
+// It returns how many handlers were still running when we stopped waiting
+func waitInFlight(timeout time.Duration) int64 {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		n := inFlight.Load()
+		if n == 0 || time.Now().After(deadline) {
+			return n
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// RequestID gives every request an ID (or takes it from X-Request-Id of the proxy)
+// It is sent back in X-Request-Id header and written to every log line of the request
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := logging.NewRequestID(r.Header.Get("X-Request-Id"))
+
+		w.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// RequestLog puts request logger (request ID, trace ID and user ID) to the context and writes access log line
+// It must go after SessionLoad, user ID comes from the session
+func RequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		l := app.Logger.With("request_id", logging.RequestID(r.Context()))
+		if traceID := tracing.TraceID(r.Context()); traceID != "" {
+			l = l.With("trace_id", traceID)
+		}
+		if userID := session.GetInt(r.Context(), "user_id"); userID != 0 {
+			l = l.With("user_id", userID)
+		}
+
+		r = r.WithContext(logging.WithLogger(r.Context(), l))
+		//Session buffers the response, so the plain writer is enough here
+		//(chi's "fancy" writer calls ReadFrom of the session writer, which it doesn't have, e.g. for static files)
+		ww := middleware.NewWrapResponseWriter(struct{ http.ResponseWriter }{w}, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		//Route is known only after the request is routed
+		logging.FromRequest(r).Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// Locale chooses language of the page: the one guest picked in language menu (session),
+// otherwise the best one from Accept-Language header of the browser
+// It must go after SessionLoad
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := session.GetString(r.Context(), "locale")
+		if !i18n.Supported(locale) {
+			locale = i18n.Match(r.Header.Get("Accept-Language"))
+		}
+
+		w.Header().Set("Content-Language", locale)
+		w.Header().Add("Vary", "Accept-Language")
+
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
+
 // NoSurf generates CSRF protection to all POST request
 // It is custom built piece of middleware
 func NoSurf(next http.Handler) http.Handler {
@@ -1,9 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/victorluk72/booking/internal/logging"
 )
 
 // test for NoSurf function
@@ -41,3 +50,116 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not http.Handler, but %T", v))
 	}
 }
+
+func TestRequestLog(t *testing.T) {
+
+	//Log to buffer in JSON to check fields of the access log line
+	var buf bytes.Buffer
+	oldLogger, oldSession := app.Logger, session
+	app.Logger = logging.New(&buf, "json", slog.LevelInfo)
+	session = scs.New()
+	defer func() {
+		app.Logger, session = oldLogger, oldSession
+	}()
+
+	mux := chi.NewRouter()
+	mux.Use(RequestID)
+	mux.Use(SessionLoad)
+	mux.Use(RequestLog)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/rooms/7", nil)
+	req.Header.Set("X-Request-Id", "from-proxy-1")
+	mux.ServeHTTP(rr, req)
+
+	if rr.Header().Get("X-Request-Id") != "from-proxy-1" {
+		t.Errorf("expected request ID in response, got %q", rr.Header().Get("X-Request-Id"))
+	}
+
+	var line map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &line)
+	if err != nil {
+		t.Fatalf("access log is not one JSON line: %s", buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"msg":        "request",
+		"request_id": "from-proxy-1",
+		"route":      "/rooms/{id}",
+		"path":       "/rooms/7",
+		"method":     "GET",
+		"status":     float64(http.StatusTeapot),
+	}
+
+	for k, v := range expected {
+		if line[k] != v {
+			t.Errorf("%s: expected %v but got %v", k, v, line[k])
+		}
+	}
+
+	if _, ok := line["duration"]; !ok {
+		t.Error("duration is missing in access log")
+	}
+}
+
+func TestTrackRequests(t *testing.T) {
+
+	//Handler keeps running until we let it go
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := TrackRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	<-started
+
+	waited := make(chan struct{})
+	go func() {
+		waitInFlight(time.Minute)
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatal("shutdown didn't wait for running handler")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown still waits after handler returned")
+	}
+}
+
+func TestWaitInFlight(t *testing.T) {
+
+	//Handler hangs until the end of the test
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := TrackRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	<-started
+
+	//Shutdown gives up after timeout and tells how many handlers are left
+	if n := waitInFlight(50 * time.Millisecond); n != 1 {
+		t.Errorf("expected 1 abandoned handler but got %d", n)
+	}
+
+	close(release)
+
+	if n := waitInFlight(time.Second); n != 0 {
+		t.Errorf("expected no abandoned handlers but got %d", n)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// writeMigrations copies migrations built into binary to directory from args, e.g. "web migrations ./migrations"
+// Then run them with soda as before: soda migrate -p ./migrations
+// Files that are already there are overwritten, other files are left alone
+func writeMigrations(migrations fs.FS, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: web migrations DIR")
+	}
+
+	dir := args[0]
+
+	return fs.WalkDir(migrations, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(path))
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		content, err := fs.ReadFile(migrations, path)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(target, content, 0644)
+	})
+}
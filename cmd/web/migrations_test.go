@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/victorluk72/booking"
+)
+
+func TestWriteMigrations(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+
+	err := writeMigrations(booking.Embedded().Migrations, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Every migration of the checkout is in the binary (fizz and sql)
+	want, err := filepath.Glob("../../migrations/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(want) == 0 || len(got) != len(want) {
+		t.Errorf("expected %d migrations, got %d", len(want), len(got))
+	}
+
+	for i := range got {
+		if i < len(want) && filepath.Base(got[i]) != filepath.Base(want[i]) {
+			t.Errorf("expected migration %s, got %s", filepath.Base(want[i]), filepath.Base(got[i]))
+		}
+	}
+
+	err = writeMigrations(booking.Embedded().Migrations, nil)
+	if err == nil {
+		t.Error("expected usage error without directory")
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/victorluk72/booking/internal/config"
 	"github.com/victorluk72/booking/internal/handlers"
+	"github.com/victorluk72/booking/internal/metrics"
+	"github.com/victorluk72/booking/internal/tracing"
 )
 
 // routes ... returns http Handler
@@ -14,63 +16,135 @@ func routes(app *config.AppConfig) http.Handler {
 
 	mux := chi.NewRouter()
 
-	//--------Middleware block--------------
-	//This is middleware to recover from panic
-	mux.Use(middleware.Recoverer)
+	//Shutdown waits for every running handler before channels are closed (see serve)
+	mux.Use(TrackRequests)
 
-	// This is custom middleware function (see package middleware.go)
-	// It means ignore any request if it does't have proper CSRFToken protection
-	// If you have form without CSRF protection it will return "Bad request"
-	mux.Use(NoSurf)
-
-	// This is middleware for session load
-	mux.Use(SessionLoad)
-	//--------Middleware block Ends------------
-
-	//------These are my routes---------------
-	mux.Get("/", handlers.Ripo.Home)
-	mux.Get("/about", handlers.Ripo.About)
-	mux.Get("/generals", handlers.Ripo.Generals)
-	mux.Get("/majors", handlers.Ripo.Majors)
-	mux.Get("/contact", handlers.Ripo.Contact)
-
-	mux.Get("/user/login", handlers.Ripo.Login)
-	mux.Post("/user/login", handlers.Ripo.PostLogin)
-	mux.Get("/user/logout", handlers.Ripo.Logout)
-
-	mux.Get("/search-availability", handlers.Ripo.Availability)
-	mux.Post("/search-availability", handlers.Ripo.PostAvailability)
-	mux.Post("/search-availability-json", handlers.Ripo.AvailabilityJSON)
-	mux.Get("/choose-room/{id}", handlers.Ripo.ChooseRoom)
-	mux.Get("/book-room", handlers.Ripo.BookRoom)
-
-	mux.Get("/make-reservation", handlers.Ripo.Reservation)
-	mux.Post("/make-reservation", handlers.Ripo.PostReservation)
-	mux.Get("/reservation-summary", handlers.Ripo.ReservationSummary)
-
-	//This is protected area - only for Auth users
-	// The "admin" wil lbe cerated automatically to the route
-	mux.Route("/admin", func(mux chi.Router) {
-		//mux.Use(Auth)
-
-		//This is my protected route
-		mux.Get("/dashboard", handlers.Ripo.AdminDashboard)
-		mux.Get("/reservations-new", handlers.Ripo.AdminNewReservations)
-		mux.Get("/reservations-all", handlers.Ripo.AdminAllReservations)
-		mux.Get("/reservations/{src}/{id}", handlers.Ripo.AdminShowReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Ripo.AdminPostShowReservation)
-		mux.Get("/process-reservation/{src}/{id}", handlers.Ripo.AdminProcessReservation)
-		mux.Get("/delete-reservation/{src}/{id}", handlers.Ripo.AdminDeleteReservation)
-
-		mux.Get("/reservation-calendar", handlers.Ripo.AdminCalendar)
+	//Every request gets ID for logs (see middleware.go)
+	mux.Use(RequestID)
 
-	})
+	//Count and time every request (outside of Recoverer, so panics are counted as 500)
+	mux.Use(metrics.Middleware)
 
-	//------End of my routes block---------------
+	//This is middleware to recover from panic
+	mux.Use(middleware.Recoverer)
 
-	//Create file server to manage our static files
-	fileServer := http.FileServer(http.Dir("../../static/"))
-	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+	//Health checks and metrics for load balancer and monitoring (no session and no CSRF check)
+	mux.Get("/healthz", app.Health.Live)
+	mux.Get("/readyz", app.Health.Ready)
+	mux.Get("/version", app.Health.Version)
+	mux.Handle("/metrics", metrics.Handler())
+
+	//Development: browser waits here for changes of templates and static files (no session, it buffers response)
+	if app.LiveReload != nil {
+		mux.Get("/dev/reload", app.LiveReload.ServeHTTP)
+	}
+
+	//Everything else is the site itself
+	mux.Group(func(mux chi.Router) {
+
+		//--------Middleware block--------------
+		// Every request is a trace (see package tracing), health checks are not traced to keep traces clean
+		mux.Use(tracing.Middleware)
+
+		// This is custom middleware function (see package middleware.go)
+		// It means ignore any request if it does't have proper CSRFToken protection
+		// If you have form without CSRF protection it will return "Bad request"
+		mux.Use(NoSurf)
+
+		// This is middleware for session load
+		mux.Use(SessionLoad)
+
+		// Language of the page, from language menu or browser (see package i18n)
+		mux.Use(Locale)
+
+		// This is access log, every line of the request has request ID and user ID
+		mux.Use(RequestLog)
+		//--------Middleware block Ends------------
+
+		//------These are my routes---------------
+		mux.Get("/", handlers.Ripo.Home)
+		mux.Get("/about", handlers.Ripo.About)
+		mux.Get("/generals", handlers.Ripo.Generals)
+		mux.Get("/majors", handlers.Ripo.Majors)
+		mux.Get("/contact", handlers.Ripo.Contact)
+		mux.Get("/language/{locale}", handlers.Ripo.Language)
+
+		mux.Get("/user/login", handlers.Ripo.Login)
+		mux.Post("/user/login", handlers.Ripo.PostLogin)
+		mux.Get("/user/logout", handlers.Ripo.Logout)
+		mux.Get("/user/login/sso", handlers.Ripo.SSOLogin)
+		mux.Get("/user/login/sso/callback", handlers.Ripo.SSOCallback)
+
+		mux.Get("/search-availability", handlers.Ripo.Availability)
+		mux.Post("/search-availability", handlers.Ripo.PostAvailability)
+		mux.Post("/search-availability-json", handlers.Ripo.AvailabilityJSON)
+		mux.Get("/choose-room/{id}", handlers.Ripo.ChooseRoom)
+		mux.Get("/book-room", handlers.Ripo.BookRoom)
+
+		mux.Get("/make-reservation", handlers.Ripo.Reservation)
+		mux.Post("/make-reservation", handlers.Ripo.PostReservation)
+		mux.Get("/reservation-summary", handlers.Ripo.ReservationSummary)
+
+		//This is protected area - only for Auth users
+		// The "admin" wil lbe cerated automatically to the route
+		mux.Route("/admin", func(mux chi.Router) {
+			mux.Use(Auth)
+
+			//Admin pages work with properties of the user, one of them chosen in property switcher
+			mux.Use(handlers.Ripo.PropertyScope)
+
+			//This is my protected route
+			mux.Get("/dashboard", handlers.Ripo.AdminDashboard)
+			mux.Get("/reservations-new", handlers.Ripo.AdminNewReservations)
+			mux.Get("/reservations-all", handlers.Ripo.AdminAllReservations)
+			mux.Get("/reservations/{src}/{id}", handlers.Ripo.AdminShowReservation)
+			mux.Post("/reservations/{src}/{id}", handlers.Ripo.AdminPostShowReservation)
+			mux.Post("/reservations/{src}/{id}/assign", handlers.Ripo.AdminPostAssignRoom)
+			mux.Get("/process-reservation/{src}/{id}", handlers.Ripo.AdminProcessReservation)
+			mux.Get("/delete-reservation/{src}/{id}", handlers.Ripo.AdminDeleteReservation)
+
+			mux.Get("/front-desk", handlers.Ripo.AdminFrontDesk)
+			mux.Post("/front-desk/check-in/{id}", handlers.Ripo.AdminPostCheckIn)
+			mux.Post("/front-desk/check-out/{id}", handlers.Ripo.AdminPostCheckOut)
+			mux.Get("/housekeeping", handlers.Ripo.AdminHousekeeping)
+			mux.Post("/housekeeping/{id}", handlers.Ripo.AdminPostHousekeeping)
+
+			mux.Get("/reservation-calendar", handlers.Ripo.AdminCalendar)
+			mux.Post("/reservation-calendar", handlers.Ripo.AdminPostCalendar)
+
+			mux.Get("/switch-property/{id}", handlers.Ripo.AdminSwitchProperty)
+			mux.Get("/property", handlers.Ripo.AdminProperty)
+			mux.Post("/property", handlers.Ripo.AdminPostProperty)
+			mux.Post("/property/staff", handlers.Ripo.AdminPostPropertyStaff)
+			mux.Get("/properties/new", handlers.Ripo.AdminNewProperty)
+			mux.Post("/properties/new", handlers.Ripo.AdminPostNewProperty)
+
+			mux.Get("/notifications", handlers.Ripo.AdminNotifications)
+			mux.Post("/notifications", handlers.Ripo.AdminPostNotifications)
+
+			mux.Get("/sessions", handlers.Ripo.AdminSessions)
+			mux.Post("/revoke-session/{id}", handlers.Ripo.AdminRevokeSession)
+
+			mux.Get("/mail", handlers.Ripo.AdminMail)
+			mux.Get("/mail/{id}", handlers.Ripo.AdminShowMail)
+			mux.Post("/resend-mail/{id}", handlers.Ripo.AdminResendMail)
+
+			//Emails caught in development (Not Found in production)
+			mux.Get("/dev/mail", handlers.Ripo.AdminDevMail)
+			mux.Get("/dev/mail/{id}", handlers.Ripo.AdminShowDevMail)
+			mux.Get("/dev/mail/{id}/html", handlers.Ripo.AdminDevMailHTML)
+			mux.Post("/dev/clear-mail", handlers.Ripo.AdminClearDevMail)
+
+		})
+
+		//Unknown pages get our 404 page (it goes through middleware above, so the menu and flash work)
+		mux.NotFound(handlers.Ripo.NotFound)
+		//------End of my routes block---------------
+
+		//Create file server to manage our static files (built into binary, see package booking)
+		fileServer := http.FileServer(http.FS(app.Assets.Static))
+		mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+	})
 
 	return mux
 
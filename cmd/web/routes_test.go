@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
+	"github.com/victorluk72/booking"
 	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/health"
+	"github.com/victorluk72/booking/internal/logging"
 )
 
 func TestRoutes(t *testing.T) {
@@ -25,3 +34,55 @@ func TestRoutes(t *testing.T) {
 	}
 
 }
+
+func TestHealthRoutes(t *testing.T) {
+
+	var app config.AppConfig
+	app.Health = health.New()
+	app.Health.Add("database", func(ctx context.Context) error { return nil })
+
+	mux := routes(&app)
+
+	for _, path := range []string{"/healthz", "/readyz", "/version", "/metrics"} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected %d but got %d", path, http.StatusOK, rr.Code)
+		}
+
+		//No CSRF or session cookie for health checks and metrics
+		if cookies := rr.Header().Values("Set-Cookie"); len(cookies) != 0 {
+			t.Errorf("%s: unexpected cookies %v", path, cookies)
+		}
+	}
+}
+
+func TestStaticRoute(t *testing.T) {
+
+	//Static files are served from the binary, whatever the working directory is
+	//Middleware logs with the app of package main, so use it here too
+	app.Assets = booking.Embedded()
+	app.Logger = logging.New(io.Discard, "text", slog.LevelInfo)
+
+	//Static files go through the same middleware as pages
+	session = scs.New()
+	app.Session = session
+
+	mux := routes(&app)
+
+	for _, e := range []struct {
+		path   string
+		status int
+	}{
+		{"/static/css/styles.css", http.StatusOK},
+		{"/static/admin/.DS_Store", http.StatusNotFound},
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", e.path, nil))
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected %d but got %d", e.path, e.status, rr.Code)
+		}
+	}
+}
@@ -1,60 +1,45 @@
 package main
 
 import (
-	"fmt"
-	"time"
+	"context"
+	"errors"
 
-	"github.com/victorluk72/booking/internal/models"
-	mail "github.com/xhit/go-simple-mail/v2"
+	"github.com/victorluk72/booking/internal/driver"
+	"github.com/victorluk72/booking/internal/mailer"
+	"github.com/victorluk72/booking/internal/outbox"
+	"github.com/victorluk72/booking/internal/repository/dbrepo"
 )
 
-func listenForMail() {
+// startMailWorkers starts the pool of workers that send emails from outbox table
+// Messages come to outbox from app.MailChan or together with reservation (see PostReservation)
+// How emails are delivered depends on mail.transport setting (see package mailer)
+func startMailWorkers(db *driver.DB) (*outbox.Pool, error) {
 
-	//Run an anynimouse function asyncronically (use go routine)
-	//Listen all the time for incoming data
-	go func() {
-
-		// use for loop with no conditions (make it runs infinetely)
-		//Create a messge that was sent from channel
-		msg := <-app.MailChan
-		sendMsg(msg) //sending email by using custom buit function sendMsg() see below
-
-	}()
-
-}
-
-// sendMsg sends email messages, use in async function above
-// Get all parameters for function from struct MAilData
-func sendMsg(m models.MailData) {
-
-	//Define mail SERVER parameters
-	server := mail.NewSMTPClient()
-	server.Host = "smtp.mailtrap.io"
-	server.Port = 2525
-	server.Username = ""
-	server.Password = ""
-	server.KeepAlive = false
-	server.ConnectTimeout = 10 + time.Second
-	server.SendTimeout = 10 + time.Second
-
-	//Define mail CLIENT parameters
-	client, err := server.Connect()
+	m, err := mailer.New(app.Mail, infoLog)
 	if err != nil {
-		errorLog.Println(err)
+		return nil, err
 	}
 
-	//construct our email MESSAGE
-	//create new empty message and then set main email parameters (from, to, subject)
-	email := mail.NewMSG()
-	email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
-	email.SetBody(mail.TextHTML, m.Content)
-
-	//Send email now!
-	err = email.Send(client)
-	if err != nil {
-		errorLog.Println(err)
-	} else {
-		fmt.Println("Email sent....")
+	//Not in production: nothing leaves the application, emails can be seen on /admin/dev/mail
+	if !app.InProduction {
+		app.MailCatcher = mailer.NewCatcher(200)
+		m = app.MailCatcher
+		infoLog.Println("Development mode: emails are caught, see /admin/dev/mail")
 	}
 
+	pool := outbox.New(app.Outbox, dbrepo.NewPostgresRepo(db.SQL, &app), m.Send, errorLog)
+
+	//Everything sent to the channel is stored in outbox first, so it survives restart
+	pool.Listen(app.MailChan)
+	pool.Start()
+
+	//Load balancer stops sending traffic if workers are not running (see /readyz)
+	app.Health.Add("mail_workers", func(ctx context.Context) error {
+		if !pool.Running() {
+			return errors.New("mail workers are not running")
+		}
+		return nil
+	})
+
+	return pool, nil
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/sms"
+)
+
+// startSMSQueue starts the workers that send text messages from app.SMSChan
+// Returns nil queue when SMS is switched off (sms.provider is "none")
+func startSMSQueue() (*sms.Queue, error) {
+
+	sender, err := sms.New(app.SMS, infoLog)
+	if err != nil || sender == nil {
+		return nil, err
+	}
+
+	t, err := sms.NewTemplates(app.Assets.SMSTemplates)
+	if err != nil {
+		return nil, err
+	}
+
+	//Buffered, so handlers never wait for slow provider
+	app.SMSChan = make(chan models.SMSData, 100)
+	app.SMSNotifier = sms.NewNotifier(t, app.SMSChan)
+
+	queue := sms.NewQueue(app.SMS, sender, errorLog)
+	queue.Listen(app.SMSChan)
+
+	return queue, nil
+}
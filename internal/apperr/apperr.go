@@ -0,0 +1,101 @@
+package apperr
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+)
+
+// Kind says what went wrong, it decides HTTP status of the response
+type Kind int
+
+const (
+	Internal   Kind = iota // bug or failure of database, mail etc. (500)
+	NotFound               // there is no such thing (404)
+	Validation             // user sent something we can't accept (400)
+	Conflict               // request is fine but clashes with current state, e.g. dates are taken (409)
+	Forbidden              // user is known but not allowed to do it (403)
+)
+
+// Error is an application error with the kind and message that is safe to show to user
+// The cause (Err) goes only to the log
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+
+	if e.Message == "" {
+		return e.Err.Error()
+	}
+
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause, so errors.Is and errors.As see through Error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// E returns error of the kind with message for user and the cause (err can be nil)
+func E(kind Kind, message string, err error) error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+// NewNotFound returns "not found" error
+func NewNotFound(message string, err error) error { return E(NotFound, message, err) }
+
+// NewValidation returns error about bad user input
+func NewValidation(message string, err error) error { return E(Validation, message, err) }
+
+// NewConflict returns error about clash with current state
+func NewConflict(message string, err error) error { return E(Conflict, message, err) }
+
+// NewForbidden returns "not allowed" error
+func NewForbidden(message string, err error) error { return E(Forbidden, message, err) }
+
+// KindOf returns kind of err: kind of the first Error in the chain, NotFound for sql.ErrNoRows, Internal otherwise
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound
+	}
+
+	return Internal
+}
+
+// Status returns HTTP status code for err
+func Status(err error) int {
+	switch KindOf(err) {
+	case NotFound:
+		return http.StatusNotFound
+	case Validation:
+		return http.StatusBadRequest
+	case Conflict:
+		return http.StatusConflict
+	case Forbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Message returns text for user: message of Error, or standard text of the status (details of
+// internal errors are never shown)
+func Message(err error) string {
+	var e *Error
+	if errors.As(err, &e) && e.Message != "" && e.Kind != Internal {
+		return e.Message
+	}
+
+	return http.StatusText(Status(err))
+}
@@ -0,0 +1,52 @@
+package apperr
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+
+	var tests = []struct {
+		name     string
+		err      error
+		status   int
+		message  string
+		detailed string
+	}{
+		{"not-found", NewNotFound("No such room", errors.New("strconv: bad id")), http.StatusNotFound, "No such room", "No such room: strconv: bad id"},
+		{"validation", NewValidation("Invalid arrival date", nil), http.StatusBadRequest, "Invalid arrival date", "Invalid arrival date"},
+		{"conflict", NewConflict("Room is already booked", nil), http.StatusConflict, "Room is already booked", "Room is already booked"},
+		{"forbidden", NewForbidden("Admins only", nil), http.StatusForbidden, "Admins only", "Admins only"},
+		{"no-rows", sql.ErrNoRows, http.StatusNotFound, "Not Found", "sql: no rows in result set"},
+		{"wrapped", fmt.Errorf("get reservation: %w", NewNotFound("No such reservation", sql.ErrNoRows)), http.StatusNotFound, "No such reservation", "get reservation: No such reservation: sql: no rows in result set"},
+		{"plain", errors.New("connection refused"), http.StatusInternalServerError, "Internal Server Error", "connection refused"},
+		//Message of internal error is never shown to user
+		{"internal", E(Internal, "password is wrong for db", nil), http.StatusInternalServerError, "Internal Server Error", "password is wrong for db"},
+	}
+
+	for _, e := range tests {
+		if got := Status(e.err); got != e.status {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.status, got)
+		}
+
+		if got := Message(e.err); got != e.message {
+			t.Errorf("%s: expected message %q but got %q", e.name, e.message, got)
+		}
+
+		if got := e.err.Error(); got != e.detailed {
+			t.Errorf("%s: expected error %q but got %q", e.name, e.detailed, got)
+		}
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	err := NewNotFound("No such email", sql.ErrNoRows)
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Error("cause is lost")
+	}
+}
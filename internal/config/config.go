@@ -1,11 +1,24 @@
 package config
 
 import (
+	"fmt"
+	"html/template"
 	"log"
-	"text/template"
+	"log/slog"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/victorluk72/booking"
+	"github.com/victorluk72/booking/internal/health"
+	"github.com/victorluk72/booking/internal/livereload"
+	"github.com/victorluk72/booking/internal/mailer"
 	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/outbox"
+	"github.com/victorluk72/booking/internal/property"
+	"github.com/victorluk72/booking/internal/reminders"
+	"github.com/victorluk72/booking/internal/sms"
+	"github.com/victorluk72/booking/internal/sso"
+	"github.com/victorluk72/booking/internal/tracing"
 )
 
 // AppConfig holds application configuration values
@@ -13,9 +26,79 @@ import (
 type AppConfig struct {
 	UseCache      bool
 	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
+	Assets        booking.Assets // Templates, static files and migrations (built into binary or from server.assets_dir)
+	Logger        *slog.Logger   // Structured logger, in handlers use logging.FromRequest(r) (it has request ID)
+	InfoLog       *log.Logger    // Info level of Logger for packages that take *log.Logger
+	ErrorLog      *log.Logger    // Error level of Logger for packages that take *log.Logger
 	InProduction  bool
 	Session       *scs.SessionManager
 	MailChan      chan models.MailData // CChannel for sending email
+	SSO           *sso.Provider        // OpenID Connect provider for staff login (nil when disabled)
+	MailCatcher   *mailer.Catcher      // Keeps emails instead of sending them when not in production (nil in production)
+	SMSChan       chan models.SMSData  // Channel for sending text messages
+	SMSNotifier   *sms.Notifier        // Sends text messages to guests who opted in (nil when SMS is off)
+	Health        *health.Checker      // Readiness checks for /readyz (database, templates, mail workers)
+	LiveReload    *livereload.Reloader // Reloads templates and pages when files change (nil unless -cache=false with -assets-dir)
+	Clock         *property.Clock      // Local time of the property: today, check-in and check-out (from Property)
+
+	// These are filled by Load (config file, environment and flags)
+	Server    ServerConfig
+	Property  property.Config // time zone, check-in and check-out
+	DB        DBConfig
+	Mail      mailer.Config // how emails are delivered (smtp, sendmail, file, log)
+	Outbox    outbox.Config // mail workers and retries
+	Notify    NotifyConfig
+	Reminders reminders.Config // arrival reminders and follow-ups
+	SMS       sms.Config       // how text messages are sent
+	Sessions  SessionConfig
+	Log       LogConfig
+	Tracing   tracing.Config // OpenTelemetry spans of requests, queries and emails
+	OIDC      sso.Config
+}
+
+// ServerConfig holds web server settings
+type ServerConfig struct {
+	Addr string // address to listen on, e.g. ":8080"
+	URL  string // public address of the site, e.g. "https://booking.example.com" (for links in emails)
+
+	ReadTimeout     time.Duration // whole request including body must be read in this time
+	WriteTimeout    time.Duration // response must be written in this time
+	IdleTimeout     time.Duration // keep-alive connection is closed after this time without requests
+	ShutdownTimeout time.Duration // how long requests in progress can finish on shutdown
+
+	AssetsDir string // read templates, static files and migrations from here instead of the binary (development)
+}
+
+// DBConfig holds database connection settings
+type DBConfig struct {
+	Host     string
+	Port     int
+	Name     string
+	User     string
+	Password string
+	SSLMode  string
+}
+
+// DSN returns connection string for the database
+func (d DBConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s",
+		d.Host, d.Port, d.Name, d.User, d.Password, d.SSLMode)
+}
+
+// NotifyConfig holds settings of staff notifications
+type NotifyConfig struct {
+	Recipients []string // always get all notifications (staff users can also subscribe on their own)
+}
+
+// SessionConfig holds session settings
+type SessionConfig struct {
+	Store           string        // "postgres" or "memory"
+	Lifetime        time.Duration // how long user stays logged in
+	CleanupInterval time.Duration // how often expired sessions are deleted (postgres store)
+}
+
+// LogConfig holds logging settings
+type LogConfig struct {
+	Level  string // "debug", "info", "warn" or "error"
+	Format string // "text", "json" or "auto" (text in development, JSON in production)
 }
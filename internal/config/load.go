@@ -0,0 +1,548 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/victorluk72/booking/internal/property"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of environment variables, e.g. BOOKING_DB_HOST for db.host
+const EnvPrefix = "BOOKING_"
+
+// Setting describes one configuration value and where it came from (see Load and Print)
+type Setting struct {
+	Key    string // key in config file, e.g. "db.host"
+	Env    string // environment variable, e.g. "BOOKING_DB_HOST"
+	Flag   string // command line flag, e.g. "dbhost"
+	Value  string // effective value
+	Source string // "default", "file", "env" or "flag"
+	Secret bool   // hide the value when printing
+}
+
+// setting binds Setting to the field of AppConfig
+type setting struct {
+	Setting
+	usage    string
+	def      string
+	required bool
+	oneOf    []string
+	value    value
+}
+
+// value is the field of AppConfig we can set from string
+type value interface {
+	Set(string) error
+	String() string
+}
+
+// settings returns all settings of the application, bound to fields of a
+func settings(a *AppConfig) []*setting {
+	list := []*setting{
+		{Setting: Setting{Key: "server.addr", Flag: "addr"}, def: ":8080", usage: "Address to listen on", value: (*stringValue)(&a.Server.Addr), required: true},
+		{Setting: Setting{Key: "server.url", Flag: "url"}, def: "http://localhost:8080", usage: "Public address of the site, used for links in emails", value: (*stringValue)(&a.Server.URL), required: true},
+		{Setting: Setting{Key: "server.read_timeout", Flag: "read-timeout"}, def: "15s", usage: "Time limit for reading whole request", value: (*durationValue)(&a.Server.ReadTimeout)},
+		{Setting: Setting{Key: "server.write_timeout", Flag: "write-timeout"}, def: "30s", usage: "Time limit for writing response", value: (*durationValue)(&a.Server.WriteTimeout)},
+		{Setting: Setting{Key: "server.idle_timeout", Flag: "idle-timeout"}, def: "2m", usage: "Idle keep-alive connections are closed after this time", value: (*durationValue)(&a.Server.IdleTimeout)},
+		{Setting: Setting{Key: "server.shutdown_timeout", Flag: "shutdown-timeout"}, def: "30s", usage: "How long requests in progress can finish on shutdown", value: (*durationValue)(&a.Server.ShutdownTimeout)},
+		{Setting: Setting{Key: "server.assets_dir", Flag: "assets-dir"}, def: "", usage: "Read templates, static files and migrations from this directory instead of the ones built into binary (development)", value: (*stringValue)(&a.Server.AssetsDir)},
+		{Setting: Setting{Key: "server.production", Flag: "production"}, def: "true", usage: "Application is in Production", value: (*boolValue)(&a.InProduction)},
+		{Setting: Setting{Key: "server.cache", Flag: "cache"}, def: "true", usage: "Use cache for templates", value: (*boolValue)(&a.UseCache)},
+
+		{Setting: Setting{Key: "property.time_zone", Flag: "time-zone"}, def: "UTC", usage: "Time zone of the property (IANA name, e.g. America/Halifax), days of stays and reminders are in it", value: (*stringValue)(&a.Property.TimeZone), required: true},
+		{Setting: Setting{Key: "property.check_in", Flag: "check-in"}, def: "15:00", usage: "Guests can arrive from this time", value: (*stringValue)(&a.Property.CheckIn)},
+		{Setting: Setting{Key: "property.check_out", Flag: "check-out"}, def: "11:00", usage: "Guests must leave until this time", value: (*stringValue)(&a.Property.CheckOut)},
+
+		{Setting: Setting{Key: "db.host", Flag: "dbhost"}, def: "localhost", usage: "Database host", value: (*stringValue)(&a.DB.Host), required: true},
+		{Setting: Setting{Key: "db.port", Flag: "dbport"}, def: "5432", usage: "Database port", value: (*portValue)(&a.DB.Port)},
+		{Setting: Setting{Key: "db.name", Flag: "dbname"}, usage: "Database name", value: (*stringValue)(&a.DB.Name), required: true},
+		{Setting: Setting{Key: "db.user", Flag: "dbuser"}, usage: "Database user", value: (*stringValue)(&a.DB.User), required: true},
+		{Setting: Setting{Key: "db.password", Flag: "dbpass", Secret: true}, usage: "Database password", value: (*stringValue)(&a.DB.Password), required: true},
+		{Setting: Setting{Key: "db.sslmode", Flag: "dbssl"}, def: "disable", usage: "Database SSL (disable, prefer, require)", value: (*stringValue)(&a.DB.SSLMode),
+			oneOf: []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}},
+
+		{Setting: Setting{Key: "mail.transport", Flag: "mail-transport"}, def: "smtp", usage: "How emails are delivered (smtp, sendmail, file, log)", value: (*stringValue)(&a.Mail.Transport),
+			oneOf: []string{"smtp", "sendmail", "file", "log"}},
+		{Setting: Setting{Key: "mail.from", Flag: "mail-from"}, def: "noreply@server.com", usage: "Sender address of emails", value: (*stringValue)(&a.Mail.From), required: true},
+		{Setting: Setting{Key: "mail.sendmail_path", Flag: "sendmail-path"}, def: "/usr/sbin/sendmail", usage: "Path to sendmail binary (sendmail transport)", value: (*stringValue)(&a.Mail.SendmailPath)},
+		{Setting: Setting{Key: "mail.dir", Flag: "mail-dir"}, def: "mail", usage: "Directory for .eml files (file transport)", value: (*stringValue)(&a.Mail.Dir)},
+
+		{Setting: Setting{Key: "smtp.host", Flag: "smtp-host"}, def: "localhost", usage: "Mail server host", value: (*stringValue)(&a.Mail.Host)},
+		{Setting: Setting{Key: "smtp.port", Flag: "smtp-port"}, def: "1025", usage: "Mail server port", value: (*portValue)(&a.Mail.Port)},
+		{Setting: Setting{Key: "smtp.username", Flag: "smtp-user"}, usage: "Mail server user", value: (*stringValue)(&a.Mail.Username)},
+		{Setting: Setting{Key: "smtp.password", Flag: "smtp-pass", Secret: true}, usage: "Mail server password", value: (*stringValue)(&a.Mail.Password)},
+		{Setting: Setting{Key: "smtp.encryption", Flag: "smtp-encryption"}, def: "none", usage: "Mail server encryption (none, starttls, tls)", value: (*stringValue)(&a.Mail.Encryption),
+			oneOf: []string{"none", "starttls", "tls"}},
+		{Setting: Setting{Key: "smtp.auth", Flag: "smtp-auth"}, def: "plain", usage: "Mail server authentication when user is set (plain, login, cram-md5)", value: (*stringValue)(&a.Mail.Auth),
+			oneOf: []string{"plain", "login", "cram-md5"}},
+		{Setting: Setting{Key: "smtp.timeout", Flag: "smtp-timeout"}, def: "10s", usage: "Mail server connect and send timeout", value: (*durationValue)(&a.Mail.Timeout)},
+
+		{Setting: Setting{Key: "notify.recipients", Flag: "notify"}, usage: "Staff emails that get all reservation notifications (comma separated)", value: (*listValue)(&a.Notify.Recipients)},
+
+		{Setting: Setting{Key: "mail.workers", Flag: "mail-workers"}, def: "2", usage: "How many emails are sent at the same time", value: (*intValue)(&a.Outbox.Workers)},
+		{Setting: Setting{Key: "mail.max_attempts", Flag: "mail-attempts"}, def: "8", usage: "Failed email is given up after this many attempts", value: (*intValue)(&a.Outbox.MaxAttempts)},
+		{Setting: Setting{Key: "mail.retry_delay", Flag: "mail-retry-delay"}, def: "30s", usage: "Delay before first retry of failed email (doubles every attempt)", value: (*durationValue)(&a.Outbox.RetryDelay)},
+		{Setting: Setting{Key: "mail.max_delay", Flag: "mail-max-delay"}, def: "1h", usage: "Longest delay between retries of failed email", value: (*durationValue)(&a.Outbox.MaxDelay)},
+		{Setting: Setting{Key: "mail.poll_interval", Flag: "mail-poll"}, def: "10s", usage: "How often mail outbox is checked", value: (*durationValue)(&a.Outbox.PollInterval)},
+		{Setting: Setting{Key: "mail.lease", Flag: "mail-lease"}, def: "5m", usage: "How long email being sent is locked for one worker, must be longer than any send (smtp.timeout)", value: (*durationValue)(&a.Outbox.Lease)},
+
+		{Setting: Setting{Key: "reminders.arrival_days", Flag: "arrival-days"}, def: "2", usage: "Send arrival reminder this many days before arrival (0 switches it off)", value: (*intValue)(&a.Reminders.ArrivalDays)},
+		{Setting: Setting{Key: "reminders.arrival_template", Flag: "arrival-template"}, def: "arrival-reminder", usage: "Email template of arrival reminder", value: (*stringValue)(&a.Reminders.ArrivalTemplate)},
+		{Setting: Setting{Key: "reminders.followup_days", Flag: "followup-days"}, def: "1", usage: "Send follow-up this many days after departure (0 switches it off)", value: (*intValue)(&a.Reminders.FollowUpDays)},
+		{Setting: Setting{Key: "reminders.followup_template", Flag: "followup-template"}, def: "follow-up", usage: "Email template of follow-up", value: (*stringValue)(&a.Reminders.FollowUpTemplate)},
+		{Setting: Setting{Key: "reminders.run_at", Flag: "reminders-at"}, def: "09:00", usage: "Time of the day when reminders are sent", value: (*stringValue)(&a.Reminders.RunAt)},
+		{Setting: Setting{Key: "reminders.assign_days", Flag: "assign-days"}, def: "1", usage: "Assign rooms to bookings arriving in this many days (0 leaves it to staff)", value: (*intValue)(&a.Reminders.AssignDays)},
+
+		{Setting: Setting{Key: "sms.provider", Flag: "sms-provider"}, def: "none", usage: "How text messages are sent (http, fake, log, none)", value: (*stringValue)(&a.SMS.Provider),
+			oneOf: []string{"http", "fake", "log", "none"}},
+		{Setting: Setting{Key: "sms.from", Flag: "sms-from"}, usage: "Sender number or name of text messages", value: (*stringValue)(&a.SMS.From)},
+		{Setting: Setting{Key: "sms.url", Flag: "sms-url"}, usage: "Gateway URL of SMS provider (http provider)", value: (*stringValue)(&a.SMS.URL)},
+		{Setting: Setting{Key: "sms.token", Flag: "sms-token", Secret: true}, usage: "API token of SMS provider (http provider)", value: (*stringValue)(&a.SMS.Token)},
+		{Setting: Setting{Key: "sms.timeout", Flag: "sms-timeout"}, def: "10s", usage: "Request timeout of SMS provider", value: (*durationValue)(&a.SMS.Timeout)},
+		{Setting: Setting{Key: "sms.workers", Flag: "sms-workers"}, def: "2", usage: "How many text messages are sent at the same time", value: (*intValue)(&a.SMS.Workers)},
+		{Setting: Setting{Key: "sms.max_attempts", Flag: "sms-attempts"}, def: "3", usage: "Failed text message is given up after this many attempts", value: (*intValue)(&a.SMS.MaxAttempts)},
+		{Setting: Setting{Key: "sms.retry_delay", Flag: "sms-retry-delay"}, def: "30s", usage: "Delay before first retry of failed text message (doubles every attempt)", value: (*durationValue)(&a.SMS.RetryDelay)},
+
+		{Setting: Setting{Key: "session.store", Flag: "session-store"}, def: "postgres", usage: "Session store (postgres, memory)", value: (*stringValue)(&a.Sessions.Store),
+			oneOf: []string{"postgres", "memory"}},
+		{Setting: Setting{Key: "session.lifetime", Flag: "session-lifetime"}, def: "24h", usage: "How long session is valid", value: (*durationValue)(&a.Sessions.Lifetime)},
+		{Setting: Setting{Key: "session.cleanup", Flag: "session-cleanup"}, def: "5m", usage: "How often to delete expired sessions from postgres store", value: (*durationValue)(&a.Sessions.CleanupInterval)},
+
+		{Setting: Setting{Key: "log.level", Flag: "log-level"}, def: "info", usage: "Log level (debug, info, warn, error)", value: (*stringValue)(&a.Log.Level),
+			oneOf: []string{"debug", "info", "warn", "error"}},
+		{Setting: Setting{Key: "log.format", Flag: "log-format"}, def: "auto", usage: "Log format (text, json, auto: text in development, JSON in production)", value: (*stringValue)(&a.Log.Format),
+			oneOf: []string{"auto", "text", "json"}},
+
+		{Setting: Setting{Key: "tracing.exporter", Flag: "trace-exporter"}, def: "none", usage: "Where OpenTelemetry spans go (none, stdout, otlp)", value: (*stringValue)(&a.Tracing.Exporter),
+			oneOf: []string{"none", "stdout", "otlp"}},
+		{Setting: Setting{Key: "tracing.endpoint", Flag: "trace-endpoint"}, def: "localhost:4318", usage: "OTLP/HTTP collector address (otlp exporter)", value: (*stringValue)(&a.Tracing.Endpoint)},
+		{Setting: Setting{Key: "tracing.insecure", Flag: "trace-insecure"}, def: "false", usage: "Send spans to collector over plain HTTP", value: (*boolValue)(&a.Tracing.Insecure)},
+		{Setting: Setting{Key: "tracing.sample_ratio", Flag: "trace-sample"}, def: "1", usage: "Share of requests that are traced (0..1)", value: (*floatValue)(&a.Tracing.SampleRatio)},
+		{Setting: Setting{Key: "tracing.service", Flag: "trace-service"}, def: "booking", usage: "Service name of spans", value: (*stringValue)(&a.Tracing.Service)},
+
+		{Setting: Setting{Key: "sso.issuer", Flag: "sso-issuer"}, usage: "OpenID Connect issuer URL (empty disables single sign-on)", value: (*stringValue)(&a.OIDC.IssuerURL)},
+		{Setting: Setting{Key: "sso.client_id", Flag: "sso-client-id"}, usage: "OpenID Connect client ID", value: (*stringValue)(&a.OIDC.ClientID)},
+		{Setting: Setting{Key: "sso.client_secret", Flag: "sso-client-secret", Secret: true}, usage: "OpenID Connect client secret", value: (*stringValue)(&a.OIDC.ClientSecret)},
+		{Setting: Setting{Key: "sso.redirect_url", Flag: "sso-redirect-url"}, def: "http://localhost:8080/user/login/sso/callback", usage: "OpenID Connect redirect URL", value: (*stringValue)(&a.OIDC.RedirectURL)},
+		{Setting: Setting{Key: "sso.access_level", Flag: "sso-access-level"}, def: "1", usage: "Access level for users created by single sign-on", value: (*intValue)(&a.OIDC.DefaultAccessLevel)},
+	}
+
+	for _, s := range list {
+		s.Env = EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.Key, ".", "_"))
+	}
+
+	return list
+}
+
+// Load fills a from defaults, config file, environment variables and command line flags
+// Later source wins: flags override environment, environment overrides config file
+// The config file is given with -config flag or BOOKING_CONFIG variable (.yaml, .yml or .toml)
+func Load(a *AppConfig, args []string) ([]Setting, error) {
+
+	list := settings(a)
+
+	//1) Parse flags first (we need -config), but apply them last
+	fs := flag.NewFlagSet("booking", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "Config file (.yaml, .yml or .toml)")
+
+	flags := make(map[string]*flagValue)
+	for _, s := range list {
+		_, isBool := s.value.(*boolValue)
+		flags[s.Flag] = &flagValue{def: s.def, isBool: isBool}
+		fs.Var(flags[s.Flag], s.Flag, fmt.Sprintf("%s (env %s)", s.usage, s.Env))
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	//2) Defaults
+	for _, s := range list {
+		err = s.set(s.def, "default")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//3) Config file
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		byKey := make(map[string]*setting)
+		for _, s := range list {
+			byKey[s.Key] = s
+		}
+
+		for key, v := range values {
+			s, ok := byKey[key]
+			if !ok {
+				return nil, fmt.Errorf("config file %s: unknown setting %q", *configFile, key)
+			}
+
+			err = s.set(v, "file")
+			if err != nil {
+				return nil, fmt.Errorf("config file %s: %w", *configFile, err)
+			}
+		}
+	}
+
+	//4) Environment variables
+	for _, s := range list {
+		if v, ok := os.LookupEnv(s.Env); ok {
+			err = s.set(v, "env")
+			if err != nil {
+				return nil, fmt.Errorf("environment: %w", err)
+			}
+		}
+	}
+
+	//5) Flags that were given in command line
+	for _, s := range list {
+		if f := flags[s.Flag]; f.given {
+			err = s.set(f.raw, "flag")
+			if err != nil {
+				return nil, fmt.Errorf("flag -%s: %w", s.Flag, err)
+			}
+		}
+	}
+
+	//Check the result and report all problems at once
+	var problems []string
+	for _, s := range list {
+		if p := s.validate(); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	problems = append(problems, validate(a)...)
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	effective := make([]Setting, 0, len(list))
+	for _, s := range list {
+		s.Value = s.value.String()
+		effective = append(effective, s.Setting)
+	}
+
+	return effective, nil
+}
+
+// Print writes effective configuration, secrets are hidden
+func Print(w io.Writer, settings []Setting) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	for _, s := range settings {
+		v := s.Value
+		if s.Secret && v != "" {
+			v = "******"
+		}
+		fmt.Fprintf(tw, "%s\t= %s\t(%s)\n", s.Key, v, s.Source)
+	}
+
+	tw.Flush()
+}
+
+// Attrs returns settings as key-value pairs for structured log (secrets are hidden)
+func Attrs(settings []Setting) []any {
+	attrs := make([]any, 0, len(settings))
+
+	for _, s := range settings {
+		v := s.Value
+		if s.Secret && v != "" {
+			v = "******"
+		}
+		attrs = append(attrs, slog.String(s.Key, v))
+	}
+
+	return attrs
+}
+
+// set parses v into the field and remembers the source
+func (s *setting) set(v, source string) error {
+	err := s.value.Set(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Key, err)
+	}
+	s.Source = source
+	return nil
+}
+
+// validate returns problem description or empty string
+func (s *setting) validate() string {
+	v := s.value.String()
+
+	if s.required && v == "" {
+		return fmt.Sprintf("%s is required (set %s in config file, %s environment variable or -%s flag)", s.Key, s.Key, s.Env, s.Flag)
+	}
+
+	if len(s.oneOf) > 0 {
+		for _, o := range s.oneOf {
+			if v == o {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%s must be one of %s, got %q", s.Key, strings.Join(s.oneOf, ", "), v)
+	}
+
+	return ""
+}
+
+// validate checks rules that involve several settings
+func validate(a *AppConfig) []string {
+	var problems []string
+
+	if a.Server.ReadTimeout <= 0 || a.Server.WriteTimeout <= 0 || a.Server.IdleTimeout <= 0 || a.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.read_timeout, server.write_timeout, server.idle_timeout and server.shutdown_timeout must be positive")
+	}
+
+	if _, err := property.NewClock(a.Property); err != nil {
+		problems = append(problems, fmt.Sprintf("property: %v", err))
+	}
+
+	if a.Sessions.Lifetime <= 0 {
+		problems = append(problems, "session.lifetime must be positive")
+	}
+
+	if a.Mail.Transport == "smtp" && a.Mail.Host == "" {
+		problems = append(problems, "smtp.host is required for smtp mail transport")
+	}
+
+	if a.Mail.Transport == "file" && a.Mail.Dir == "" {
+		problems = append(problems, "mail.dir is required for file mail transport")
+	}
+
+	if a.Outbox.Workers < 1 || a.Outbox.MaxAttempts < 1 {
+		problems = append(problems, "mail.workers and mail.max_attempts must be at least 1")
+	}
+
+	if a.Outbox.RetryDelay <= 0 || a.Outbox.MaxDelay <= 0 || a.Outbox.PollInterval <= 0 {
+		problems = append(problems, "mail.retry_delay, mail.max_delay and mail.poll_interval must be positive")
+	}
+
+	//Another worker takes the email again when lease runs out, so sending must end before
+	if a.Outbox.Lease <= 0 || (a.Mail.Transport == "smtp" && a.Outbox.Lease <= a.Mail.Timeout) {
+		problems = append(problems, "mail.lease must be positive and longer than smtp.timeout")
+	}
+
+	if a.SMS.Provider == "http" && a.SMS.URL == "" {
+		problems = append(problems, "sms.url is required for http sms provider")
+	}
+
+	if a.SMS.Workers < 1 || a.SMS.MaxAttempts < 1 || a.SMS.RetryDelay <= 0 {
+		problems = append(problems, "sms.workers and sms.max_attempts must be at least 1, sms.retry_delay must be positive")
+	}
+
+	if a.Reminders.ArrivalDays < 0 || a.Reminders.FollowUpDays < 0 || a.Reminders.AssignDays < 0 {
+		problems = append(problems, "reminders.arrival_days, reminders.followup_days and reminders.assign_days can't be negative")
+	}
+
+	if _, err := time.Parse("15:04", a.Reminders.RunAt); err != nil {
+		problems = append(problems, fmt.Sprintf("reminders.run_at must be time of the day like 09:00, got %q", a.Reminders.RunAt))
+	}
+
+	if a.Tracing.SampleRatio < 0 || a.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sample_ratio must be between 0 and 1")
+	}
+
+	if a.Tracing.Exporter == "otlp" && a.Tracing.Endpoint == "" {
+		problems = append(problems, "tracing.endpoint is required for otlp exporter")
+	}
+
+	if a.OIDC.IssuerURL != "" && a.OIDC.ClientID == "" {
+		problems = append(problems, "sso.client_id is required when sso.issuer is set")
+	}
+
+	return problems
+}
+
+// readFile reads config file and returns flat map of values ("db.host" => "localhost")
+func readFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	tree := make(map[string]interface{})
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &tree)
+	case ".toml":
+		err = toml.Unmarshal(b, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s: unknown format (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	err = flatten("", tree, values)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// flatten turns nested sections into dotted keys
+func flatten(prefix string, tree map[string]interface{}, out map[string]string) error {
+
+	//Sort keys, so errors are reported in the same order every time
+	keys := make([]string, 0, len(tree))
+	for k := range tree {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch v := tree[k].(type) {
+		case map[string]interface{}:
+			err := flatten(key, v, out)
+			if err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+
+	return nil
+}
+
+// flagValue remembers the flag from command line until we are ready to apply it
+type flagValue struct {
+	raw    string
+	def    string
+	given  bool
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.def
+}
+
+func (f *flagValue) Set(v string) error {
+	f.raw = v
+	f.given = true
+	return nil
+}
+
+// IsBoolFlag allows "-production" without value (see flag package)
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+//--These types set the fields of AppConfig from strings
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(strings.TrimSpace(s)); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+// listValue is comma separated list, e.g. "a@here.ca, b@here.ca" (lists in config file are joined the same way)
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	i, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
+	}
+	*v = intValue(i)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type floatValue float64
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
+	}
+	*v = floatValue(f)
+	return nil
+}
+func (v *floatValue) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+
+type portValue int
+
+func (v *portValue) Set(s string) error {
+	i, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || i < 1 || i > 65535 {
+		return fmt.Errorf("%q is not a valid port", s)
+	}
+	*v = portValue(i)
+	return nil
+}
+func (v *portValue) String() string { return strconv.Itoa(int(*v)) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%q is not a duration (e.g. 30m, 24h)", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
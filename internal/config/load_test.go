@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile creates config file in temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// requiredFlags are the minimum to get valid configuration
+var requiredFlags = []string{"-dbname=bookings", "-dbuser=user", "-dbpass=secret"}
+
+func TestLoadDefaults(t *testing.T) {
+	var a AppConfig
+
+	_, err := Load(&a, requiredFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Server.Addr != ":8080" || a.DB.Port != 5432 || a.Sessions.Lifetime != 24*time.Hour || !a.InProduction {
+		t.Errorf("unexpected defaults %+v", a)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+
+	yml := writeFile(t, "config.yml", `
+server:
+  addr: ":9000"
+  production: false
+db:
+  host: filehost
+  port: 5433
+  name: filedb
+  user: fileuser
+  password: filepass
+smtp:
+  host: mail.example.com
+session:
+  lifetime: 2h
+notify:
+  recipients: [owner@here.ca, staff@here.ca]
+`)
+
+	//env wins over file, flag wins over env
+	t.Setenv("BOOKING_DB_HOST", "envhost")
+	t.Setenv("BOOKING_DB_NAME", "envdb")
+	t.Setenv("BOOKING_SMTP_PORT", "2525")
+
+	var a AppConfig
+	settings, err := Load(&a, []string{"-config", yml, "-dbname=flagdb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"addr from file", a.Server.Addr, ":9000"},
+		{"production from file", a.InProduction, false},
+		{"port from file", a.DB.Port, 5433},
+		{"host from env", a.DB.Host, "envhost"},
+		{"name from flag", a.DB.Name, "flagdb"},
+		{"smtp host from file", a.Mail.Host, "mail.example.com"},
+		{"smtp port from env", a.Mail.Port, 2525},
+		{"lifetime from file", a.Sessions.Lifetime, 2 * time.Hour},
+		{"default", a.DB.SSLMode, "disable"},
+		{"list from file", strings.Join(a.Notify.Recipients, "|"), "owner@here.ca|staff@here.ca"},
+	}
+
+	for _, e := range tests {
+		if e.got != e.expected {
+			t.Errorf("%s: expected %v but got %v", e.name, e.expected, e.got)
+		}
+	}
+
+	sources := make(map[string]string)
+	for _, s := range settings {
+		sources[s.Key] = s.Source
+	}
+
+	if sources["db.name"] != "flag" || sources["db.host"] != "env" || sources["db.port"] != "file" || sources["db.sslmode"] != "default" {
+		t.Errorf("unexpected sources %v", sources)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+
+	path := writeFile(t, "config.toml", `
+[db]
+name = "tomldb"
+user = "tomluser"
+password = "tomlpass"
+port = 6543
+
+[session]
+store = "memory"
+`)
+
+	var a AppConfig
+	_, err := Load(&a, []string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.DB.Name != "tomldb" || a.DB.Port != 6543 || a.Sessions.Store != "memory" {
+		t.Errorf("unexpected values %+v", a)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+
+	unknown := writeFile(t, "unknown.yml", "db:\n  hots: localhost\n")
+
+	var tests = []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"missing", []string{}, "db.name is required"},
+		{"missing-env-hint", []string{}, "BOOKING_DB_PASSWORD"},
+		{"bad-port", append([]string{"-dbport=70000"}, requiredFlags...), "not a valid port"},
+		{"bad-store", append([]string{"-session-store=redis"}, requiredFlags...), "session.store must be one of"},
+		{"bad-duration", append([]string{"-session-lifetime=day"}, requiredFlags...), "not a duration"},
+		{"bad-transport", append([]string{"-mail-transport=pigeon"}, requiredFlags...), "mail.transport must be one of"},
+		{"bad-log-format", append([]string{"-log-format=xml"}, requiredFlags...), "log.format must be one of"},
+		{"bad-sample-ratio", append([]string{"-trace-sample=2"}, requiredFlags...), "tracing.sample_ratio must be between 0 and 1"},
+		{"smtp-without-host", append([]string{"-smtp-host="}, requiredFlags...), "smtp.host is required"},
+		{"short-mail-lease", append([]string{"-mail-lease=5s", "-smtp-timeout=10s"}, requiredFlags...), "mail.lease must be positive and longer than smtp.timeout"},
+		{"sms-http-without-url", append([]string{"-sms-provider=http"}, requiredFlags...), "sms.url is required"},
+		{"unknown-key", append([]string{"-config", unknown}, requiredFlags...), `unknown setting "db.hots"`},
+		{"sso-without-client", append([]string{"-sso-issuer=http://localhost"}, requiredFlags...), "sso.client_id is required"},
+		{"no-file", []string{"-config", "missing.yml"}, "cannot read config file"},
+	}
+
+	for _, e := range tests {
+		var a AppConfig
+
+		_, err := Load(&a, e.args)
+		if err == nil {
+			t.Errorf("%s: expected error", e.name)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), e.expected) {
+			t.Errorf("%s: expected %q in error, got %q", e.name, e.expected, err)
+		}
+	}
+}
+
+func TestPrintHidesSecrets(t *testing.T) {
+	var a AppConfig
+
+	settings, err := Load(&a, append([]string{"-smtp-pass=mailpass123"}, requiredFlags...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	Print(&buf, settings)
+
+	out := buf.String()
+	if strings.Contains(out, "mailpass123") || strings.Contains(out, "= secret") {
+		t.Errorf("secret is printed:\n%s", out)
+	}
+
+	if !strings.Contains(out, "bookings") {
+		t.Errorf("expected db name in output:\n%s", out)
+	}
+}
+
+func TestLoadExampleFile(t *testing.T) {
+	var a AppConfig
+
+	//example file must stay in sync with settings (unknown keys are errors)
+	_, err := Load(&a, []string{"-config", "../../config.example.yml", "-dbpass=secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
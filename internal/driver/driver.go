@@ -1,9 +1,9 @@
 package driver
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"time"
 
 	//Drivers for Postgres
@@ -28,7 +28,7 @@ const maxDBLifeTime = 5 * time.Minute
 func ConnectSQL(dsn string) (*DB, error) {
 	db, err := NewDatabase(dsn)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	//Set up some default parameters for connections
@@ -53,19 +53,16 @@ func ConnectSQL(dsn string) (*DB, error) {
 func NewDatabase(dsn string) (*sql.DB, error) {
 	conn, err := sql.Open("pgx", dsn)
 	if err != nil {
-		log.Fatal(fmt.Sprintf("Unable to connect: %v\n", err))
-		return nil, err
+		return nil, fmt.Errorf("unable to connect: %w", err)
 	}
 
 	//Ping the connection
 	if err = conn.Ping(); err != nil {
-		log.Fatal("Cannot ping database")
-		return nil, err
-
+		conn.Close()
+		return nil, fmt.Errorf("cannot ping database: %w", err)
 	}
-	fmt.Println("Pinged database...")
 
-	return conn, err
+	return conn, nil
 }
 
 // test DB tries to ping db connection
@@ -78,3 +75,8 @@ func testDB(d *sql.DB) error {
 	return nil
 
 }
+
+// Ping checks that database can be reached (used by /readyz)
+func (d *DB) Ping(ctx context.Context) error {
+	return d.SQL.PingContext(ctx)
+}
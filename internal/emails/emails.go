@@ -0,0 +1,172 @@
+package emails
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/render"
+)
+
+// Email templates use the same custom functions as pages (see package render)
+var functions = map[string]interface{}{
+	"humanDate":  render.HumaneDate,
+	"formatDate": render.FormatDate,
+	"iterate":    render.Iterate,
+	"addInt":     render.AddInt,
+
+	//Guest emails are in language of the reservation: {{t .Locale "Dear %s," $res.FirstName}}
+	"t":      i18n.T,
+	"date":   i18n.Date,
+	"number": i18n.Number,
+	"time":   i18n.Time,
+
+	//Check-in and check-out of reservation, in time zone of its property (see package property)
+	"arrival": func(res models.Reservation) time.Time {
+		return app.Clock.For(res.RoomType.Property).Arrival(res.StartDate)
+	},
+	"departure": func(res models.Reservation) time.Time {
+		return app.Clock.For(res.RoomType.Property).Departure(res.EndDate)
+	},
+}
+
+// Template is one email: HTML part and plain text part (with "subject" defined in it)
+// Text part uses text/template, html escaping would spoil plain text
+type Template struct {
+	HTML *htmltemplate.Template
+	Text *template.Template
+}
+
+// This variable is a pointer to my site-wide config package
+var app *config.AppConfig
+
+// The cache of email templates
+var cache map[string]*Template
+
+// NewEmails sets the config for emails package and reads email templates from a.Assets
+func NewEmails(a *config.AppConfig) error {
+	tc, err := CreateTemplateCache(a.Assets.EmailTemplates)
+	if err != nil {
+		return err
+	}
+
+	app = a
+	cache = tc
+
+	return nil
+}
+
+// Message builds email from template "name" (e.g. "confirmation") for recipient "to"
+// Data is available in templates as dot, e.g. {{.Reservation.FirstName}}
+// Email is in language of data["Locale"] (guest emails pass locale of the reservation), in i18n.Default without it
+// Email is about property data["Property"], admin pages show it only to staff of the property
+func Message(to, name string, data interface{}) (models.MailData, error) {
+
+	data = i18n.AddLocale(data, i18n.Default)
+
+	//Same as pages: in development read templates from disk every time
+	tc := cache
+	if !app.UseCache {
+		var err error
+		tc, err = CreateTemplateCache(app.Assets.EmailTemplates)
+		if err != nil {
+			return models.MailData{}, err
+		}
+	}
+
+	t, ok := tc[name]
+	if !ok {
+		return models.MailData{}, fmt.Errorf("email template %q not found", name)
+	}
+
+	var subject, text, html bytes.Buffer
+
+	err := t.Text.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	err = t.Text.Execute(&text, data)
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	err = t.HTML.Execute(&html, data)
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	msg := models.MailData{
+		To:      to,
+		From:    app.Mail.From,
+		Subject: strings.TrimSpace(subject.String()),
+		Content: strings.TrimSpace(html.String()),
+		Text:    strings.TrimSpace(text.String()),
+	}
+
+	if m, ok := data.(map[string]interface{}); ok {
+		if p, ok := m["Property"].(models.Property); ok {
+			msg.PropertyID = p.ID
+		}
+	}
+
+	return msg, nil
+}
+
+// CreateTemplateCache reads all emails from fsys: every name.mail.html needs name.mail.txt next to it
+// Layouts are base.layout.html and base.layout.txt
+func CreateTemplateCache(fsys fs.FS) (map[string]*Template, error) {
+
+	myCache := map[string]*Template{}
+
+	pages, err := fs.Glob(fsys, "*.mail.html")
+	if err != nil {
+		return myCache, err
+	}
+
+	if len(pages) == 0 {
+		return myCache, errors.New("no email templates found")
+	}
+
+	for _, page := range pages {
+		name := strings.TrimSuffix(path.Base(page), ".mail.html")
+		textPage := strings.TrimSuffix(page, ".html") + ".txt"
+
+		html, err := htmltemplate.New(path.Base(page)).Funcs(functions).ParseFS(fsys, page)
+		if err != nil {
+			return myCache, err
+		}
+
+		html, err = html.ParseFS(fsys, "*.layout.html")
+		if err != nil {
+			return myCache, err
+		}
+
+		text, err := template.New(path.Base(textPage)).Funcs(functions).ParseFS(fsys, textPage)
+		if err != nil {
+			return myCache, err
+		}
+
+		text, err = text.ParseFS(fsys, "*.layout.txt")
+		if err != nil {
+			return myCache, err
+		}
+
+		if text.Lookup("subject") == nil {
+			return myCache, fmt.Errorf("%s: subject is not defined", textPage)
+		}
+
+		myCache[name] = &Template{HTML: html, Text: text}
+	}
+
+	return myCache, nil
+}
@@ -0,0 +1,228 @@
+package emails
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorluk72/booking"
+	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
+)
+
+var testApp config.AppConfig
+
+var reservation = models.Reservation{
+	FirstName: "Tom",
+	LastName:  "Hanks",
+	Email:     "tom@hanks.com",
+	StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+	EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+	RoomType:  models.RoomType{Name: "General's Quarters"},
+}
+
+func setup(t *testing.T) {
+	testApp.Mail.From = "owner@here.ca"
+	testApp.UseCache = true
+	testApp.Assets = booking.Embedded()
+
+	clock, err := property.NewClock(property.Config{TimeZone: "America/Halifax", CheckIn: "15:00", CheckOut: "11:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testApp.Clock = clock
+
+	err = i18n.Load(testApp.Assets.Locales)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewEmails(&testApp)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	setup(t)
+
+	var tests = []struct {
+		name    string
+		subject string
+		date    string // guests get dates with name of month, staff gets them as before
+	}{
+		{"confirmation", "Your reservation is received", "January 1, 2050"},
+		{"modification", "Your reservation has been changed", "January 1, 2050"},
+		{"cancellation", "Your reservation has been cancelled", "January 1, 2050"},
+		{"staff-new", "New reservation: General's Quarters from 2050-01-01", "2050-01-01"},
+		{"staff-modified", "Reservation changed: Tom Hanks from 2050-01-01", "2050-01-01"},
+		{"staff-cancelled", "Reservation cancelled: Tom Hanks from 2050-01-01", "2050-01-01"},
+		{"arrival-reminder", "Your stay starts on January 1, 2050", "January 1, 2050"},
+	}
+
+	for _, e := range tests {
+		msg, err := Message("tom@hanks.com", e.name, map[string]interface{}{"Reservation": reservation, "Link": "http://localhost/admin/reservations/new/1"})
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+
+		if msg.Subject != e.subject {
+			t.Errorf("%s: expected subject %q but got %q", e.name, e.subject, msg.Subject)
+		}
+
+		if msg.From != "owner@here.ca" || msg.To != "tom@hanks.com" {
+			t.Errorf("%s: unexpected addresses %s -> %s", e.name, msg.From, msg.To)
+		}
+
+		//Both parts have the layout and the dates
+		for _, part := range []string{msg.Content, msg.Text} {
+			if !strings.Contains(part, "Fort Smythe") || !strings.Contains(part, e.date) {
+				t.Errorf("%s: unexpected content:\n%s", e.name, part)
+			}
+		}
+
+		//Guest emails with the stay have check-in and check-out times of the property
+		if e.name == "confirmation" || e.name == "modification" || e.name == "arrival-reminder" {
+			if !strings.Contains(msg.Text, "3:00 PM") || !strings.Contains(msg.Text, "11:00 AM") {
+				t.Errorf("%s: no check-in and check-out times:\n%s", e.name, msg.Text)
+			}
+		}
+
+		if strings.Contains(msg.Text, "<") {
+			t.Errorf("%s: html in text part:\n%s", e.name, msg.Text)
+		}
+	}
+}
+
+func TestStaffLinks(t *testing.T) {
+	setup(t)
+
+	link := "http://localhost/admin/reservations/new/7"
+
+	msg, err := Message("owner@here.ca", "staff-new", map[string]interface{}{"Reservation": reservation, "Link": link})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(msg.Content, `href="`+link+`"`) || !strings.Contains(msg.Text, link) {
+		t.Errorf("link is missing:\n%s\n%s", msg.Content, msg.Text)
+	}
+}
+
+func TestBlockedMessage(t *testing.T) {
+	setup(t)
+
+	block := models.RoomRestriction{Room: models.Room{RoomName: "General's Quarters"}, StartDate: reservation.StartDate}
+
+	msg, err := Message("owner@here.ca", "staff-blocked", map[string]interface{}{
+		"Added":   []models.RoomRestriction{block},
+		"Removed": []models.RoomRestriction{},
+		"Link":    "http://localhost/admin/reservation-calendar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(msg.Text, "Blocked:") || strings.Contains(msg.Text, "Unblocked:") || !strings.Contains(msg.Text, "General's Quarters: 2050-01-01") {
+		t.Errorf("unexpected text:\n%s", msg.Text)
+	}
+}
+
+func TestMessageEscapesHTML(t *testing.T) {
+	setup(t)
+
+	res := reservation
+	res.FirstName = "<script>alert(1)</script>"
+
+	msg, err := Message("tom@hanks.com", "confirmation", map[string]interface{}{"Reservation": res})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(msg.Content, "<script>") {
+		t.Errorf("name is not escaped in html part:\n%s", msg.Content)
+	}
+
+	//Plain text is not html, it must stay as it was
+	if !strings.Contains(msg.Text, "<script>") {
+		t.Errorf("name is changed in text part:\n%s", msg.Text)
+	}
+}
+
+func TestMessageUnknownTemplate(t *testing.T) {
+	setup(t)
+
+	_, err := Message("tom@hanks.com", "no-such-email", nil)
+	if err == nil {
+		t.Error("expected error for unknown template")
+	}
+}
+
+func TestMessageLocale(t *testing.T) {
+	setup(t)
+
+	msg, err := Message("tom@hanks.com", "confirmation", map[string]interface{}{"Reservation": reservation, "Locale": "fr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Subject != "Votre réservation a bien été reçue" {
+		t.Errorf("expected french subject but got %q", msg.Subject)
+	}
+
+	for _, part := range []string{msg.Content, msg.Text} {
+		if !strings.Contains(part, "1 janvier 2050") || !strings.Contains(part, "15:00") {
+			t.Errorf("expected french dates:\n%s", part)
+		}
+	}
+}
+
+func TestMessageProperty(t *testing.T) {
+	setup(t)
+
+	//Property with its own branding, time zone and check-in (check-out comes from configuration)
+	p := models.Property{
+		ID:           2,
+		Name:         "Harbour View Inn",
+		ContactEmail: "stay@harbour.example",
+		TimeZone:     "Europe/Paris",
+		CheckIn:      "14:00",
+		LogoURL:      "https://harbour.example/logo.png",
+		BrandColor:   "#aa3300",
+	}
+
+	res := reservation
+	res.RoomType.PropertyID = p.ID
+	res.RoomType.Property = p
+
+	msg, err := Message("tom@hanks.com", "confirmation", map[string]interface{}{"Reservation": res, "Property": p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Admin pages show email only to staff of the property it is about
+	if msg.PropertyID != p.ID {
+		t.Errorf("expected email about property %d, got %d", p.ID, msg.PropertyID)
+	}
+
+	for _, part := range []string{msg.Content, msg.Text} {
+		for _, want := range []string{"Harbour View Inn", "stay@harbour.example", "2:00 PM", "11:00 AM"} {
+			if !strings.Contains(part, want) {
+				t.Errorf("expected %q in email:\n%s", want, part)
+			}
+		}
+
+		if strings.Contains(part, "Fort Smythe") {
+			t.Errorf("unexpected default name in email:\n%s", part)
+		}
+	}
+
+	for _, want := range []string{"background: #aa3300", `src="https://harbour.example/logo.png"`} {
+		if !strings.Contains(msg.Content, want) {
+			t.Errorf("expected %q in HTML part:\n%s", want, msg.Content)
+		}
+	}
+}
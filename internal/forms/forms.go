@@ -1,12 +1,12 @@
 package forms
 
 import (
-	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/victorluk72/booking/internal/i18n"
 )
 
 // This is a struct to store form values and errors
@@ -14,6 +14,7 @@ import (
 type Form struct {
 	url.Values
 	Errors errors
+	Locale string // language of error messages (see package i18n), English when empty
 }
 
 // Valid is to validate if from is valid
@@ -30,8 +31,8 @@ func (f *Form) Valid() bool {
 func New(data url.Values) *Form {
 
 	return &Form{
-		data,
-		errors(map[string][]string{}),
+		Values: data,
+		Errors: errors(map[string][]string{}),
 	}
 }
 
@@ -45,7 +46,7 @@ func (f *Form) Required(fields ...string) {
 
 		//Check if thre is any value in the field
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field, "This field can't be blank")
+			f.Errors.Add(field, i18n.T(f.Locale, "This field can't be blank"))
 		}
 	}
 
@@ -71,7 +72,7 @@ func (f *Form) MinLength(field string, length int, r *http.Request) bool {
 	x := r.Form.Get(field)
 
 	if len(x) < length {
-		f.Errors.Add(field, fmt.Sprintf("This filed must be at least %d characters long", length))
+		f.Errors.Add(field, i18n.T(f.Locale, "This field must be at least %d characters long", length))
 		return false
 	}
 	return true
@@ -82,7 +83,36 @@ func (f *Form) MinLength(field string, length int, r *http.Request) bool {
 func (f *Form) IsEmail(field string) bool {
 
 	if !govalidator.IsEmail(f.Get(field)) {
-		f.Errors.Add(field, "Invalid email address")
+		f.Errors.Add(field, i18n.T(f.Locale, "Invalid email address"))
+		return false
+	}
+
+	//Happy path
+	return true
+}
+
+// IsPhone validates if field is phone number: digits with optional leading +,
+// spaces, dashes, dots and brackets are allowed, e.g. "+1 (555) 123-4567"
+func (f *Form) IsPhone(field string) bool {
+
+	value := strings.TrimSpace(f.Get(field))
+	digits := 0
+
+	for i, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case strings.ContainsRune(" -.()", r):
+		default:
+			f.Errors.Add(field, i18n.T(f.Locale, "Invalid phone number"))
+			return false
+		}
+	}
+
+	//E.164 numbers have at most 15 digits
+	if digits < 7 || digits > 15 {
+		f.Errors.Add(field, i18n.T(f.Locale, "Invalid phone number"))
 		return false
 	}
 
@@ -1,24 +1,36 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/victorluk72/booking/internal/apperr"
 	"github.com/victorluk72/booking/internal/config"
 	"github.com/victorluk72/booking/internal/driver"
+	"github.com/victorluk72/booking/internal/emails"
 	"github.com/victorluk72/booking/internal/forms"
 	"github.com/victorluk72/booking/internal/helpers"
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/logging"
+	"github.com/victorluk72/booking/internal/mailer"
+	"github.com/victorluk72/booking/internal/metrics"
 	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
 	"github.com/victorluk72/booking/internal/render"
 	"github.com/victorluk72/booking/internal/repository"
 	"github.com/victorluk72/booking/internal/repository/dbrepo"
+	"github.com/victorluk72/booking/internal/sso"
 )
 
 //----This is section about Repository--------------
@@ -39,6 +51,14 @@ func NewRipo(a *config.AppConfig, db *driver.DB) *Repository {
 	}
 }
 
+// NewTestRepo creates new repository for tests (no real database behind)
+func NewTestRepo(a *config.AppConfig) *Repository {
+	return &Repository{
+		App: a,
+		DB:  dbrepo.NewTestingRepo(a),
+	}
+}
+
 // NewHandlers sets repository to the handlers
 func NewHandlers(r *Repository) {
 	Ripo = r
@@ -47,12 +67,21 @@ func NewHandlers(r *Repository) {
 
 //----End of the section about Repository--------------
 
+// renderPage renders the template, page that can't be rendered (missing template, template error)
+// becomes 500 page instead of empty one
+func renderPage(w http.ResponseWriter, r *http.Request, tmpl string, td *models.TemplateData) {
+	err := render.Template(w, r, tmpl, td)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
 //---------------HANDLERS FOR FRONT END---------------------------------
 
 // With the receiver for functiom (m *Repository) all my handlers has
 // access to all variable from Repository (app configs and DB access in particular)
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "home.page.html", &models.TemplateData{})
+	renderPage(w, r, "home.page.html", &models.TemplateData{})
 }
 
 // About is the handler for the about page
@@ -62,7 +91,7 @@ func (m *Repository) About(w http.ResponseWriter, r *http.Request) {
 	stringMap := make(map[string]string)
 	stringMap["testKey"] = "Sent from handler"
 
-	render.Template(w, r, "about.page.html", &models.TemplateData{
+	renderPage(w, r, "about.page.html", &models.TemplateData{
 		StringMap: stringMap,
 	})
 }
@@ -74,8 +103,13 @@ func (m *Repository) Login(w http.ResponseWriter, r *http.Request) {
 	stringMap := make(map[string]string)
 	stringMap["testKey"] = "Sent from handler"
 
-	render.Template(w, r, "login.page.html", &models.TemplateData{
+	//Show "company account" button only when single sign-on is configured
+	data := make(map[string]interface{})
+	data["sso_enabled"] = m.App.SSO != nil
+
+	renderPage(w, r, "login.page.html", &models.TemplateData{
 		Form: forms.New(nil),
+		Data: data,
 	})
 }
 
@@ -88,7 +122,7 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 	//Parse form
 	err := r.ParseForm()
 	if err != nil {
-		log.Println(err)
+		logging.FromRequest(r).Warn("can't parse form", "error", err)
 	}
 
 	//Get data from form to variable
@@ -101,7 +135,7 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 	form.IsEmail("email")
 	if !form.Valid() {
 		//If from is not valid redirect back to initial form
-		render.Template(w, r, "login.page.html", &models.TemplateData{
+		renderPage(w, r, "login.page.html", &models.TemplateData{
 			Form: form,
 		})
 		return
@@ -110,9 +144,10 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 
 	//If form is valid try to authenticate the user
 	//Call out custm build function Authenticate that returns three parameters
-	id, _, err := m.DB.Authenticate(email, password)
+	id, _, err := m.DB.Authenticate(r.Context(), email, password)
 	if err != nil {
-		log.Println("Can't login", err)
+		//Email is not logged: it is personal data, and people type passwords into it by mistake
+		logging.FromRequest(r).Info("login failed", "error", err)
 
 		//Put error to the session, then redirect user back to page
 		m.App.Session.Put(r.Context(), "error-msg", "Invalid loging credentials")
@@ -126,6 +161,10 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 	//See helper function IsAuthenticated()
 	m.App.Session.Put(r.Context(), "user_id", id)
 	m.App.Session.Put(r.Context(), "flash-msg", "Logged in succesfully")
+
+	//Remember that this session belongs to the user (see AdminSessions)
+	m.recordUserSession(r, id)
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 
 }
@@ -133,6 +172,12 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 // Logout handles the logout logic
 func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 
+	//Forget who owned this session
+	err := m.DB.DeleteUserSession(r.Context(), m.App.Session.Token(r.Context()))
+	if err != nil {
+		logging.FromRequest(r).Error("can't delete user session", "error", err)
+	}
+
 	//Simple way to log out is to destroy the session and redirect to login page
 	_ = m.App.Session.Destroy(r.Context())
 	_ = m.App.Session.RenewToken(r.Context())
@@ -141,26 +186,149 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// SSOLogin starts single sign-on with company identity provider (OpenID Connect)
+// It stores state, nonce and PKCE verifier in the session and redirects user to provider
+func (m *Repository) SSOLogin(w http.ResponseWriter, r *http.Request) {
+
+	//Single sign-on is not configured
+	if m.App.SSO == nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	state, err := sso.RandomString()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	nonce, err := sso.RandomString()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	verifier := sso.NewVerifier()
+
+	//We will check these when provider redirects user back (see SSOCallback)
+	m.App.Session.Put(r.Context(), "sso_state", state)
+	m.App.Session.Put(r.Context(), "sso_nonce", nonce)
+	m.App.Session.Put(r.Context(), "sso_verifier", verifier)
+
+	http.Redirect(w, r, m.App.SSO.AuthCodeURL(state, nonce, verifier), http.StatusSeeOther)
+}
+
+// SSOCallback handles redirect back from identity provider
+// Verified email is mapped to existing user, unknown users are created with default access level
+func (m *Repository) SSOCallback(w http.ResponseWriter, r *http.Request) {
+
+	if m.App.SSO == nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	//Take values from session (Pop removes them, they can be used only once)
+	state := m.App.Session.PopString(r.Context(), "sso_state")
+	nonce := m.App.Session.PopString(r.Context(), "sso_nonce")
+	verifier := m.App.Session.PopString(r.Context(), "sso_verifier")
+
+	q := r.URL.Query()
+
+	//Negative path: user cancelled login or provider returned error, or state doesn't match
+	if q.Get("error") != "" || state == "" || q.Get("state") != state {
+		logging.FromRequest(r).Info("sso login failed", "error", q.Get("error"), "error_description", q.Get("error_description"))
+		m.App.Session.Put(r.Context(), "error-msg", "Single sign-on failed")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	identity, err := m.App.SSO.Exchange(r.Context(), q.Get("code"), nonce, verifier)
+	if err != nil {
+		logging.FromRequest(r).Info("sso login failed", "error", err)
+		m.App.Session.Put(r.Context(), "error-msg", "Single sign-on failed")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	//Find existing user by email or create new one
+	user, err := m.DB.GetUserByEmail(r.Context(), identity.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		user = models.User{
+			FirstName:   identity.FirstName,
+			LastName:    identity.LastName,
+			Email:       identity.Email,
+			AccessLevel: m.App.SSO.Config.DefaultAccessLevel,
+		}
+
+		user.ID, err = m.DB.InsertUser(r.Context(), user)
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	//Prevent session fixation attack - renews the tocken
+	_ = m.App.Session.RenewToken(r.Context())
+
+	//The same as for login form (see PostLogin)
+	m.App.Session.Put(r.Context(), "user_id", user.ID)
+	m.App.Session.Put(r.Context(), "flash-msg", "Logged in succesfully")
+	m.recordUserSession(r, user.ID)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// recordUserSession stores the owner of current session, so admins can list and revoke sessions
+// Call it after token is renewed (login), otherwise we record the old token
+func (m *Repository) recordUserSession(r *http.Request, userID int) {
+
+	us := models.UserSession{
+		Token:     m.App.Session.Token(r.Context()),
+		UserID:    userID,
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+		Expiry:    time.Now().Add(m.App.Session.Lifetime),
+	}
+
+	//Login still works without the record, so we only log the error
+	err := m.DB.InsertUserSession(r.Context(), us)
+	if err != nil {
+		logging.FromRequest(r).Error("can't record user session", "error", err)
+	}
+}
+
+// clientIP returns address of the client without port, so every connection of the client shows the same IP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		//No port (e.g. set by proxy middleware)
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 // Reservation renders the reservsation page and display form
 func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 
 	//Get my reservation from session and put into variable, convert to string
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		helpers.ServerError(w, errors.New("cannot get reservation data from session"))
+		helpers.ServerError(w, r, errors.New("cannot get reservation data from session"))
 		return
 	}
 
-	//Get my room details using custom func GetRoomByID
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	//Guests book type of room, the room itself is assigned later (see AssignRoom)
+	roomType, err := m.DB.GetRoomTypeByID(r.Context(), res.RoomTypeID)
 	if err != nil {
 		//Use our custom built ServerError helper
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, err)
 		return
 	}
 
-	//Store room details in my res variable (which represent model Reservation)
-	res.Room.RoomName = room.RoomName
+	//Store room type details in my res variable (which represent model Reservation)
+	//Room type comes with its property, emails and summary page show its name and times
+	res.RoomType = roomType
 
 	//Put my reservation into session
 	m.App.Session.Put(r.Context(), "reservation", res)
@@ -178,7 +346,7 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	data["reservation"] = res
 
 	//This is to render empty form (first time click on route)
-	render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
+	renderPage(w, r, "make-reservation.page.html", &models.TemplateData{
 
 		//Include empty form (see package forms)
 		Form:      forms.New(nil),
@@ -193,7 +361,7 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	//Pull my reservation model from session
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		helpers.ServerError(w, errors.New("Cannot get reservation model from session"))
+		helpers.ServerError(w, r, errors.New("Cannot get reservation model from session"))
 		return
 	}
 
@@ -202,7 +370,7 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		//Use our custom built ServerError helper
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
 		return
 	}
 
@@ -214,14 +382,25 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	reservation.LastName = r.Form.Get("last_name")
 	reservation.Email = r.Form.Get("email")
 	reservation.Phone = r.Form.Get("phone")
+	reservation.SMSOptIn = r.Form.Has("sms_opt_in")
+
+	//Emails and text messages about this reservation will be in language of the page
+	reservation.Locale = i18n.FromContext(r.Context())
 
 	// Make a new form and pass date from Post request
 	form := forms.New(r.PostForm)
+	form.Locale = reservation.Locale
 
 	//------This is my server site form validation rules-----
 	//Does this form has values in provided fields
 	form.Required("first_name", "last_name", "email")
 
+	//Text messages need valid phone number
+	if reservation.SMSOptIn {
+		form.Required("phone")
+		form.IsPhone("phone")
+	}
+
 	//Does fiels matches minimum character count?
 	form.MinLength("first_name", 2, r)
 
@@ -234,7 +413,7 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 
 		//This is for not Valis form
-		log.Println("Form is not valid")
+		logging.FromRequest(r).Debug("reservation form is not valid", "errors", form.Errors)
 
 		// Create set of data to pass to the form is not valid
 		// This structure will be sent just to keep what user already entered
@@ -243,7 +422,7 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		data["reservation"] = reservation
 
 		//Now render the form and pass all stored data
-		render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
+		renderPage(w, r, "make-reservation.page.html", &models.TemplateData{
 
 			//Pass form and the data that user entered
 			Form: form,
@@ -255,57 +434,62 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 
 	}
 
-	//Add the info from form to database
-	newReservationID, err := m.DB.InsertReservstion(reservation)
+	//--SENDING EMAIL NOTIFICATIONS-------------------------------------
+
+	// Emails are built from templates in email-templates directory (see package emails)
+	emailData := map[string]interface{}{"Reservation": reservation, "Locale": reservation.Locale, "Property": reservation.RoomType.Property}
+
+	// 1) Send email to guest first
+	guestMsg, err := emails.Message(reservation.Email, "confirmation", emailData)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	//Send updated reservation model to the session
-	m.App.Session.Put(r.Context(), "reservation", reservation)
+	//--SENDING EMAIL NOTIFICATIONS ENDS HERE---------------------------
 
 	//You also nee to add new reservation to RoomRestrition table
-	//Build model for RoomRestriction table
+	//Build model for RoomRestriction table (reservation ID is set by database)
 	restriction := models.RoomRestriction{
 		StartDate:     reservation.StartDate,
 		EndDate:       reservation.EndDate,
-		ReservationID: newReservationID,
 		RestrictionID: 1,
-		RoomID:        reservation.RoomID,
+		RoomTypeID:    reservation.RoomTypeID,
 	}
 
-	//Add the info  to database
-	err = m.DB.InsertRoomRestriction(restriction)
+	//Add reservation, restriction and email to database in one transaction
+	//Email is stored in outbox and mail workers send it in background (asyncronically)
+	newReservationID, err := m.DB.InsertReservationWithMail(r.Context(), reservation, restriction, []models.MailData{guestMsg})
+	if apperr.KindOf(err) == apperr.Conflict {
+		//Somebody booked the last room of the type while guest was filling the form
+		m.App.Session.Put(r.Context(), "error-msg", i18n.T(reservation.Locale, "No rooms available for these dates"))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	//--WORK WITH DB ENDS HERE-------------------------------------
-
-	//--SENDING EMAIL NOTIFICATIONS-------------------------------------
-
-	// 1) Send email to guest first
+	reservation.ID = newReservationID
+	metrics.ReservationsCreated.Inc()
 
-	//Build the content here as HTML string
-	htmlMessage := fmt.Sprintf(`<strong>Your reservation has been completed</strong><br>
-	               Dear %s,<br>
-				   This is to confirm your reservation from %s ti %s.
-	             `, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	//Send updated reservation model to the session
+	m.App.Session.Put(r.Context(), "reservation", reservation)
 
-	//Build the message
-	msg := models.MailData{
-		To:      reservation.Email,
-		From:    "noreply@server.com",
-		Subject: "Your reservation is received",
-		Content: htmlMessage,
+	// 2) Text message to guest, if they asked for it (see package sms)
+	err = m.App.SMSNotifier.Reservation(reservation, "confirmation", emailData)
+	if err != nil {
+		logging.FromRequest(r).Error("can't send confirmation sms", "reservation_id", reservation.ID, "error", err)
 	}
 
-	//Pass message to channel. This will send email in background (asyncronically)
-	m.App.MailChan <- msg
+	// 3) Let the staff know about new reservation
+	m.notifyStaff(r, reservation.RoomType.Property, models.EventNewReservation, map[string]interface{}{
+		"Reservation": reservation,
+		"Link":        m.adminLink(fmt.Sprintf("/admin/reservations/new/%d", newReservationID)),
+	})
 
-	//--SENDING EMAIL NOTIFICATIONS ENDS HERE---------------------------
+	//--WORK WITH DB ENDS HERE-------------------------------------
 
 	//----This is the "happy path" when form is valid
 	// We use session for exchangind data between two pages
@@ -318,48 +502,100 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 
 // Avaialbility renders the search-avaialibility page
 func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.html", &models.TemplateData{})
+
+	//Guests choose property (select is shown only when there are several of them)
+	properties, err := m.DB.AllProperties(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["properties"] = properties
+
+	renderPage(w, r, "search-availability.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// searchProperty returns property chosen in search form ("property_id"), the first one when form has none
+func (m *Repository) searchProperty(r *http.Request) (models.Property, error) {
+	properties, err := m.DB.AllProperties(r.Context())
+	if err != nil {
+		return models.Property{}, err
+	}
+
+	//Old links and forms without the select search the first property
+	if r.Form.Get("property_id") == "" && len(properties) > 0 {
+		return properties[0], nil
+	}
+
+	id, _ := strconv.Atoi(r.Form.Get("property_id"))
+
+	for _, p := range properties {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+
+	return models.Property{}, apperr.NewValidation("No such property", nil)
 }
 
 // PostAvaialbility handles the posted data from search-avaialibility page
 // It get the data and trore them in variables
 func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 
+	//Parse form first (NoSurf does it for us, but we shouldn't rely on it)
+	err := r.ParseForm()
+	if err != nil {
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
+		return
+	}
+
 	//These are data sent from form. They come in string type, need to convert to time.Time
 	start_date := r.Form.Get(("start_date"))
 	end_date := r.Form.Get(("end_date"))
 
-	//format I'm getting my dates in from the form
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, start_date)
+	//Dates come as "2006-01-02", they are days of the property (see package property)
+	startDate, err := property.ParseDate(start_date)
 	if err != nil {
 		//show error to browser
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewValidation("Invalid arrival date", err))
+		return
 	}
-	endDate, err := time.Parse(layout, end_date)
+	endDate, err := property.ParseDate(end_date)
 	if err != nil {
 		//show error to browser
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewValidation("Invalid departure date", err))
+		return
+	}
+
+	//Rooms of which property
+	prop, err := m.searchProperty(r)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
 	}
 
-	//Call my database function
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	//Guests book type of room: search which types have free rooms for every night
+	roomTypes, err := m.DB.SearchAvailabilityForRoomTypes(r.Context(), prop.ID, startDate, endDate)
 	if err != nil {
 		//show error to browser
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	for _, i := range rooms {
-		m.App.InfoLog.Println("ROOM:", i.ID, i.RoomName)
+	logging.FromRequest(r).Debug("room types available", "room_types", len(roomTypes))
 
-	}
+	metrics.Searches.WithLabelValues("all_rooms").Inc()
 
 	//check if any room is avaialble
-	if len(rooms) == 0 {
+	if len(roomTypes) == 0 {
+		metrics.EmptySearches.WithLabelValues("all_rooms").Inc()
+
 		//this is logic for no rooms avaialble
 		//Generate error message when no rooms available
-		m.App.Session.Put(r.Context(), "error-msg", "No rooms avalable for these dates")
+		m.App.Session.Put(r.Context(), "error-msg", i18n.T(i18n.FromContext(r.Context()), "No rooms available for these dates"))
 
 		//redirect to the same page
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
@@ -369,7 +605,8 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 
 	//Prepare date to pass available rooms ot tempalte
 	data := make(map[string]interface{})
-	data["rooms"] = rooms
+	data["room_types"] = roomTypes
+	data["property"] = prop
 
 	// We want to store data about startData, endDate and pass it in th session
 	// We will use it for Make Reservation page as default data
@@ -384,7 +621,7 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	// It wil be available when we get to "Make reservation" page
 	m.App.Session.Put(r.Context(), "reservation", res)
 
-	render.Template(w, r, "rooms.page.html", &models.TemplateData{
+	renderPage(w, r, "rooms.page.html", &models.TemplateData{
 		Data: data,
 	})
 
@@ -392,52 +629,69 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 
 //This is struct for our JSON data to use for AJAX to check room avaialability
 type jsonResponce struct {
-	OK        bool   `json:"ok"`
-	Message   string `json:"message"`
-	RoomID    string `json:"room_id"`
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
+	OK         bool   `json:"ok"`
+	Message    string `json:"message"`
+	RoomTypeID string `json:"room_type_id"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
 }
 
 // AvailabilityJSON handles request for availability and sends JSON responce (via AJAX)
 func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
+	//Parse form first (NoSurf does it for us, but we shouldn't rely on it)
+	err := r.ParseForm()
+	if err != nil {
+		jsonError(w, r, apperr.NewValidation("Can't read the form", err))
+		return
+	}
+
 	//Get start and end dates from the form and convert to time.Time format
 	sd := r.Form.Get("start")
 	ed := r.Form.Get("end")
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	roomTypeID, _ := strconv.Atoi(r.Form.Get("room_type_id"))
 
-	//format I'm getting my dates in from the form
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, sd)
+	//Dates come as "2006-01-02", they are days of the property (see package property)
+	startDate, err := property.ParseDate(sd)
 	if err != nil {
-		//show error to browser
-		helpers.ServerError(w, err)
+		//show error to browser (page script reads JSON)
+		jsonError(w, r, apperr.NewValidation("Invalid arrival date", err))
+		return
 	}
-	endDate, err := time.Parse(layout, ed)
+	endDate, err := property.ParseDate(ed)
 	if err != nil {
-		//show error to browser
-		helpers.ServerError(w, err)
+		//show error to browser (page script reads JSON)
+		jsonError(w, r, apperr.NewValidation("Invalid departure date", err))
+		return
 	}
 
-	//Check for availability by room id (use custom function SearchAvailabilityByDatesByRoomID)
+	//Check for availability by room type (use custom function SearchAvailabilityByDatesByRoomTypeID)
 	//It returns boolean value and error
-	avaialable, _ := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	avaialable, err := m.DB.SearchAvailabilityByDatesByRoomTypeID(r.Context(), startDate, endDate, roomTypeID)
+	if err != nil {
+		jsonError(w, r, err)
+		return
+	}
+
+	metrics.Searches.WithLabelValues("room").Inc()
+	if !avaialable {
+		metrics.EmptySearches.WithLabelValues("room").Inc()
+	}
 
 	//set default JSON responce
 	resp := jsonResponce{
-		OK:        avaialable,
-		Message:   "",
-		RoomID:    strconv.Itoa(roomID),
-		StartDate: sd,
-		EndDate:   ed,
+		OK:         avaialable,
+		Message:    "",
+		RoomTypeID: strconv.Itoa(roomTypeID),
+		StartDate:  sd,
+		EndDate:    ed,
 	}
 
 	//Marshal my struct to JSON
 	out, err := json.MarshalIndent(resp, "", "     ")
 	if err != nil {
 		//Use our custom built ServerError helper
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -448,19 +702,72 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	w.Write(out)
 }
 
+// jsonError answers AJAX request with error in the format of jsonResponce (page scripts read "ok" and "message")
+// Status code comes from kind of err (see package apperr)
+func jsonError(w http.ResponseWriter, r *http.Request, err error) {
+	status := apperr.Status(err)
+
+	if status >= http.StatusInternalServerError {
+		logging.FromRequest(r).Error("server error", "error", err)
+	} else {
+		logging.FromRequest(r).Info("client error", "status", status, "error", err)
+	}
+
+	out, _ := json.MarshalIndent(jsonResponce{OK: false, Message: apperr.Message(err)}, "", "     ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
 // Generals renders the generals page
 func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "generals.page.html", &models.TemplateData{})
+	renderPage(w, r, "generals.page.html", &models.TemplateData{})
 }
 
 // Majors renders the major page
 func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "majors.page.html", &models.TemplateData{})
+	renderPage(w, r, "majors.page.html", &models.TemplateData{})
 }
 
 // Contact renders the contact page
 func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "contact.page.html", &models.TemplateData{})
+	renderPage(w, r, "contact.page.html", &models.TemplateData{})
+}
+
+// Language switches language of pages (language menu), choice is kept in session for the next pages
+// Guest goes back to the page they were on
+func (m *Repository) Language(w http.ResponseWriter, r *http.Request) {
+	locale := chi.URLParam(r, "locale")
+
+	if !i18n.Supported(locale) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "locale", locale)
+
+	http.Redirect(w, r, backTo(r), http.StatusSeeOther)
+}
+
+// backTo returns path of the page from Referer header when it is our own page, "/" otherwise
+// (only path is used, so it can't redirect to other site)
+func backTo(r *http.Request) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host != r.Host || !strings.HasPrefix(ref.Path, "/") || strings.HasPrefix(ref.Path, "//") {
+		return "/"
+	}
+
+	if strings.HasPrefix(ref.Path, "/language/") {
+		return "/"
+	}
+
+	back := ref.Path
+	if ref.RawQuery != "" {
+		back += "?" + ref.RawQuery
+	}
+
+	return back
 }
 
 // ReservationSummary renders the reservation-summary page
@@ -471,9 +778,9 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 	//This is to show when page open without data from form
 	//It might happend when user went to page "reservation-summary" not from page with form
 	if !ok {
-		m.App.ErrorLog.Println("Can't get error from session")
+		logging.FromRequest(r).Warn("can't get reservation from session")
 		//Put some message to the session
-		m.App.Session.Put(r.Context(), "error-msg", "Can't get reservation from session")
+		m.App.Session.Put(r.Context(), "error-msg", i18n.T(i18n.FromContext(r.Context()), "Can't get reservation from session"))
 
 		//Now redirect to hope page with redirect status 307
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -499,34 +806,34 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
 
-	render.Template(w, r, "reservation-summary.page.html", &models.TemplateData{
+	renderPage(w, r, "reservation-summary.page.html", &models.TemplateData{
 		Data:      data,      //this is to pass reservation model
 		StringMap: stringMap, //this is to pass my start nad end dates
 	})
 }
 
-// ChooseRoom displays list of avaialble rooms
+// ChooseRoom takes type of room guest chose from the list of avaialble ones
 func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 
-	//Read room id from the URL and store as variable
+	//Read room type id from the URL and store as variable
 	//We use build-in chi method URLParam
-	RoomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	roomTypeID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		//show error to browser
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewNotFound("No such room", err))
 		return
 	}
 
 	//Get my reservation from session and put into variable, convert to string
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, errors.New("cannot get reservation data from session"))
 		return
 	}
 
-	res.RoomID = RoomID
+	res.RoomTypeID = roomTypeID
 
-	//Now my variable res has three values, start and End date and room it
+	//Now my variable res has three values, start and End date and room type
 	//I'm adding it back to session
 	m.App.Session.Put(r.Context(), "reservation", res)
 
@@ -539,8 +846,8 @@ func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 // and redirect to reservation page)
 func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 
-	//Grab the parameters from URL (id, "s" for start date, "e" for end date)
-	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	//Grab the parameters from URL (id of room type, "s" for start date, "e" for end date)
+	roomTypeID, _ := strconv.Atoi(r.URL.Query().Get("id"))
 	sd := r.URL.Query().Get("sd")
 	ed := r.URL.Query().Get("ed")
 
@@ -548,32 +855,33 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 
 	var res models.Reservation
 
-	//format my dates from URL paramaters
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, sd)
+	//Dates come as "2006-01-02", they are days of the property (see package property)
+	startDate, err := property.ParseDate(sd)
 	if err != nil {
 		//show error to browser
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewValidation("Invalid arrival date", err))
+		return
 	}
-	endDate, err := time.Parse(layout, ed)
+	endDate, err := property.ParseDate(ed)
 	if err != nil {
 		//show error to browser
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewValidation("Invalid departure date", err))
+		return
 	}
 
-	//Get my room details using custom func GetRoomByID
-	room, err := m.DB.GetRoomByID(roomID)
+	//Get my room type details using custom func GetRoomTypeByID
+	roomType, err := m.DB.GetRoomTypeByID(r.Context(), roomTypeID)
 	if err != nil {
 		//Use our custom built ServerError helper
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, err)
 		return
 	}
 
-	//Store room details in my res variable (which represent model Reservation)
-	res.RoomID = roomID
+	//Store room type details in my res variable (which represent model Reservation)
+	res.RoomTypeID = roomTypeID
 	res.StartDate = startDate
 	res.EndDate = endDate
-	res.Room.RoomName = room.RoomName
+	res.RoomType = roomType
 
 	//Put res (model) to session to pass to next page
 	m.App.Session.Put(r.Context(), "reservation", res)
@@ -581,18 +889,138 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	//Redirect to Reservation page a
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 
-	log.Println(roomID, startDate, endDate)
-
 }
 
 //---------------HANDLERS FOR ADMIN-------------------------------------
+
+// PropertyScope is middleware of admin area: it puts properties of the logged in user to the context
+// (see property.Scope). Current property is the one chosen in property switcher, the first one otherwise
+// It must go after SessionLoad and Auth
+func (m *Repository) PropertyScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//Auth sends visitors to login page before this, without login nobody manages any property
+		userID := m.App.Session.GetInt(r.Context(), "user_id")
+		if userID == 0 {
+			helpers.Error(w, r, apperr.NewForbidden("Log in first", nil))
+			return
+		}
+
+		properties, err := m.DB.PropertiesForUser(r.Context(), userID)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		if len(properties) == 0 {
+			helpers.Error(w, r, apperr.NewForbidden("You are not staff of any property, ask administrator to add you", nil))
+			return
+		}
+
+		scope := property.Scope{Current: properties[0], Properties: properties}
+
+		current := m.App.Session.GetInt(r.Context(), "property_id")
+		for _, p := range properties {
+			if p.ID == current {
+				scope.Current = p
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(property.WithScope(r.Context(), scope)))
+	})
+}
+
+// scopedMail returns message from outbox by id when it is about one of the properties of the user
+func (m *Repository) scopedMail(r *http.Request, id int) (models.MailMessage, error) {
+	msg, err := m.DB.GetMailByID(r.Context(), id)
+	if err != nil {
+		return msg, err
+	}
+
+	if !property.FromContext(r.Context()).Has(msg.MailData.PropertyID) {
+		return msg, apperr.NewForbidden("Email is about other property", nil)
+	}
+
+	return msg, nil
+}
+
+// scopedUser checks that user with id is staff of one of the properties of the current user
+func (m *Repository) scopedUser(r *http.Request, id int) error {
+	properties, err := m.DB.PropertiesForUser(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	scope := property.FromContext(r.Context())
+	for _, p := range properties {
+		if scope.Has(p.ID) {
+			return nil
+		}
+	}
+
+	return apperr.NewForbidden("User is staff of other property", nil)
+}
+
+// requireAdmin checks that logged in user has admin access level
+func (m *Repository) requireAdmin(r *http.Request) error {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if userID == 0 {
+		return apperr.NewForbidden("Log in first", nil)
+	}
+
+	u, err := m.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	if u.AccessLevel < models.AccessLevelAdmin {
+		return apperr.NewForbidden("Only administrator can do this", nil)
+	}
+
+	return nil
+}
+
+// scopedReservation returns reservation by id when it belongs to one of the properties of the user
+func (m *Repository) scopedReservation(r *http.Request, id int) (models.Reservation, error) {
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		return res, err
+	}
+
+	if !property.FromContext(r.Context()).Has(res.RoomType.PropertyID) {
+		return res, apperr.NewForbidden("Reservation belongs to other property", nil)
+	}
+
+	return res, nil
+}
+
+// AdminSwitchProperty makes property current for admin pages (property switcher in the menu)
+// User goes back to the page they were on
+func (m *Repository) AdminSwitchProperty(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || !property.FromContext(r.Context()).Has(id) {
+		helpers.Error(w, r, apperr.NewNotFound("No such property", err))
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "property_id", id)
+
+	//Lists and calendar show the other property now, but single reservation still belongs to the old one
+	back := backTo(r)
+	if !strings.HasPrefix(back, "/admin/") || strings.HasPrefix(back, "/admin/reservations/") {
+		back = "/admin/dashboard"
+	}
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
 // AdminDashboard handles admin dashboard page
 func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 
-	//get all reservations from DB
-	reservations, err := m.DB.AllReservations()
+	//get all reservations of current property from DB
+	reservations, err := m.DB.AllReservations(r.Context(), property.FromContext(r.Context()).Current.ID)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 
 	}
@@ -603,7 +1031,7 @@ func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 	//Asign key to my reservations data
 	data["reservations"] = reservations
 
-	render.Template(w, r, "reservations-all.page.html", &models.TemplateData{
+	renderPage(w, r, "reservations-all.page.html", &models.TemplateData{
 		Data: data,
 	})
 
@@ -612,10 +1040,10 @@ func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 // AdminNewReservations handles admin area - new reservation list
 func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
 
-	//get all reservations from DB
-	reservations, err := m.DB.NewReservations()
+	//get new reservations of current property from DB
+	reservations, err := m.DB.NewReservations(r.Context(), property.FromContext(r.Context()).Current.ID)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 
 	}
@@ -626,7 +1054,7 @@ func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request
 	//Asign key to my reservations data
 	data["reservations"] = reservations
 
-	render.Template(w, r, "reservations-all.page.html", &models.TemplateData{
+	renderPage(w, r, "reservations-all.page.html", &models.TemplateData{
 		Data: data,
 	})
 }
@@ -634,10 +1062,10 @@ func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request
 // AdminAllReservations handles admin area - all reservations list
 func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
 
-	//get all reservations from DB
-	reservations, err := m.DB.AllReservations()
+	//get all reservations of current property from DB
+	reservations, err := m.DB.AllReservations(r.Context(), property.FromContext(r.Context()).Current.ID)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 
 	}
@@ -648,7 +1076,7 @@ func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request
 	//Asign key to my reservations data
 	data["reservations"] = reservations
 
-	render.Template(w, r, "reservations-all.page.html", &models.TemplateData{
+	renderPage(w, r, "reservations-all.page.html", &models.TemplateData{
 		Data: data,
 	})
 
@@ -665,7 +1093,7 @@ func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request
 	//Get the ID from URL
 	id, err := strconv.Atoi(explodedURL[4])
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewNotFound("No such reservation", err))
 		return
 	}
 
@@ -677,17 +1105,30 @@ func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request
 	stringMap["src"] = src
 
 	//get reservation from database
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.scopedReservation(r, id)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	//Rooms staff can assign (free rooms of the booked type)
+	rooms, err := m.DB.FreeRoomsForReservation(r.Context(), res)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
+	//Check-in and check-out times are shown in time zone of the property
+	loc := m.App.Clock.For(res.RoomType.Property).Location()
+	res.CheckedInAt = res.CheckedInAt.In(loc)
+	res.CheckedOutAt = res.CheckedOutAt.In(loc)
+
 	//Build the the map to hold model "reservation"
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["rooms"] = rooms
 
-	render.Template(w, r, "admin-reservation.page.html", &models.TemplateData{
+	renderPage(w, r, "admin-reservation.page.html", &models.TemplateData{
 		StringMap: stringMap,
 		Data:      data,
 		Form:      forms.New(nil),
@@ -698,8 +1139,12 @@ func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request
 // AdminCalendar displays reservation calendar
 func (m *Repository) AdminCalendar(w http.ResponseWriter, r *http.Request) {
 
+	//Calendar of the property chosen in property switcher
+	current := property.FromContext(r.Context()).Current
+
 	//Assume that there is no year or month specify in URL (show current year and current month)
-	now := time.Now()
+	//Current month is the one of the property, server may be in other time zone
+	now := m.App.Clock.For(current).Today()
 
 	//Check if there is parameters in URL for dates ( e.g. ?y=2021&m=6)
 	//if parameters exists make the year and month from url param string
@@ -754,10 +1199,10 @@ func (m *Repository) AdminCalendar(w http.ResponseWriter, r *http.Request) {
 	intMap := make(map[string]int)
 	intMap["days_in_month"] = lastOfMonth.Day()
 
-	//Get all rooms "(pass as models)
-	rooms, err := m.DB.GetAllRooms()
+	//Get all rooms of the property "(pass as models)
+	rooms, err := m.DB.GetRoomsByProperty(r.Context(), current.ID)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 
 	}
@@ -785,9 +1230,9 @@ func (m *Repository) AdminCalendar(w http.ResponseWriter, r *http.Request) {
 		}
 
 		//now get all restictions of each room (mark the rooms that has a reservations)
-		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), x.ID, firstOfMonth, lastOfMonth)
 		if err != nil {
-			helpers.ServerError(w, err)
+			helpers.ServerError(w, r, err)
 			return
 		}
 
@@ -816,26 +1261,147 @@ func (m *Repository) AdminCalendar(w http.ResponseWriter, r *http.Request) {
 
 	}
 
-	render.Template(w, r, "admin-calendar.page.html", &models.TemplateData{
-		StringMap: stringMap,
-		IntMap:    intMap,
-		Data:      data,
-	})
+	//Bookings that have no room yet: how many of each room type stay each night, and the list of them
+	unassigned, err := m.DB.UnassignedReservations(r.Context(), current.ID, firstOfMonth, lastOfMonth)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-}
+	roomTypes, err := m.DB.GetRoomTypesByProperty(r.Context(), current.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-// AdminShowReservation shows single reservation details
-func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+	for _, rt := range roomTypes {
+		unassignedMap := make(map[string]int)
 
-	//get room id and source page from URL (r.RequestURI)
-	//my URLL wil look like "/admin/reservations/all/6", so I want to split it
+		for _, res := range unassigned {
+			if res.RoomTypeID != rt.ID {
+				continue
+			}
+
+			//Day of departure is not a night of the stay
+			for d := res.StartDate; d.Before(res.EndDate); d = d.AddDate(0, 0, 1) {
+				unassignedMap[d.Format("2006-01-2")]++
+			}
+		}
+
+		data[fmt.Sprintf("unassigned_map_%d", rt.ID)] = unassignedMap
+	}
+
+	data["room_types"] = roomTypes
+	data["unassigned"] = unassigned
+
+	renderPage(w, r, "admin-calendar.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Data:      data,
+	})
+
+}
+
+// AdminPostCalendar saves owner blocks from calendar (checkboxes "add_block_{room}_{date}" and "remove_block_{room}_{date}")
+func (m *Repository) AdminPostCalendar(w http.ResponseWriter, r *http.Request) {
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
+		return
+	}
+
+	year := r.Form.Get("y")
+	month := r.Form.Get("m")
+
+	//Calendar shows rooms of current property (see AdminCalendar)
+	current := property.FromContext(r.Context()).Current
+
+	rooms, err := m.DB.GetRoomsByProperty(r.Context(), current.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	//Collect changes for staff notification
+	var added, removed []models.RoomRestriction
+
+	//Days that can't be blocked (room is taken or the type is fully booked), other changes are still saved
+	var refused []string
+
+	for _, room := range rooms {
+
+		//Blocks that were shown on the page (see AdminCalendar), unchecked ones are removed
+		blockMap, _ := m.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", room.ID)).(map[string]int)
+
+		for date, blockID := range blockMap {
+			if blockID > 0 && !r.Form.Has(fmt.Sprintf("remove_block_%d_%s", room.ID, date)) {
+				err = m.DB.DeleteBlockByID(r.Context(), blockID)
+				if err != nil {
+					helpers.ServerError(w, r, err)
+					return
+				}
+
+				day, _ := time.Parse("2006-01-2", date)
+				removed = append(removed, models.RoomRestriction{ID: blockID, RoomID: room.ID, Room: room, StartDate: day})
+			}
+		}
+
+		//Newly checked days
+		prefix := fmt.Sprintf("add_block_%d_", room.ID)
+		for name := range r.PostForm {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+
+			day, err := time.Parse("2006-01-2", strings.TrimPrefix(name, prefix))
+			if err != nil {
+				helpers.Error(w, r, apperr.NewValidation("Invalid date of block", err))
+				return
+			}
+
+			err = m.DB.InsertBlockForRoom(r.Context(), room.ID, day)
+			if apperr.KindOf(err) == apperr.Conflict {
+				refused = append(refused, fmt.Sprintf("%s %s: %s", room.RoomName, day.Format(property.DateLayout), apperr.Message(err)))
+				continue
+			}
+			if err != nil {
+				helpers.ServerError(w, r, err)
+				return
+			}
+
+			added = append(added, models.RoomRestriction{RoomID: room.ID, Room: room, StartDate: day})
+		}
+	}
+
+	if len(added) > 0 || len(removed) > 0 {
+		m.notifyStaff(r, current, models.EventBlocked, map[string]interface{}{
+			"Added":   added,
+			"Removed": removed,
+			"Link":    m.adminLink(fmt.Sprintf("/admin/reservation-calendar?y=%s&m=%s", year, month)),
+		})
+	}
+
+	if len(refused) > 0 {
+		m.App.Session.Put(r.Context(), "error-msg", "Not blocked: "+strings.Join(refused, "; "))
+	} else {
+		m.App.Session.Put(r.Context(), "flash-msg", "Changes saved")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservation-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+}
+
+// AdminShowReservation shows single reservation details
+func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+
+	//get room id and source page from URL (r.RequestURI)
+	//my URLL wil look like "/admin/reservations/all/6", so I want to split it
 	//You can split by position - in our case id is in position 4
 	explodedURL := strings.Split(r.RequestURI, "/")
 
 	//Get the ID from URL
 	id, err := strconv.Atoi(explodedURL[4])
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewNotFound("No such reservation", err))
 		return
 	}
 
@@ -847,7 +1413,11 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 	stringMap["src"] = src
 
 	//Save changes from form
-	m.saveReservationDetails(id, w, r)
+	err = m.saveReservationDetails(id, r)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
 
 	//redirect to the original page (either "all" or "new")
 	m.App.Session.Put(r.Context(), "flash", "Reservation updated")
@@ -855,13 +1425,296 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 
 }
 
+// AdminPostAssignRoom gives reservation the room chosen by staff (or moves it to another one)
+func (m *Repository) AdminPostAssignRoom(w http.ResponseWriter, r *http.Request) {
+
+	//Get the ID from URL
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.Error(w, r, apperr.NewNotFound("No such reservation", err))
+		return
+	}
+
+	//Get the source from URL
+	src := chi.URLParam(r, "src")
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
+		return
+	}
+
+	//Only reservations of user's properties can get rooms
+	_, err = m.scopedReservation(r, id)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+
+	//Room may be taken since the page was shown, staff picks another one
+	err = m.DB.AssignRoom(r.Context(), id, roomID)
+	switch apperr.KindOf(err) {
+	case apperr.Conflict, apperr.Validation:
+		m.App.Session.Put(r.Context(), "error-msg", apperr.Message(err))
+	default:
+		if err != nil {
+			helpers.Error(w, r, err)
+			return
+		}
+
+		m.App.Session.Put(r.Context(), "flash-msg", "Room assigned")
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", src, id), http.StatusSeeOther)
+}
+
+// AdminFrontDesk shows guests arriving, staying and leaving today (day of the property) with check-in
+// and check-out buttons
+func (m *Repository) AdminFrontDesk(w http.ResponseWriter, r *http.Request) {
+
+	current := property.FromContext(r.Context()).Current
+	clock := m.App.Clock.For(current)
+	today := clock.Today()
+
+	reservations, err := m.DB.FrontDeskReservations(r.Context(), current.ID, today)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	var arrivals, staying, departures []models.Reservation
+
+	for _, res := range reservations {
+		//Times of check-in and check-out are shown in time zone of the property
+		res.CheckedInAt = res.CheckedInAt.In(clock.Location())
+		res.CheckedOutAt = res.CheckedOutAt.In(clock.Location())
+
+		switch {
+		case res.CheckedInAt.IsZero() && res.EndDate.After(today):
+			//Arrives today, or late and still expected
+			arrivals = append(arrivals, res)
+		case !res.EndDate.After(today):
+			//Leaves today, or stayed over departure and isn't checked out yet
+			departures = append(departures, res)
+		case res.CheckedOutAt.IsZero():
+			//Checked in and stays tonight (can leave early)
+			staying = append(staying, res)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["today"] = today
+	data["arrivals"] = arrivals
+	data["staying"] = staying
+	data["departures"] = departures
+
+	renderPage(w, r, "admin-front-desk.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostCheckIn checks guest in (time of the property) and saves arrival notes
+func (m *Repository) AdminPostCheckIn(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.frontDeskReservation(w, r)
+	if !ok {
+		return
+	}
+
+	clock := m.App.Clock.For(res.RoomType.Property)
+
+	err := m.DB.CheckIn(r.Context(), res.ID, clock.Now(), clock.Today(), strings.TrimSpace(r.Form.Get("arrival_notes")))
+	if !m.frontDeskResult(w, r, err) {
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash-msg", fmt.Sprintf("%s %s checked in", res.FirstName, res.LastName))
+	http.Redirect(w, r, "/admin/front-desk", http.StatusSeeOther)
+}
+
+// AdminPostCheckOut checks guest out (time of the property), guest leaving before departure day frees the rest of the stay
+func (m *Repository) AdminPostCheckOut(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.frontDeskReservation(w, r)
+	if !ok {
+		return
+	}
+
+	clock := m.App.Clock.For(res.RoomType.Property)
+
+	departure, err := m.DB.CheckOut(r.Context(), res.ID, clock.Now(), clock.Today())
+	if !m.frontDeskResult(w, r, err) {
+		return
+	}
+
+	msg := fmt.Sprintf("%s %s checked out", res.FirstName, res.LastName)
+	if departure.Before(res.EndDate) {
+		msg += fmt.Sprintf(", departure moved to %s", render.HumaneDate(departure))
+	}
+
+	m.App.Session.Put(r.Context(), "flash-msg", msg)
+	http.Redirect(w, r, "/admin/front-desk", http.StatusSeeOther)
+}
+
+// frontDeskReservation reads the form and returns reservation from URL ("id") when it is in user's properties
+// It answers the request itself when it returns false
+func (m *Repository) frontDeskReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.Error(w, r, apperr.NewNotFound("No such reservation", err))
+		return models.Reservation{}, false
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
+		return models.Reservation{}, false
+	}
+
+	res, err := m.scopedReservation(r, id)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return models.Reservation{}, false
+	}
+
+	return res, true
+}
+
+// frontDeskResult shows why check-in or check-out was refused (e.g. no room yet) on front desk page
+// It answers the request itself when it returns false
+func (m *Repository) frontDeskResult(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch apperr.KindOf(err) {
+	case apperr.Conflict, apperr.Validation:
+		m.App.Session.Put(r.Context(), "error-msg", apperr.Message(err))
+		http.Redirect(w, r, "/admin/front-desk", http.StatusSeeOther)
+		return false
+	}
+
+	if err != nil {
+		helpers.Error(w, r, err)
+		return false
+	}
+
+	return true
+}
+
+// housekeepingLabels are names of housekeeping statuses on the board
+var housekeepingLabels = map[string]string{
+	models.RoomDirty:      "Dirty",
+	models.RoomCleaning:   "Cleaning",
+	models.RoomClean:      "Clean",
+	models.RoomInspected:  "Inspected",
+	models.RoomOutOfOrder: "Out of order",
+}
+
+// AdminHousekeeping shows housekeeping status of every room of the property and what is to be done today
+// Rooms where guests leave come first (a guest may arrive to the same room), then rooms where guests stay
+func (m *Repository) AdminHousekeeping(w http.ResponseWriter, r *http.Request) {
+
+	current := property.FromContext(r.Context()).Current
+	clock := m.App.Clock.For(current)
+	today := clock.Today()
+
+	tasks, err := m.DB.HousekeepingBoard(r.Context(), current.ID, today)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	//Order of the daily task list, rooms with nothing to do go last
+	priority := func(t models.HousekeepingTask) int {
+		switch {
+		case t.Departure && t.Arrival:
+			return 0
+		case t.Departure:
+			return 1
+		case t.Stayover:
+			return 2
+		}
+		return 3
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return priority(tasks[i]) < priority(tasks[j]) })
+
+	counts := make(map[string]int)
+	for i := range tasks {
+		counts[tasks[i].Room.Housekeeping]++
+
+		//Time of the last change is shown in time zone of the property
+		tasks[i].Room.HousekeepingAt = tasks[i].Room.HousekeepingAt.In(clock.Location())
+	}
+
+	data := make(map[string]interface{})
+	data["today"] = today
+	data["tasks"] = tasks
+	data["counts"] = counts
+	data["statuses"] = models.RoomStatuses
+	data["labels"] = housekeepingLabels
+
+	renderPage(w, r, "admin-housekeeping.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostHousekeeping changes housekeeping status of the room (e.g. cleaned, inspected, out of order)
+func (m *Repository) AdminPostHousekeeping(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.Error(w, r, apperr.NewNotFound("No such room", err))
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
+		return
+	}
+
+	status := r.Form.Get("status")
+	if _, ok := housekeepingLabels[status]; !ok {
+		m.App.Session.Put(r.Context(), "error-msg", "Unknown housekeeping status")
+		http.Redirect(w, r, "/admin/housekeeping", http.StatusSeeOther)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperr.NewNotFound("No such room", err)
+		}
+		helpers.Error(w, r, err)
+		return
+	}
+
+	//Only rooms of user's properties can be changed
+	if !property.FromContext(r.Context()).Has(room.PropertyID) {
+		helpers.Error(w, r, apperr.NewForbidden("Room belongs to other property", nil))
+		return
+	}
+
+	err = m.DB.UpdateRoomHousekeeping(r.Context(), room.ID, status, m.App.Clock.For(room.Property).Today())
+	if apperr.KindOf(err) == apperr.Conflict {
+		m.App.Session.Put(r.Context(), "error-msg", apperr.Message(err))
+		http.Redirect(w, r, "/admin/housekeeping", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash-msg", fmt.Sprintf("%s: %s", room.RoomName, housekeepingLabels[status]))
+	http.Redirect(w, r, "/admin/housekeeping", http.StatusSeeOther)
+}
+
 // AdminProcessReservation marks reservation as processed (change status "processed = 1")
 func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
 
 	//Get the ID from URL
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewNotFound("No such reservation", err))
 		return
 	}
 
@@ -871,10 +1724,17 @@ func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Requ
 	//m.saveReservationDetails(id, w, r)
 	//This doesn't work becase can't see the form
 
+	//Only reservations of user's properties can be processed
+	_, err = m.scopedReservation(r, id)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
 	//Now call DB function UpdateProcessedForReservation()
-	err = m.DB.UpdateProcessedForReservation(id, 1)
+	err = m.DB.UpdateProcessedForReservation(r.Context(), id, 1)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -889,39 +1749,53 @@ func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Reque
 	//Get the ID from URL
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.Error(w, r, apperr.NewNotFound("No such reservation", err))
 		return
 	}
 
 	//Get the source from URL
 	src := chi.URLParam(r, "src")
 
+	//Keep reservation details for cancellation email
+	res, err := m.scopedReservation(r, id)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
 	//Now call DB function UpdateProcessedForReservation()
-	err = m.DB.DeleteReservation(id)
+	err = m.DB.DeleteReservation(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
+	//Let the guest and the staff know (mail is sent in background)
+	m.sendReservationEmail(r, res, "cancellation")
+	m.notifyStaff(r, res.RoomType.Property, models.EventCancelled, map[string]interface{}{
+		"Reservation": res,
+		"Link":        m.adminLink(fmt.Sprintf("/admin/reservation-calendar?y=%s&m=%s", res.StartDate.Format("2006"), res.StartDate.Format("01"))),
+	})
+
 	//Inform customer and redirect to all reservation (based on src)
 	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 }
 
 // saveReservationDetails updates reservation from form (use in two places above)
-func (m *Repository) saveReservationDetails(id int, w http.ResponseWriter, r *http.Request) {
+// Caller sends error page when it fails
+func (m *Repository) saveReservationDetails(id int, r *http.Request) error {
 
 	//Parse form
 	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		return apperr.NewValidation("Can't read the form", err)
 	}
 
 	//Get the reservatiom we want to update by ID (from URL)
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.scopedReservation(r, id)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
 	//Now update my modle from what is in the form
@@ -930,12 +1804,585 @@ func (m *Repository) saveReservationDetails(id int, w http.ResponseWriter, r *ht
 	res.Email = r.Form.Get("email")
 	res.Phone = r.Form.Get("phone")
 
-	log.Println("HEEREEE:", r.Form.Get("first_name"))
-
 	//Now update table in database
-	err = m.DB.UpdateReservation(res)
+	err = m.DB.UpdateReservation(r.Context(), res)
+	if err != nil {
+		return err
+	}
+
+	//Let the guest and the staff know (mail is sent in background)
+	m.sendReservationEmail(r, res, "modification")
+	m.notifyStaff(r, res.RoomType.Property, models.EventModified, map[string]interface{}{
+		"Reservation": res,
+		"Link":        m.adminLink(fmt.Sprintf("/admin/reservations/new/%d", res.ID)),
+	})
+
+	return nil
+}
+
+// sendReservationEmail sends email from template to the guest of reservation through MailChan
+// Email problems are only logged, the change of reservation is already saved
+func (m *Repository) sendReservationEmail(r *http.Request, res models.Reservation, name string) {
+	msg, err := emails.Message(res.Email, name, map[string]interface{}{"Reservation": res, "Locale": res.Locale, "Property": res.RoomType.Property})
+	if err != nil {
+		logging.FromRequest(r).Error("can't build email", "template", name, "error", err)
+		return
+	}
+
+	m.App.MailChan <- msg
+}
+
+// notifyStaff emails about the event (see models.Event* constants) in property p to staff from configuration
+// and to users of the property who subscribed to it. Template is "staff-" + event, emails go through MailChan
+func (m *Repository) notifyStaff(r *http.Request, p models.Property, event string, data map[string]interface{}) {
+
+	//Emails show which property it is about
+	data["Property"] = p
+
+	//Everybody gets only one email, even if listed in config and subscribed
+	var recipients []string
+	seen := make(map[string]bool)
+
+	add := func(email string) {
+		key := strings.ToLower(email)
+		if email != "" && !seen[key] {
+			seen[key] = true
+			recipients = append(recipients, email)
+		}
+	}
+
+	for _, email := range m.App.Notify.Recipients {
+		add(email)
+	}
+
+	users, err := m.DB.UsersToNotify(r.Context(), p.ID, event)
+	if err != nil {
+		logging.FromRequest(r).Error("can't get users to notify", "event", event, "error", err)
+	}
+
+	for _, u := range users {
+		add(u.Email)
+	}
+
+	for _, to := range recipients {
+		msg, err := emails.Message(to, "staff-"+event, data)
+		if err != nil {
+			logging.FromRequest(r).Error("can't build email", "template", "staff-"+event, "error", err)
+			return
+		}
+
+		m.App.MailChan <- msg
+	}
+}
+
+// adminLink returns full URL of admin page for emails
+func (m *Repository) adminLink(path string) string {
+	return strings.TrimSuffix(m.App.Server.URL, "/") + path
+}
+
+// AdminSessions lists active sessions of staff of the current property
+func (m *Repository) AdminSessions(w http.ResponseWriter, r *http.Request) {
+
+	//IP addresses and browsers of staff are for administrator only
+	err := m.requireAdmin(r)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	sessions, err := m.DB.AllUserSessions(r.Context(), property.FromContext(r.Context()).Current.ID)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
+
+	//Find which one is the session of the current user (we don't show tokens on the page)
+	intMap := make(map[string]int)
+	currentToken := m.App.Session.Token(r.Context())
+	for _, s := range sessions {
+		if s.Token == currentToken {
+			intMap["current_session"] = s.ID
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["sessions"] = sessions
+
+	renderPage(w, r, "admin-sessions.page.html", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+	})
+}
+
+// AdminRevokeSession logs out the session (of staff of user's properties) by deleting it from session store
+func (m *Repository) AdminRevokeSession(w http.ResponseWriter, r *http.Request) {
+
+	err := m.requireAdmin(r)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	//Get the ID from URL
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.Error(w, r, apperr.NewNotFound("No such session", err))
+		return
+	}
+
+	us, err := m.DB.GetUserSessionByID(r.Context(), id)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	//Only sessions of staff of user's properties can be revoked
+	err = m.scopedUser(r, us.UserID)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	revokingSelf := us.Token == m.App.Session.Token(r.Context())
+
+	//Deleting from the store is what actually logs the user out
+	err = m.App.Session.Store.Delete(us.Token)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	err = m.DB.DeleteUserSession(r.Context(), us.Token)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	//Our own session is gone, start over from login page
+	if revokingSelf {
+		_ = m.App.Session.Destroy(r.Context())
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash-msg", "Session revoked")
+	http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
+
+// AdminMail lists messages about the current property from mail outbox, use ?status=dead to see failed ones
+func (m *Repository) AdminMail(w http.ResponseWriter, r *http.Request) {
+
+	status := r.URL.Query().Get("status")
+
+	messages, err := m.DB.AllMail(r.Context(), property.FromContext(r.Context()).Current.ID, status)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["messages"] = messages
+
+	stringMap := make(map[string]string)
+	stringMap["status"] = status
+
+	renderPage(w, r, "admin-mail.page.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminShowMail shows single message from outbox with its content and last error
+func (m *Repository) AdminShowMail(w http.ResponseWriter, r *http.Request) {
+
+	//Get the ID from URL
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.Error(w, r, apperr.NewNotFound("No such email", err))
+		return
+	}
+
+	msg, err := m.scopedMail(r, id)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["message"] = msg
+
+	renderPage(w, r, "admin-mail-show.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminResendMail puts message back to outbox queue, mail workers will try it again
+func (m *Repository) AdminResendMail(w http.ResponseWriter, r *http.Request) {
+
+	//Get the ID from URL
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.Error(w, r, apperr.NewNotFound("No such email", err))
+		return
+	}
+
+	//Make sure message exists and is about one of user's properties
+	_, err = m.scopedMail(r, id)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	err = m.DB.ResendMail(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash-msg", "Email is queued for sending")
+	http.Redirect(w, r, fmt.Sprintf("/admin/mail/%d", id), http.StatusSeeOther)
+}
+
+// AdminNotifications shows which emails the logged in user gets about reservations
+func (m *Repository) AdminNotifications(w http.ResponseWriter, r *http.Request) {
+
+	u, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["user"] = u
+
+	renderPage(w, r, "admin-notifications.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+// AdminPostNotifications saves notification preferences of the logged in user
+func (m *Repository) AdminPostNotifications(w http.ResponseWriter, r *http.Request) {
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
+		return
+	}
+
+	//Unchecked checkboxes are not posted at all
+	n := models.Notifications{
+		New:       r.Form.Has(models.EventNewReservation),
+		Modified:  r.Form.Has(models.EventModified),
+		Cancelled: r.Form.Has(models.EventCancelled),
+		Blocked:   r.Form.Has(models.EventBlocked),
+	}
+
+	err = m.DB.UpdateUserNotifications(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"), n)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash-msg", "Notifications saved")
+	http.Redirect(w, r, "/admin/notifications", http.StatusSeeOther)
+}
+
+// AdminProperty shows settings and staff of current property
+func (m *Repository) AdminProperty(w http.ResponseWriter, r *http.Request) {
+
+	current := property.FromContext(r.Context()).Current
+
+	users, err := m.DB.UsersForProperty(r.Context(), current.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.renderProperty(w, r, current, users, forms.New(nil))
+}
+
+// AdminPostProperty saves settings of current property
+func (m *Repository) AdminPostProperty(w http.ResponseWriter, r *http.Request) {
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
+		return
+	}
+
+	p, form := m.propertyFromForm(r)
+	p.ID = property.FromContext(r.Context()).Current.ID
+
+	if !form.Valid() {
+		users, err := m.DB.UsersForProperty(r.Context(), p.ID)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		m.renderProperty(w, r, p, users, form)
+		return
+	}
+
+	err = m.DB.UpdateProperty(r.Context(), p)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash-msg", "Property saved")
+	http.Redirect(w, r, "/admin/property", http.StatusSeeOther)
+}
+
+// AdminNewProperty shows empty settings form for new property
+func (m *Repository) AdminNewProperty(w http.ResponseWriter, r *http.Request) {
+	err := m.requireAdmin(r)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	m.renderProperty(w, r, models.Property{}, nil, forms.New(nil))
+}
+
+// AdminPostNewProperty adds property, the user becomes its staff and it becomes current
+func (m *Repository) AdminPostNewProperty(w http.ResponseWriter, r *http.Request) {
+
+	err := m.requireAdmin(r)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
+		return
+	}
+
+	p, form := m.propertyFromForm(r)
+
+	if !form.Valid() {
+		m.renderProperty(w, r, p, nil, form)
+		return
+	}
+
+	id, err := m.DB.InsertProperty(r.Context(), p, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "property_id", id)
+	m.App.Session.Put(r.Context(), "flash-msg", "Property added")
+	http.Redirect(w, r, "/admin/property", http.StatusSeeOther)
+}
+
+// AdminPostPropertyStaff adds existing user (by email) to staff of current property
+func (m *Repository) AdminPostPropertyStaff(w http.ResponseWriter, r *http.Request) {
+
+	err := m.requireAdmin(r)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.Error(w, r, apperr.NewValidation("Can't read the form", err))
+		return
+	}
+
+	u, err := m.DB.GetUserByEmail(r.Context(), strings.TrimSpace(r.Form.Get("email")))
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error-msg", "No user with this email, they must log in once first")
+		http.Redirect(w, r, "/admin/property", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	err = m.DB.AddUserToProperty(r.Context(), u.ID, property.FromContext(r.Context()).Current.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash-msg", "Staff added")
+	http.Redirect(w, r, "/admin/property", http.StatusSeeOther)
+}
+
+// propertyFromForm reads property settings from posted form and checks them
+func (m *Repository) propertyFromForm(r *http.Request) (models.Property, *forms.Form) {
+
+	p := models.Property{
+		Name:         strings.TrimSpace(r.Form.Get("name")),
+		ContactEmail: strings.TrimSpace(r.Form.Get("contact_email")),
+		TimeZone:     strings.TrimSpace(r.Form.Get("time_zone")),
+		CheckIn:      strings.TrimSpace(r.Form.Get("check_in")),
+		CheckOut:     strings.TrimSpace(r.Form.Get("check_out")),
+		LogoURL:      strings.TrimSpace(r.Form.Get("logo_url")),
+		BrandColor:   strings.TrimSpace(r.Form.Get("brand_color")),
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+
+	if p.ContactEmail != "" {
+		form.IsEmail("contact_email")
+	}
+
+	//Empty time zone and times are the ones from configuration
+	_, err := property.NewClock(property.Merge(p, m.App.Property))
+	if err != nil {
+		form.Errors.Add("time_zone", err.Error())
+	}
+
+	if p.LogoURL != "" && !strings.HasPrefix(p.LogoURL, "https://") && !strings.HasPrefix(p.LogoURL, "http://") {
+		form.Errors.Add("logo_url", "Logo must be a link starting with https://")
+	}
+
+	if p.BrandColor != "" && !brandColor.MatchString(p.BrandColor) {
+		form.Errors.Add("brand_color", "Color must look like #2c3e50")
+	}
+
+	return p, form
+}
+
+// brandColor is the format of property color
+var brandColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// renderProperty renders settings form of property p (new property has no ID)
+func (m *Repository) renderProperty(w http.ResponseWriter, r *http.Request, p models.Property, users []models.User, form *forms.Form) {
+
+	data := make(map[string]interface{})
+	data["property"] = p
+	data["users"] = users
+
+	//Placeholders show settings from configuration, they are used when fields are empty
+	stringMap := make(map[string]string)
+	stringMap["time_zone"] = m.App.Property.TimeZone
+	stringMap["check_in"] = m.App.Property.CheckIn
+	stringMap["check_out"] = m.App.Property.CheckOut
+
+	renderPage(w, r, "admin-property.page.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminDevMail lists emails about the current property caught in development (nothing is sent when not in production)
+func (m *Repository) AdminDevMail(w http.ResponseWriter, r *http.Request) {
+
+	//Mail catcher works only in development
+	if m.App.MailCatcher == nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	current := property.FromContext(r.Context()).Current
+
+	var messages []mailer.Caught
+	for _, msg := range m.App.MailCatcher.All() {
+		if msg.MailData.PropertyID == current.ID {
+			messages = append(messages, msg)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["messages"] = messages
+
+	renderPage(w, r, "admin-dev-mail.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowDevMail shows caught email: rendered HTML, plain text, headers and raw source
+func (m *Repository) AdminShowDevMail(w http.ResponseWriter, r *http.Request) {
+
+	msg, ok := m.caughtMail(w, r)
+	if !ok {
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["message"] = msg
+
+	renderPage(w, r, "admin-dev-mail-show.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminDevMailHTML returns HTML part of caught email as is, page shows it in sandboxed iframe
+func (m *Repository) AdminDevMailHTML(w http.ResponseWriter, r *http.Request) {
+
+	msg, ok := m.caughtMail(w, r)
+	if !ok {
+		return
+	}
+
+	//Email must not run scripts or submit forms in our admin area
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(msg.MailData.Content))
+}
+
+// AdminClearDevMail drops all caught emails
+func (m *Repository) AdminClearDevMail(w http.ResponseWriter, r *http.Request) {
+
+	if m.App.MailCatcher == nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	//Emails about every property are deleted, not only the ones the user sees
+	err := m.requireAdmin(r)
+	if err != nil {
+		helpers.Error(w, r, err)
+		return
+	}
+
+	m.App.MailCatcher.Clear()
+
+	m.App.Session.Put(r.Context(), "flash-msg", "Caught emails deleted")
+	http.Redirect(w, r, "/admin/dev/mail", http.StatusSeeOther)
+}
+
+// caughtMail finds caught email by ID from URL, writes Not Found when there is no such email
+func (m *Repository) caughtMail(w http.ResponseWriter, r *http.Request) (mailer.Caught, bool) {
+
+	if m.App.MailCatcher == nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return mailer.Caught{}, false
+	}
+
+	//Get the ID from URL
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return mailer.Caught{}, false
+	}
+
+	msg, err := m.App.MailCatcher.Get(id)
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return mailer.Caught{}, false
+	}
+
+	//Staff see only emails about their properties
+	if !property.FromContext(r.Context()).Has(msg.MailData.PropertyID) {
+		helpers.Error(w, r, apperr.NewForbidden("Email is about other property", nil))
+		return mailer.Caught{}, false
+	}
+
+	return msg, true
+}
+
+// NotFound renders 404 page for URLs that don't match any route
+func (m *Repository) NotFound(w http.ResponseWriter, r *http.Request) {
+	helpers.ClientError(w, r, http.StatusNotFound)
 }
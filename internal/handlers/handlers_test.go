@@ -1,10 +1,25 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/victorluk72/booking/internal/logging"
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/sms"
+	"github.com/victorluk72/booking/internal/sso"
+	"github.com/victorluk72/booking/internal/sso/ssotest"
 )
 
 // Create data structure to hold data that we are posting from form
@@ -32,11 +47,39 @@ var theTests = []struct {
 	{"sa", "/search-availability", "GET", []postData{}, http.StatusOK},
 	{"mr", "/make-reservation", "GET", []postData{}, http.StatusOK},
 	{"rs", "/reservation-summary", "GET", []postData{}, http.StatusOK},
+	{"login", "/user/login", "GET", []postData{}, http.StatusOK},
+	{"sso-disabled", "/user/login/sso", "GET", []postData{}, http.StatusNotFound},
+	{"sessions", "/admin/sessions", "GET", []postData{}, http.StatusOK},
+	{"revoke-session", "/admin/revoke-session/1", "POST", []postData{}, http.StatusOK},
+	{"revoke-unknown-session", "/admin/revoke-session/5", "POST", []postData{}, http.StatusNotFound},
+	{"revoke-bad-session-id", "/admin/revoke-session/abc", "POST", []postData{}, http.StatusNotFound},
+	{"notifications", "/admin/notifications", "GET", []postData{}, http.StatusOK},
+	{"delete-reservation", "/admin/delete-reservation/new/1", "GET", []postData{}, http.StatusOK},
+	{"show-reservation", "/admin/reservations/new/1", "GET", []postData{}, http.StatusOK},
+	{"process-reservation", "/admin/process-reservation/new/1", "GET", []postData{}, http.StatusOK},
+	{"switch-property", "/admin/switch-property/1", "GET", []postData{}, http.StatusOK},
+	{"switch-unknown-property", "/admin/switch-property/9", "GET", []postData{}, http.StatusNotFound},
+	{"property", "/admin/property", "GET", []postData{}, http.StatusOK},
+	{"new-property", "/admin/properties/new", "GET", []postData{}, http.StatusOK},
+	{"front-desk", "/admin/front-desk", "GET", []postData{}, http.StatusOK},
+	{"housekeeping", "/admin/housekeeping", "GET", []postData{}, http.StatusOK},
+	{"mail", "/admin/mail", "GET", []postData{}, http.StatusOK},
+	{"dead-mail", "/admin/mail?status=dead", "GET", []postData{}, http.StatusOK},
+	{"show-mail", "/admin/mail/1", "GET", []postData{}, http.StatusOK},
+	{"show-unknown-mail", "/admin/mail/5", "GET", []postData{}, http.StatusNotFound},
+	{"resend-mail", "/admin/resend-mail/1", "POST", []postData{}, http.StatusOK},
+	{"resend-unknown-mail", "/admin/resend-mail/5", "POST", []postData{}, http.StatusNotFound},
+	{"dev-mail", "/admin/dev/mail", "GET", []postData{}, http.StatusOK},
+	{"show-dev-mail", "/admin/dev/mail/1", "GET", []postData{}, http.StatusOK},
+	{"dev-mail-html", "/admin/dev/mail/1/html", "GET", []postData{}, http.StatusOK},
+	{"show-unknown-dev-mail", "/admin/dev/mail/5", "GET", []postData{}, http.StatusNotFound},
+	{"unknown-page", "/no-such-page", "GET", []postData{}, http.StatusNotFound},
+	{"book-room-bad-dates", "/book-room?id=1&sd=tomorrow&ed=2020-01-06", "GET", []postData{}, http.StatusBadRequest},
 
 	//These are settings for POST URLs
 	{"post-search-avail", "/search-availability", "POST", []postData{
-		{key: "start", value: "2020-01-01"},
-		{key: "end", value: "2020-01-06"},
+		{key: "start_date", value: "2020-01-01"},
+		{key: "end_date", value: "2020-01-06"},
 	}, http.StatusOK},
 
 	{"post-search-avail-json", "/search-availability-json", "POST", []postData{
@@ -44,12 +87,67 @@ var theTests = []struct {
 		{key: "end", value: "2020-01-06"},
 	}, http.StatusOK},
 
+	//Bad dates stop the handler with 400 (it used to go on with zero dates)
+	{"post-search-avail-bad-date", "/search-availability", "POST", []postData{
+		{key: "start_date", value: "2020-13-01"},
+		{key: "end_date", value: "2020-01-06"},
+	}, http.StatusBadRequest},
+
+	{"post-search-avail-json-bad-date", "/search-availability-json", "POST", []postData{
+		{key: "start", value: "2020-01-01"},
+		{key: "end", value: "soon"},
+	}, http.StatusBadRequest},
+
 	{"post-make-res", "/make-reservation", "POST", []postData{
 		{key: "first_name", value: "Tom"},
 		{key: "last_name", value: "Hanks"},
 		{key: "email", value: "tom@hanks.com"},
 		{key: "phone", value: "455555555"},
 	}, http.StatusOK},
+
+	{"post-notifications", "/admin/notifications", "POST", []postData{
+		{key: "new", value: "on"},
+		{key: "blocked", value: "on"},
+	}, http.StatusOK},
+
+	{"post-calendar", "/admin/reservation-calendar", "POST", []postData{
+		{key: "y", value: "2050"},
+		{key: "m", value: "01"},
+		{key: "add_block_1_2050-01-5", value: "on"},
+	}, http.StatusOK},
+
+	{"post-property", "/admin/property", "POST", []postData{
+		{key: "name", value: "Fort Smythe"},
+		{key: "time_zone", value: "Europe/Paris"},
+		{key: "brand_color", value: "#2c3e50"},
+	}, http.StatusOK},
+
+	{"post-new-property", "/admin/properties/new", "POST", []postData{
+		{key: "name", value: "Harbour View"},
+		{key: "contact_email", value: "stay@harbour.ca"},
+	}, http.StatusOK},
+
+	{"post-property-staff", "/admin/property/staff", "POST", []postData{
+		{key: "email", value: "me@here.ca"},
+	}, http.StatusOK},
+
+	{"post-admin-res", "/admin/reservations/new/1", "POST", []postData{
+		{key: "first_name", value: "Tom"},
+		{key: "last_name", value: "Hanks"},
+		{key: "email", value: "tom@hanks.com"},
+		{key: "phone", value: "455555555"},
+	}, http.StatusOK},
+
+	{"post-assign-room", "/admin/reservations/new/1/assign", "POST", []postData{
+		{key: "room_id", value: "1"},
+	}, http.StatusOK},
+	{"post-check-in", "/admin/front-desk/check-in/1", "POST", []postData{
+		{key: "arrival_notes", value: "Late arrival"},
+	}, http.StatusOK},
+	{"post-check-out", "/admin/front-desk/check-out/4", "POST", []postData{}, http.StatusOK},
+	{"post-housekeeping", "/admin/housekeeping/1", "POST", []postData{
+		{key: "status", value: "clean"},
+	}, http.StatusOK},
 }
 
 // The function for test itself
@@ -67,13 +165,17 @@ func TestHandlers(t *testing.T) {
 	//Now run thre the range of my slice of structs theTests
 	for _, e := range theTests {
 
+		//Every test starts with guest who has chosen the room (reservation is in the session)
+		client := ts.Client()
+		client.Jar = reservationJar(t, ts.URL)
+
 		//make different tests for GET and POST methods
 		if e.method == "GET" {
 
 			//Do stuff for GET method
 			//We need to act as a client (browser) and send request to server
 			//Return response and error
-			resp, err := ts.Client().Get(ts.URL + e.url)
+			resp, err := client.Get(ts.URL + e.url)
 			if err != nil {
 				t.Log(err)
 				t.Fatal(err)
@@ -97,7 +199,7 @@ func TestHandlers(t *testing.T) {
 			}
 
 			//Run the client and get a response from Post form
-			resp, err := ts.Client().PostForm(ts.URL+e.url, values)
+			resp, err := client.PostForm(ts.URL+e.url, values)
 			if err != nil {
 				t.Log(err)
 				t.Fatal(err)
@@ -114,3 +216,802 @@ func TestHandlers(t *testing.T) {
 	}
 
 }
+
+// reservationJar returns cookies of new session with reservation in it, the way search and choice of room leave it
+func reservationJar(t *testing.T, serverURL string) http.CookieJar {
+	ctx, err := app.Session.Load(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.Session.Put(ctx, "reservation", models.Reservation{
+		RoomTypeID: 1,
+		StartDate:  time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+	})
+
+	token, _, err := app.Session.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jar, _ := cookiejar.New(nil)
+	u, _ := url.Parse(serverURL)
+	jar.SetCookies(u, []*http.Cookie{{Name: app.Session.Cookie.Name, Value: token, Path: "/"}})
+
+	return jar
+}
+
+// Test for single sign-on: we use local mock provider instead of real one
+var ssoTests = []struct {
+	name         string
+	user         ssotest.User
+	expectedPath string //where user ends up after all redirects
+}{
+	{"existing-user", ssotest.User{Subject: "1", Email: "me@here.ca", EmailVerified: true}, "/"},
+	{"new-user", ssotest.User{Subject: "2", Email: "new@here.ca", EmailVerified: true, FirstName: "New"}, "/"},
+	{"unverified-email", ssotest.User{Subject: "3", Email: "me@here.ca", EmailVerified: false}, "/user/login"},
+}
+
+func TestSSOLogin(t *testing.T) {
+
+	routes := getRoutes()
+
+	ts := httptest.NewTLSServer(routes)
+	defer ts.Close()
+
+	//Switch sso off again when done, other tests expect it disabled
+	defer func() { app.SSO = nil }()
+
+	for _, e := range ssoTests {
+
+		mock := ssotest.NewProvider(e.user)
+
+		provider, err := sso.New(context.Background(), sso.Config{
+			IssuerURL:          mock.URL,
+			ClientID:           ssotest.ClientID,
+			ClientSecret:       ssotest.ClientSecret,
+			RedirectURL:        ts.URL + "/user/login/sso/callback",
+			DefaultAccessLevel: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.SSO = provider
+
+		//We need cookies to keep the session between redirects
+		jar, _ := cookiejar.New(nil)
+		client := ts.Client()
+		client.Jar = jar
+
+		resp, err := client.Get(ts.URL + "/user/login/sso")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("for %s, expected %d but got %d", e.name, http.StatusOK, resp.StatusCode)
+		}
+
+		if resp.Request.URL.Path != e.expectedPath {
+			t.Errorf("for %s, expected to end up at %s but got %s", e.name, e.expectedPath, resp.Request.URL.Path)
+		}
+
+		mock.Close()
+	}
+}
+
+func TestSSOCallbackWrongState(t *testing.T) {
+
+	routes := getRoutes()
+
+	ts := httptest.NewTLSServer(routes)
+	defer ts.Close()
+
+	mock := ssotest.NewProvider(ssotest.User{Subject: "1", Email: "me@here.ca", EmailVerified: true})
+	defer mock.Close()
+
+	provider, err := sso.New(context.Background(), sso.Config{
+		IssuerURL:    mock.URL,
+		ClientID:     ssotest.ClientID,
+		ClientSecret: ssotest.ClientSecret,
+		RedirectURL:  ts.URL + "/user/login/sso/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SSO = provider
+	defer func() { app.SSO = nil }()
+
+	//Callback without login started first must not log anybody in
+	resp, err := ts.Client().Get(ts.URL + "/user/login/sso/callback?code=x&state=y")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Request.URL.Path != "/user/login" {
+		t.Errorf("expected redirect to /user/login but got %s", resp.Request.URL.Path)
+	}
+}
+
+func TestNotifyStaff(t *testing.T) {
+
+	//Take emails from our own channel
+	mailChan := make(chan models.MailData, 10)
+	oldChan := app.MailChan
+	app.MailChan = mailChan
+	app.Notify.Recipients = []string{"owner@here.ca", "ME@here.ca"}
+	defer func() {
+		app.MailChan = oldChan
+		app.Notify.Recipients = nil
+	}()
+
+	res := models.Reservation{ID: 7, FirstName: "Tom", LastName: "Hanks", RoomType: models.RoomType{Name: "Major's Suite"}}
+
+	//me@here.ca is in config and subscribed (see test repository) - only one email to this address
+	Ripo.notifyStaff(httptest.NewRequest("POST", "/make-reservation", nil), models.Property{ID: 1, Name: "Fort Smythe Bed and Breakfast"}, models.EventNewReservation, map[string]interface{}{
+		"Reservation": res,
+		"Link":        Ripo.adminLink("/admin/reservations/new/7"),
+	})
+	close(mailChan)
+
+	var to []string
+	for msg := range mailChan {
+		to = append(to, msg.To)
+
+		if !strings.Contains(msg.Text, "/admin/reservations/new/7") {
+			t.Errorf("link is missing in email:\n%s", msg.Text)
+		}
+	}
+
+	if strings.Join(to, ",") != "owner@here.ca,ME@here.ca" {
+		t.Errorf("unexpected recipients %v", to)
+	}
+}
+
+func TestDevMailInProduction(t *testing.T) {
+
+	routes := getRoutes()
+
+	ts := httptest.NewTLSServer(routes)
+	defer ts.Close()
+
+	//In production there is no mail catcher
+	catcher := app.MailCatcher
+	app.MailCatcher = nil
+	defer func() { app.MailCatcher = catcher }()
+
+	for _, path := range []string{"/admin/dev/mail", "/admin/dev/mail/1", "/admin/dev/mail/1/html"} {
+		resp, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected %d but got %d", path, http.StatusNotFound, resp.StatusCode)
+		}
+	}
+
+	resp, err := ts.Client().PostForm(ts.URL+"/admin/dev/clear-mail", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("clear mail: expected %d but got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestMissingTemplate(t *testing.T) {
+
+	routes := getRoutes()
+
+	//Page template is missing (e.g. not built into binary), browser must get our 500 page, not empty 200
+	home := app.TemplateCache["home.page.html"]
+	delete(app.TemplateCache, "home.page.html")
+	defer func() { app.TemplateCache["home.page.html"] = home }()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(body, "Something went wrong") ||
+		!strings.Contains(body, "home.page.html") {
+		t.Errorf("unexpected page for missing template (%d):\n%s", rr.Code, body)
+	}
+}
+
+func TestPostReservationSMS(t *testing.T) {
+
+	//Make sure app is set up (see setup_test.go)
+	getRoutes()
+
+	templates, err := sms.NewTemplates(app.Assets.SMSTemplates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	smsChan := make(chan models.SMSData, 10)
+	app.SMSNotifier = sms.NewNotifier(templates, smsChan)
+	defer func() { app.SMSNotifier = nil }()
+
+	var tests = []struct {
+		name               string
+		phone              string
+		optIn              bool
+		expectedStatusCode int
+		expectedTo         string
+	}{
+		{"opt-in", "+1 (555) 123-4567", true, http.StatusSeeOther, "+15551234567"},
+		{"no-opt-in", "+1 (555) 123-4567", false, http.StatusSeeOther, ""},
+		{"opt-in-bad-phone", "call me", true, http.StatusOK, ""},
+	}
+
+	for _, e := range tests {
+		form := url.Values{}
+		form.Add("first_name", "Tom")
+		form.Add("last_name", "Hanks")
+		form.Add("email", "tom@hanks.com")
+		form.Add("phone", e.phone)
+		if e.optIn {
+			form.Add("sms_opt_in", "on")
+		}
+
+		req := httptest.NewRequest("POST", "/make-reservation", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		//Reservation with dates and room type is already in the session (see ChooseRoom)
+		ctx, _ := app.Session.Load(req.Context(), "")
+		req = req.WithContext(ctx)
+		app.Session.Put(ctx, "reservation", models.Reservation{
+			RoomTypeID: 1,
+			RoomType:   models.RoomType{ID: 1, Name: "General's Quarters"},
+			StartDate:  time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:    time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+		})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Ripo.PostReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		select {
+		case msg := <-smsChan:
+			if msg.To != e.expectedTo || !strings.Contains(msg.Body, "General's Quarters") {
+				t.Errorf("%s: unexpected SMS %+v", e.name, msg)
+			}
+		default:
+			if e.expectedTo != "" {
+				t.Errorf("%s: SMS was not sent", e.name)
+			}
+		}
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+
+	routes := getRoutes()
+
+	ts := httptest.NewTLSServer(routes)
+	defer ts.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	//Our 404 page, not the plain text one
+	code, body := get("/admin/mail/5")
+	if code != http.StatusNotFound || !strings.Contains(body, "Page not found") {
+		t.Errorf("unexpected 404 page (%d):\n%s", code, body)
+	}
+
+	//Message of typed error is shown
+	resp, err := ts.Client().PostForm(ts.URL+"/admin/revoke-session/abc", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	code, body = resp.StatusCode, string(b)
+	if code != http.StatusNotFound || !strings.Contains(body, "No such session") {
+		t.Errorf("unexpected 404 page (%d):\n%s", code, body)
+	}
+
+	//In development 500 page shows the error and the stack
+	code, body = get("/make-reservation")
+	if code != http.StatusInternalServerError || !strings.Contains(body, "Something went wrong") ||
+		!strings.Contains(body, "cannot get reservation data from session") || !strings.Contains(body, "goroutine") {
+		t.Errorf("unexpected 500 page in development (%d):\n%s", code, body)
+	}
+
+	//In production details stay in the log
+	app.InProduction = true
+	defer func() { app.InProduction = false }()
+
+	code, body = get("/make-reservation")
+	if code != http.StatusInternalServerError || strings.Contains(body, "cannot get reservation data") || strings.Contains(body, "goroutine") {
+		t.Errorf("500 page in production shows details (%d):\n%s", code, body)
+	}
+}
+
+func TestAvailabilityJSONError(t *testing.T) {
+
+	routes := getRoutes()
+
+	reqBody := "start=2020-01-01&end=soon"
+	req := httptest.NewRequest("POST", "/search-availability-json", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	var resp jsonResponce
+	err := json.Unmarshal(rr.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("response is not JSON: %s", rr.Body.String())
+	}
+
+	if rr.Code != http.StatusBadRequest || resp.OK || resp.Message != "Invalid departure date" {
+		t.Errorf("unexpected response %d %+v", rr.Code, resp)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+
+	routes := getRoutes()
+
+	ts := httptest.NewTLSServer(routes)
+	defer ts.Close()
+
+	get := func(client *http.Client, path string, header http.Header) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	//Language of the browser
+	resp, body := get(ts.Client(), "/about", http.Header{"Accept-Language": {"fr-CA,fr;q=0.9,en;q=0.8"}})
+	if resp.Header.Get("Content-Language") != "fr" || !strings.Contains(body, `lang="fr"`) || !strings.Contains(body, "Ceci est la page À propos") {
+		t.Errorf("expected french page for french browser:\n%s", body)
+	}
+
+	//Language we don't have
+	resp, body = get(ts.Client(), "/about", http.Header{"Accept-Language": {"de"}})
+	if resp.Header.Get("Content-Language") != "en" || !strings.Contains(body, "This is the about page") {
+		t.Errorf("expected english page for german browser:\n%s", body)
+	}
+
+	//Choice from language menu wins over browser and guest goes back to their page
+	jar, _ := cookiejar.New(nil)
+	client := ts.Client()
+	client.Jar = jar
+
+	resp, _ = get(client, "/language/fr", http.Header{"Referer": {ts.URL + "/about?x=1"}})
+	if resp.Request.URL.RequestURI() != "/about?x=1" {
+		t.Errorf("expected redirect back to /about?x=1 but got %s", resp.Request.URL.RequestURI())
+	}
+
+	_, body = get(client, "/about", http.Header{"Accept-Language": {"en"}})
+	if !strings.Contains(body, "Ceci est la page À propos") {
+		t.Errorf("expected french page after choosing french:\n%s", body)
+	}
+
+	//Referer of other site is not followed
+	resp, _ = get(client, "/language/en", http.Header{"Referer": {"https://example.com/about"}})
+	if resp.Request.URL.RequestURI() != "/" {
+		t.Errorf("expected redirect to home page but got %s", resp.Request.URL.RequestURI())
+	}
+
+	resp, _ = get(client, "/language/xx", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown language but got %d", resp.StatusCode)
+	}
+}
+
+func TestPropertyScope(t *testing.T) {
+
+	//Make sure app is set up (see setup_test.go)
+	getRoutes()
+
+	var tests = []struct {
+		name               string
+		path               string
+		handler            http.HandlerFunc
+		expectedStatusCode int
+	}{
+		{"own-reservation", "/admin/reservations/all/1", Ripo.AdminShowReservation, http.StatusOK},
+		{"other-property-reservation", "/admin/reservations/all/3", Ripo.AdminShowReservation, http.StatusForbidden},
+		{"delete-other-property-reservation", "/admin/delete-reservation/all/3", Ripo.AdminDeleteReservation, http.StatusForbidden},
+		{"assign-room-other-property-reservation", "/admin/reservations/all/3", Ripo.AdminPostAssignRoom, http.StatusForbidden},
+		{"switch-to-own-property", "/admin/switch-property/1", Ripo.AdminSwitchProperty, http.StatusSeeOther},
+		{"switch-to-other-property", "/admin/switch-property/2", Ripo.AdminSwitchProperty, http.StatusNotFound},
+		{"own-property-mail", "/admin/mail/1", Ripo.AdminShowMail, http.StatusOK},
+		{"other-property-mail", "/admin/mail/3", Ripo.AdminShowMail, http.StatusForbidden},
+		{"resend-other-property-mail", "/admin/resend-mail/3", Ripo.AdminResendMail, http.StatusForbidden},
+		{"own-property-dev-mail", "/admin/dev/mail/1", Ripo.AdminShowDevMail, http.StatusOK},
+		{"other-property-dev-mail", "/admin/dev/mail/2", Ripo.AdminShowDevMail, http.StatusForbidden},
+		{"other-property-dev-mail-html", "/admin/dev/mail/2", Ripo.AdminDevMailHTML, http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.path, nil)
+
+		//Logged in user manages only property 1 (see test repository)
+		ctx, _ := app.Session.Load(req.Context(), "")
+		app.Session.Put(ctx, "user_id", 1)
+
+		//URL parameters as chi sets them
+		parts := strings.Split(e.path, "/")
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", parts[len(parts)-1])
+		rctx.URLParams.Add("src", "all")
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+
+		rr := httptest.NewRecorder()
+		Ripo.PropertyScope(e.handler).ServeHTTP(rr, req.WithContext(ctx))
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+
+	//Caught emails about other property are not listed
+	req := httptest.NewRequest("GET", "/admin/dev/mail", nil)
+	ctx, _ := app.Session.Load(req.Context(), "")
+	app.Session.Put(ctx, "user_id", 1)
+
+	rr := httptest.NewRecorder()
+	Ripo.PropertyScope(http.HandlerFunc(Ripo.AdminDevMail)).ServeHTTP(rr, req.WithContext(ctx))
+
+	if !strings.Contains(rr.Body.String(), "Test") || strings.Contains(rr.Body.String(), "Other property") {
+		t.Errorf("dev mail page: expected only emails about own property")
+	}
+
+	//Nobody logged in manages no property
+	req = httptest.NewRequest("GET", "/admin/mail", nil)
+	ctx, _ = app.Session.Load(req.Context(), "")
+
+	rr = httptest.NewRecorder()
+	Ripo.PropertyScope(http.HandlerFunc(Ripo.AdminMail)).ServeHTTP(rr, req.WithContext(ctx))
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("anonymous mail page: expected %d but got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+
+	//Make sure app is set up (see setup_test.go)
+	getRoutes()
+
+	var tests = []struct {
+		name               string
+		method             string
+		path               string
+		body               string
+		handler            http.HandlerFunc
+		userID             int
+		expectedStatusCode int
+	}{
+		{"staff-new-property-form", "GET", "/admin/properties/new", "", Ripo.AdminNewProperty, 1, http.StatusForbidden},
+		{"staff-new-property", "POST", "/admin/properties/new", "name=Harbour+View&contact_email=info%40harbour.ca", Ripo.AdminPostNewProperty, 1, http.StatusForbidden},
+		{"staff-property-staff", "POST", "/admin/property/staff", "email=me%40here.ca", Ripo.AdminPostPropertyStaff, 1, http.StatusForbidden},
+		{"admin-property-staff", "POST", "/admin/property/staff", "email=me%40here.ca", Ripo.AdminPostPropertyStaff, 3, http.StatusSeeOther},
+		{"staff-sessions", "GET", "/admin/sessions", "", Ripo.AdminSessions, 1, http.StatusForbidden},
+		{"staff-revoke-session", "POST", "/admin/revoke-session/1", "", Ripo.AdminRevokeSession, 1, http.StatusForbidden},
+		{"admin-sessions", "GET", "/admin/sessions", "", Ripo.AdminSessions, 3, http.StatusOK},
+		{"admin-revoke-other-property-session", "POST", "/admin/revoke-session/3", "", Ripo.AdminRevokeSession, 3, http.StatusForbidden},
+		{"staff-clear-dev-mail", "POST", "/admin/dev/clear-mail", "", Ripo.AdminClearDevMail, 1, http.StatusForbidden},
+		{"anonymous-new-property", "POST", "/admin/properties/new", "name=Harbour+View&contact_email=info%40harbour.ca", Ripo.AdminPostNewProperty, 0, http.StatusForbidden},
+		{"anonymous-property-staff", "POST", "/admin/property/staff", "email=me%40here.ca", Ripo.AdminPostPropertyStaff, 0, http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, e.path, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		//User 3 is administrator, user 1 is normal staff (see test repository), 0 is nobody
+		ctx, _ := app.Session.Load(req.Context(), "")
+		if e.userID != 0 {
+			app.Session.Put(ctx, "user_id", e.userID)
+		}
+
+		//URL parameter as chi sets it
+		parts := strings.Split(e.path, "/")
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", parts[len(parts)-1])
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+
+		//Anonymous visitor is stopped by the handler itself, not only by PropertyScope
+		handler := Ripo.PropertyScope(e.handler)
+		if e.userID == 0 {
+			handler = e.handler
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req.WithContext(ctx))
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestPostPropertyValidation(t *testing.T) {
+
+	routes := getRoutes()
+
+	var tests = []struct {
+		name     string
+		field    string
+		value    string
+		expected string //error on the page, empty when property is saved
+	}{
+		{"valid", "time_zone", "Europe/Paris", ""},
+		{"unknown-time-zone", "time_zone", "Mars/Olympus", "Mars/Olympus"},
+		{"bad-check-in", "check_in", "3pm", "expected time of the day"},
+		{"bad-color", "brand_color", "red", "Color must look like"},
+		{"bad-logo", "logo_url", "javascript:alert(1)", "Logo must be a link"},
+		{"bad-email", "contact_email", "stay@", "Invalid email address"},
+		{"no-name", "name", "", "This field can&#39;t be blank"},
+	}
+
+	for _, e := range tests {
+		form := url.Values{}
+		form.Set("name", "Fort Smythe")
+		form.Set(e.field, e.value)
+
+		req := httptest.NewRequest("POST", "/admin/property", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if e.expected == "" {
+			if rr.Code != http.StatusSeeOther {
+				t.Errorf("%s: expected %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+			}
+			continue
+		}
+
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), e.expected) {
+			t.Errorf("%s: expected form with %q, got %d:\n%s", e.name, e.expected, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestAssignRoom(t *testing.T) {
+
+	routes := getRoutes()
+
+	var tests = []struct {
+		name     string
+		roomID   string
+		expected string //message in session
+		msgKey   string
+	}{
+		{"room-of-booked-type", "1", "Room assigned", "flash-msg"},
+		{"room-of-other-type", "2", "Room is not of the booked type", "error-msg"},
+	}
+
+	for _, e := range tests {
+		form := url.Values{}
+		form.Set("room_id", e.roomID)
+
+		req := httptest.NewRequest("POST", "/admin/reservations/all/1/assign", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		ctx, _ := app.Session.Load(req.Context(), "")
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/reservations/all/1" {
+			t.Errorf("%s: expected redirect to reservation but got %d %q", e.name, rr.Code, rr.Header().Get("Location"))
+		}
+
+		if msg := app.Session.GetString(ctx, e.msgKey); msg != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, msg)
+		}
+	}
+}
+
+func TestFrontDesk(t *testing.T) {
+
+	routes := getRoutes()
+
+	var tests = []struct {
+		name     string
+		path     string
+		expected string //message in session
+		msgKey   string
+	}{
+		{"check-in", "/admin/front-desk/check-in/1", "checked in", "flash-msg"},
+		{"check-in-twice", "/admin/front-desk/check-in/2", "Guest is already checked in", "error-msg"},
+		{"check-out", "/admin/front-desk/check-out/4", "checked out", "flash-msg"},
+		{"check-out-not-checked-in", "/admin/front-desk/check-out/1", "Guest is not checked in", "error-msg"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", e.path, strings.NewReader(url.Values{"arrival_notes": {"Late"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		ctx, _ := app.Session.Load(req.Context(), "")
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/front-desk" {
+			t.Errorf("%s: expected redirect to front desk but got %d %q", e.name, rr.Code, rr.Header().Get("Location"))
+		}
+
+		if msg := app.Session.GetString(ctx, e.msgKey); !strings.Contains(msg, e.expected) {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, msg)
+		}
+	}
+
+	//Test repository has one guest in each list
+	req := httptest.NewRequest("GET", "/admin/front-desk", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	for _, name := range []string{"Arriving", "Staying", "Leaving", "Early check-out"} {
+		if !strings.Contains(rr.Body.String(), name) {
+			t.Errorf("front desk page: %q is missing", name)
+		}
+	}
+}
+
+func TestHousekeeping(t *testing.T) {
+
+	routes := getRoutes()
+
+	var tests = []struct {
+		name     string
+		room     string
+		status   string
+		expected string //message in session
+		msgKey   string
+	}{
+		{"clean", "1", models.RoomClean, "Clean", "flash-msg"},
+		{"out-of-order", "1", models.RoomOutOfOrder, "Out of order", "flash-msg"},
+		{"out-of-order-with-guest", "2", models.RoomOutOfOrder, "move them to other rooms first: #2 Staying", "error-msg"},
+		{"unknown-status", "1", "sparkling", "Unknown housekeeping status", "error-msg"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/admin/housekeeping/"+e.room, strings.NewReader(url.Values{"status": {e.status}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		ctx, _ := app.Session.Load(req.Context(), "")
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/housekeeping" {
+			t.Errorf("%s: expected redirect to housekeeping but got %d %q", e.name, rr.Code, rr.Header().Get("Location"))
+		}
+
+		if msg := app.Session.GetString(ctx, e.msgKey); !strings.Contains(msg, e.expected) {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, msg)
+		}
+	}
+
+	//Room where guest leaves and another arrives comes before room where guest stays
+	req := httptest.NewRequest("GET", "/admin/housekeeping", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	first, second := strings.Index(body, "General&#39;s Quarters"), strings.Index(body, "Major&#39;s Suite")
+	if first < 0 || second < 0 || first > second {
+		t.Errorf("housekeeping page: expected General's Quarters before Major's Suite")
+	}
+}
+
+func TestPostCalendarConflict(t *testing.T) {
+
+	routes := getRoutes()
+
+	var tests = []struct {
+		name     string
+		day      string
+		expected string //message in session
+		msgKey   string
+	}{
+		{"free-day", "2050-01-5", "Changes saved", "flash-msg"},
+		{"booked-day", "2050-01-31", "General's Quarters 2050-01-31: All rooms of this type are booked on this day", "error-msg"},
+	}
+
+	for _, e := range tests {
+		form := url.Values{"y": {"2050"}, "m": {"01"}, "add_block_1_" + e.day: {"on"}}
+		req := httptest.NewRequest("POST", "/admin/reservation-calendar", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		ctx, _ := app.Session.Load(req.Context(), "")
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected redirect to calendar but got %d", e.name, rr.Code)
+		}
+
+		if msg := app.Session.GetString(ctx, e.msgKey); !strings.Contains(msg, e.expected) {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, msg)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	var tests = []struct {
+		remoteAddr string
+		expected   string
+	}{
+		{"203.0.113.7:51234", "203.0.113.7"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"203.0.113.7", "203.0.113.7"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+
+		if ip := clientIP(req); ip != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.remoteAddr, e.expected, ip)
+		}
+	}
+}
+
+func TestPostLoginDoesntLogEmail(t *testing.T) {
+
+	getRoutes()
+
+	//Log of the request goes to buffer (request logger comes from RequestLog in production)
+	var buf bytes.Buffer
+	logger := logging.New(&buf, "json", slog.LevelInfo).With("request_id", "test-id")
+
+	req := httptest.NewRequest("POST", "/user/login", strings.NewReader(url.Values{
+		"email":    {"secret-guest@here.ca"},
+		"password": {"wrong"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	ctx, _ := app.Session.Load(req.Context(), "")
+	req = req.WithContext(logging.WithLogger(ctx, logger))
+
+	rr := httptest.NewRecorder()
+	Ripo.PostLogin(rr, req)
+
+	if !strings.Contains(buf.String(), "login failed") || !strings.Contains(buf.String(), "test-id") {
+		t.Fatalf("expected failed login with request ID in log, got %s", buf.String())
+	}
+
+	if strings.Contains(buf.String(), "secret-guest") {
+		t.Errorf("email is in the log: %s", buf.String())
+	}
+}
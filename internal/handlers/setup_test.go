@@ -5,17 +5,24 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
+	"github.com/victorluk72/booking"
 	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/logging"
+	"github.com/victorluk72/booking/internal/emails"
+	"github.com/victorluk72/booking/internal/helpers"
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/mailer"
 	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
 	"github.com/victorluk72/booking/internal/render"
 )
 
@@ -26,28 +33,19 @@ var session *scs.SessionManager
 // Now this variable availabe for whole "main" package
 var app config.AppConfig
 
-// This is variable to store patch to templates
-// It can be differewnt for Linux
-var pathToTemplates = "../../templates"
-
-// Define var "functions". We will use it to allow our own functions in tempalte
-// These will be a custom functions for tempaltes (in future)
-var functions = template.FuncMap{}
-
 func getRoutes() http.Handler {
 
 	//----Pasted from func run() from main package
 	gob.Register(models.Reservation{})
+	gob.Register(map[string]int{})
 
 	//Change these to "true" when in Production
 	app.InProduction = false
 
-	//Define new INFO and ERROR logger and make it avaialble for whole application (vial app.Infolog)
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
-
-	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	//Structured logger, the same as in main (text format)
+	app.Logger = logging.New(os.Stdout, "text", slog.LevelInfo)
+	app.InfoLog = slog.NewLogLogger(app.Logger.Handler(), slog.LevelInfo)
+	app.ErrorLog = slog.NewLogLogger(app.Logger.Handler(), slog.LevelError)
 
 	//----Session managment-----------------------
 	session = scs.New()
@@ -62,6 +60,23 @@ func getRoutes() http.Handler {
 	//----Session managment Ends------------------
 
 	//----Template cache managment-------------------
+	//Templates, static files etc. built into binary, the same as in production
+	app.Assets = booking.Embedded()
+
+	//Property in its own time zone, server time zone must not matter
+	app.Property = property.Config{TimeZone: "America/Halifax", CheckIn: "15:00", CheckOut: "11:00"}
+	clock, err := property.NewClock(app.Property)
+	if err != nil {
+		log.Fatal("Can't create clock", err)
+	}
+	app.Clock = clock
+
+	//Translations, the same as in production
+	err = i18n.Load(app.Assets.Locales)
+	if err != nil {
+		log.Fatal("Can't load translations", err)
+	}
+
 	//Call my template cache (tc) from package render
 	tc, err := CreateTestTemplateCache()
 	if err != nil {
@@ -71,7 +86,7 @@ func getRoutes() http.Handler {
 
 	// Assign my tempalte cache to configuration variable app.TemplateCache
 	// This allows get cache once and do not reach it every time we browse
-	//app.TemplateCache = tc
+	app.TemplateCache = tc
 
 	//Don't use template cache (for example during dev process)
 	// false for Dev, true for Prod and for Test
@@ -85,14 +100,31 @@ func getRoutes() http.Handler {
 	fmt.Println("---End my template cache:---")
 	//--TEMP ENDS:Print list of all pages from tempalte cache
 
-	app.UseCache = false
-
 	//This give render package access to our app variable
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
+
+	err = emails.NewEmails(&app)
+	if err != nil {
+		log.Fatal("Can't create email template cache", err)
+	}
+
+	//Emails are not sent in tests, just take them from the channel
+	mailChan := make(chan models.MailData)
+	app.MailChan = mailChan
+	go func() {
+		for range mailChan {
+		}
+	}()
+
+	//Tests run in development mode, one email is already caught
+	app.MailCatcher = mailer.NewCatcher(10)
+	_ = app.MailCatcher.Send(models.MailData{To: "me@here.ca", From: "me@here.ca", Subject: "Test", Content: "<p>Hello</p>", PropertyID: 1})
+	_ = app.MailCatcher.Send(models.MailData{To: "me@here.ca", From: "me@here.ca", Subject: "Other property", Content: "<p>Hello</p>", PropertyID: 2})
 	//----Tempalte cache managment Ends----------------
 
 	// This is to create repository variable
-	repo := NewRipo(&app)
+	repo := NewTestRepo(&app)
 	//Pass it back to handlers (Why?)
 	NewHandlers(repo)
 
@@ -110,18 +142,66 @@ func getRoutes() http.Handler {
 
 	// This is middleware for session load
 	mux.Use(SessionLoad)
+
+	// Language of the page, from language menu or browser
+	mux.Use(Locale)
 	//--------Middleware block Ends------------
 
 	//------These are my routes---------------
+	mux.NotFound(Ripo.NotFound)
+
 	mux.Get("/", Ripo.Home)
 	mux.Get("/about", Ripo.About)
 	mux.Get("/generals", Ripo.Generals)
 	mux.Get("/majors", Ripo.Majors)
 	mux.Get("/contact", Ripo.Contact)
+	mux.Get("/language/{locale}", Ripo.Language)
+
+	mux.Get("/user/login", Ripo.Login)
+	mux.Get("/user/login/sso", Ripo.SSOLogin)
+	mux.Get("/user/login/sso/callback", Ripo.SSOCallback)
+
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Use(LoginAdmin)
+		mux.Use(Ripo.PropertyScope)
+
+		mux.Get("/dashboard", Ripo.AdminDashboard)
+		mux.Get("/sessions", Ripo.AdminSessions)
+		mux.Post("/revoke-session/{id}", Ripo.AdminRevokeSession)
+		mux.Get("/reservations/{src}/{id}", Ripo.AdminShowReservation)
+		mux.Post("/reservations/{src}/{id}", Ripo.AdminPostShowReservation)
+		mux.Post("/reservations/{src}/{id}/assign", Ripo.AdminPostAssignRoom)
+		mux.Get("/front-desk", Ripo.AdminFrontDesk)
+		mux.Post("/front-desk/check-in/{id}", Ripo.AdminPostCheckIn)
+		mux.Post("/front-desk/check-out/{id}", Ripo.AdminPostCheckOut)
+		mux.Get("/housekeeping", Ripo.AdminHousekeeping)
+		mux.Post("/housekeeping/{id}", Ripo.AdminPostHousekeeping)
+		mux.Get("/process-reservation/{src}/{id}", Ripo.AdminProcessReservation)
+		mux.Get("/delete-reservation/{src}/{id}", Ripo.AdminDeleteReservation)
+		mux.Get("/reservations-new", Ripo.AdminNewReservations)
+		mux.Get("/reservation-calendar", Ripo.AdminCalendar)
+		mux.Post("/reservation-calendar", Ripo.AdminPostCalendar)
+		mux.Get("/switch-property/{id}", Ripo.AdminSwitchProperty)
+		mux.Get("/property", Ripo.AdminProperty)
+		mux.Post("/property", Ripo.AdminPostProperty)
+		mux.Post("/property/staff", Ripo.AdminPostPropertyStaff)
+		mux.Get("/properties/new", Ripo.AdminNewProperty)
+		mux.Post("/properties/new", Ripo.AdminPostNewProperty)
+		mux.Get("/notifications", Ripo.AdminNotifications)
+		mux.Post("/notifications", Ripo.AdminPostNotifications)
+		mux.Get("/mail", Ripo.AdminMail)
+		mux.Get("/mail/{id}", Ripo.AdminShowMail)
+		mux.Post("/resend-mail/{id}", Ripo.AdminResendMail)
+		mux.Get("/dev/mail", Ripo.AdminDevMail)
+		mux.Get("/dev/mail/{id}", Ripo.AdminShowDevMail)
+		mux.Get("/dev/mail/{id}/html", Ripo.AdminDevMailHTML)
+		mux.Post("/dev/clear-mail", Ripo.AdminClearDevMail)
+	})
 
 	mux.Get("/search-availability", Ripo.Availability)
 	mux.Post("/search-availability", Ripo.PostAvailability)
 	mux.Post("/search-availability-json", Ripo.AvailabilityJSON)
+	mux.Get("/book-room", Ripo.BookRoom)
 
 	mux.Get("/make-reservation", Ripo.Reservation)
 	mux.Post("/make-reservation", Ripo.PostReservation)
@@ -130,7 +210,7 @@ func getRoutes() http.Handler {
 	//------End of my routes block---------------
 
 	//Create file server to manage our static files
-	fileServer := http.FileServer(http.Dir("../../static/"))
+	fileServer := http.FileServer(http.FS(app.Assets.Static))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 	return mux
 }
@@ -150,53 +230,38 @@ func NoSurf(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
+// LoginAdmin logs in administrator (user 3 of test repository) when nobody is logged in,
+// it stands for Auth of production routes
+func LoginAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.Session.Exists(r.Context(), "user_id") {
+			app.Session.Put(r.Context(), "user_id", 3)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // SessionLoad loads and saves the session on every request
 func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
 
-// CreateTestTemplateCache is to define map that would hold all template files
-// from "template" directory index would be a file name and value is pointer to rendered tempalte
-// INPORTANT: Using this map with cache prevent from reading templates from disk ever time when page loaded
-// instead we read if from "in memory" cache - increase speed dramatically!
-func CreateTestTemplateCache() (map[string]*template.Template, error) {
-
-	// This is to hold all tempaltes as a map - pointing to template addresses
-	// Index in this map is tempalte name and value is pointer to template
-	myCache := map[string]*template.Template{}
-
-	//This give you list of all full path to files that have "page.html" in the file name
-	pages, err := filepath.Glob(fmt.Sprintf("%s/*.page.html", pathToTemplates))
-	if err != nil {
-		return myCache, err
-	}
-
-	for _, page := range pages {
-		//this is extact file name only from pages
-		name := filepath.Base(page)
-
-		//This is a tempalte set (ts)  (all tempaltes)
-		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
-		if err != nil {
-			return myCache, err
+// Locale chooses language of the page from session or Accept-Language header
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := session.GetString(r.Context(), "locale")
+		if !i18n.Supported(locale) {
+			locale = i18n.Match(r.Header.Get("Accept-Language"))
 		}
 
-		//Check for base.layout.html files in templates folder
-		matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.html", pathToTemplates))
-		if err != nil {
-			return myCache, err
-		}
-
-		if len(matches) > 0 {
-			ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.html", pathToTemplates))
-			if err != nil {
-				return myCache, err
-			}
-		}
-
-		//Add template set to the myCache variable
-		myCache[name] = ts
-	}
+		w.Header().Set("Content-Language", locale)
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
 
-	return myCache, nil
+// CreateTestTemplateCache is to define map that would hold all template files
+// from "template" directory index would be a file name and value is pointer to rendered tempalte
+// Templates are the ones built into binary (see package booking), the same as in production
+func CreateTestTemplateCache() (map[string]*template.Template, error) {
+	return render.TemplateCacheFS(app.Assets.Templates)
 }
@@ -0,0 +1,164 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Build information, set at build time:
+//
+//	go build -ldflags "-X github.com/victorluk72/booking/internal/health.Commit=$(git rev-parse HEAD) -X github.com/victorluk72/booking/internal/health.BuildTime=$(date -u +%FT%TZ)" ./cmd/web
+//
+// When not set, they are taken from version control info that go build adds to the binary
+var (
+	Commit    string
+	BuildTime string
+)
+
+// How long all readiness checks together may take
+const checkTimeout = 5 * time.Second
+
+// CheckFunc returns error when the part of application is not usable
+type CheckFunc func(ctx context.Context) error
+
+// Checker holds readiness checks and serves /healthz, /readyz and /version
+type Checker struct {
+	mu     sync.Mutex
+	names  []string
+	checks map[string]CheckFunc
+}
+
+// CheckResult is the result of one check in /readyz response
+type CheckResult struct {
+	Status   string `json:"status"` // "ok" or "fail"
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// New returns Checker without checks
+func New() *Checker {
+	return &Checker{checks: make(map[string]CheckFunc)}
+}
+
+// Add adds readiness check (with the same name it replaces the old one)
+func (c *Checker) Add(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run runs all checks in the order they were added, returns true when all passed
+func (c *Checker) Run(ctx context.Context) (bool, map[string]CheckResult) {
+	c.mu.Lock()
+	names := append([]string(nil), c.names...)
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+
+	ok := true
+	results := make(map[string]CheckResult, len(names))
+
+	for _, name := range names {
+		start := time.Now()
+		err := checks[name](ctx)
+
+		result := CheckResult{Status: "ok", Duration: time.Since(start).String()}
+		if err != nil {
+			ok = false
+			result.Status = "fail"
+			result.Error = err.Error()
+		}
+
+		results[name] = result
+	}
+
+	return ok, results
+}
+
+// Live answers /healthz: process is up and serves requests
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready answers /readyz: 200 when all checks passed, 503 otherwise (load balancer stops sending traffic)
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	ok, results := c.Run(ctx)
+
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "fail", http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, map[string]interface{}{
+		"status": status,
+		"checks": results,
+	})
+}
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	Modified  bool   `json:"modified"` // built from repository with uncommitted changes
+	GoVersion string `json:"go_version"`
+}
+
+// Info returns build information of the running binary
+func Info() BuildInfo {
+	info := BuildInfo{Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildTime == "" {
+				info.BuildTime = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
+
+// Version answers /version with build information
+func (c *Checker) Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Info())
+}
+
+// writeJSON writes v as JSON response, health answers must never be cached
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_, _ = w.Write(out)
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestReady(t *testing.T) {
+	c := New()
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Add("templates", func(ctx context.Context) error { return nil })
+
+	rr := httptest.NewRecorder()
+	c.Ready(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	//One failing check makes the whole application not ready
+	c.Add("database", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	rr = httptest.NewRecorder()
+	c.Ready(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d but got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	var resp struct {
+		Status string
+		Checks map[string]CheckResult
+	}
+
+	err := json.Unmarshal(rr.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Status != "fail" || len(resp.Checks) != 2 {
+		t.Errorf("unexpected response %s", rr.Body)
+	}
+
+	if db := resp.Checks["database"]; db.Status != "fail" || db.Error != "connection refused" {
+		t.Errorf("unexpected database check %+v", db)
+	}
+
+	if resp.Checks["templates"].Status != "ok" {
+		t.Errorf("unexpected templates check %+v", resp.Checks["templates"])
+	}
+}
+
+func TestLive(t *testing.T) {
+	rr := httptest.NewRecorder()
+	New().Live(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+}
+
+func TestVersion(t *testing.T) {
+	Commit = "abc123"
+	defer func() { Commit = "" }()
+
+	rr := httptest.NewRecorder()
+	New().Version(rr, httptest.NewRequest("GET", "/version", nil))
+
+	var info BuildInfo
+	err := json.Unmarshal(rr.Body.Bytes(), &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Commit != "abc123" || info.GoVersion != runtime.Version() {
+		t.Errorf("unexpected build info %+v", info)
+	}
+}
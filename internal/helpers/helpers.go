@@ -1,11 +1,14 @@
 package helpers
 
 import (
-	"fmt"
 	"net/http"
 	"runtime/debug"
 
+	"github.com/victorluk72/booking/internal/apperr"
 	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/logging"
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/render"
 )
 
 //Let's get accesss to all app variables
@@ -17,31 +20,78 @@ func NewHelpers(a *config.AppConfig) {
 }
 
 // ClientError handles the client side errors
-// It take Response Writer and status code as input parameters
-func ClientError(w http.ResponseWriter, status int) {
+// It take Response Writer, Request and status code (4xx) as input parameters
+func ClientError(w http.ResponseWriter, r *http.Request, status int) {
 
-	// Write to my custom error log
-	app.InfoLog.Panicln("Cient error with status of", status)
-
-	//run standard function Error
-	http.Error(w, http.StatusText(status), status)
+	// Client errors are not our problems, info level is enough
+	logging.FromRequest(r).Info("client error", "status", status)
 
+	errorPage(w, r, status, http.StatusText(status), nil, nil)
 }
 
 // ServerError handles the server side errors
-// It take Response Write and error as input parameters
-// It writes the error to client browser
-func ServerError(w http.ResponseWriter, err error) {
+// It take Response Writer, Request and error as input parameters
+// Error with stack trace goes to the log of the request, browser gets 500 page
+// (with the error and stack when not in production)
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
 
 	//Get detailed information about error
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Println(trace)
+	stack := debug.Stack()
+	logging.FromRequest(r).Error("server error", "error", err, "stack", string(stack))
 
-	//run standar function Error
-	//Get internal Server error code
 	ise := http.StatusInternalServerError
-	http.Error(w, http.StatusText(ise), ise)
+	errorPage(w, r, ise, http.StatusText(ise), err, stack)
+}
+
+// Error sends error page with status that matches kind of err (see package apperr):
+// not found is 404, validation 400, conflict 409, forbidden 403, anything else is server error (500)
+// Always return from handler after it
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	status := apperr.Status(err)
+
+	if status >= http.StatusInternalServerError {
+		ServerError(w, r, err)
+		return
+	}
+
+	logging.FromRequest(r).Info("client error", "status", status, "error", err)
+
+	errorPage(w, r, status, apperr.Message(err), err, nil)
+}
+
+// Pages for error statuses, other statuses use error.page.html
+var errorTemplates = map[int]string{
+	http.StatusForbidden:           "403.page.html",
+	http.StatusNotFound:            "404.page.html",
+	http.StatusInternalServerError: "500.page.html",
+}
+
+// errorPage renders page for the status, err and stack are shown only when not in production
+// When the page itself can't be rendered, plain text error is sent
+func errorPage(w http.ResponseWriter, r *http.Request, status int, message string, err error, stack []byte) {
+	data := map[string]interface{}{
+		"Status":     status,
+		"StatusText": http.StatusText(status),
+		"Message":    message,
+		"RequestID":  logging.RequestID(r.Context()),
+	}
+
+	if !app.InProduction {
+		if err != nil {
+			data["Detail"] = err.Error()
+		}
+		data["Stack"] = string(stack)
+	}
+
+	tmpl, ok := errorTemplates[status]
+	if !ok {
+		tmpl = "error.page.html"
+	}
 
+	rerr := render.TemplateStatus(w, r, status, tmpl, &models.TemplateData{Data: data})
+	if rerr != nil {
+		http.Error(w, message, status)
+	}
 }
 
 func IsAuthenticated(r *http.Request) bool {
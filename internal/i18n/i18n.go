@@ -0,0 +1,290 @@
+// Package i18n translates pages, emails and text messages for guests
+//
+// Catalogs are locales/<locale>.yml (e.g. fr.yml), built into binary like templates.
+// Texts are looked up by their English source text, so template stays readable and
+// text without translation is shown in English:
+//
+//	{{t .Locale "Search for Availability"}}
+//	{{t .Locale "Reservation summary for %s room" $res.RoomType.Name}}
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+	"gopkg.in/yaml.v3"
+)
+
+// Default is the language of source texts, it is used when nothing else suits
+const Default = "en"
+
+// Language is one supported locale, e.g. {"fr", "Français"}
+type Language struct {
+	Code string // locale, name of the catalog file
+	Name string // name of the language in the language itself (for language menu)
+}
+
+// catalog is one locales/<locale>.yml
+type catalog struct {
+	Name  string `yaml:"name"`
+	Dates struct {
+		Short  string   `yaml:"short"`  // layout of time package, e.g. "02/01/2006"
+		Long   string   `yaml:"long"`   // "January" and "Monday" are replaced by Months and Days
+		Full   string   `yaml:"full"`   // long date with day of week
+		Time   string   `yaml:"time"`   // time of the day, e.g. "3:04 PM" or "15:04"
+		Months []string `yaml:"months"` // January to December (empty: English names)
+		Days   []string `yaml:"days"`   // Sunday to Saturday (empty: English names)
+	} `yaml:"dates"`
+	Messages map[string]string `yaml:"messages"` // English text: translation
+}
+
+// bundle is everything Load read
+type bundle struct {
+	catalogs  map[string]*catalog
+	languages []Language
+	tags      []language.Tag
+	matcher   language.Matcher
+}
+
+// Catalogs in use, Load replaces them at once (live reload in development)
+var current atomic.Pointer[bundle]
+
+// Load reads all catalogs from fsys, catalog of Default locale is required
+func Load(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.yml")
+	if err != nil {
+		return err
+	}
+
+	b := &bundle{catalogs: map[string]*catalog{}}
+
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+
+		var c catalog
+		err = yaml.Unmarshal(content, &c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		if len(c.Dates.Months) != 0 && len(c.Dates.Months) != 12 {
+			return fmt.Errorf("%s: expected 12 months, got %d", file, len(c.Dates.Months))
+		}
+
+		if len(c.Dates.Days) != 0 && len(c.Dates.Days) != 7 {
+			return fmt.Errorf("%s: expected 7 days, got %d", file, len(c.Dates.Days))
+		}
+
+		locale := strings.TrimSuffix(path.Base(file), ".yml")
+		b.catalogs[locale] = &c
+	}
+
+	if b.catalogs[Default] == nil {
+		return fmt.Errorf("catalog %s.yml is missing", Default)
+	}
+
+	//Default goes first, matcher falls back to the first tag
+	locales := make([]string, 0, len(b.catalogs))
+	for locale := range b.catalogs {
+		if locale != Default {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	locales = append([]string{Default}, locales...)
+
+	for _, locale := range locales {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return fmt.Errorf("%s.yml: %w", locale, err)
+		}
+
+		b.tags = append(b.tags, tag)
+		b.languages = append(b.languages, Language{Code: locale, Name: b.catalogs[locale].Name})
+	}
+
+	b.matcher = language.NewMatcher(b.tags)
+	current.Store(b)
+
+	return nil
+}
+
+// get returns catalogs, without Load there are none and everything is in English
+func get() *bundle {
+	b := current.Load()
+	if b == nil {
+		return &bundle{catalogs: map[string]*catalog{Default: {}}, languages: []Language{{Code: Default}}}
+	}
+
+	return b
+}
+
+// Languages returns supported languages, Default first
+func Languages() []Language {
+	return get().languages
+}
+
+// Supported reports whether there is catalog for locale
+func Supported(locale string) bool {
+	_, ok := get().catalogs[locale]
+	return ok
+}
+
+// Match returns supported locale that suits Accept-Language header best (Default when nothing suits)
+func Match(acceptLanguage string) string {
+	b := get()
+	if b.matcher == nil {
+		return Default
+	}
+
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+
+	_, index, confidence := b.matcher.Match(tags...)
+	if confidence == language.No {
+		return Default
+	}
+
+	return b.languages[index].Code
+}
+
+// lookup returns catalog of locale, or of Default locale when locale is not supported
+func (b *bundle) lookup(locale string) *catalog {
+	c, ok := b.catalogs[locale]
+	if !ok {
+		c = b.catalogs[Default]
+	}
+
+	return c
+}
+
+// T translates English text to locale and formats it with args like fmt.Sprintf
+// Text without translation stays English
+func T(locale, text string, args ...interface{}) string {
+	if translated, ok := get().lookup(locale).Messages[text]; ok && translated != "" {
+		text = translated
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+
+	return fmt.Sprintf(text, args...)
+}
+
+// Placeholders of month and day names in layouts (they can't be in date layout of time package)
+const (
+	monthMark = "\x01"
+	dayMark   = "\x02"
+)
+
+// Date formats t in locale, style is "short" (numbers only), "long" (with name of month)
+// or "full" (with day of week)
+func Date(locale string, t time.Time, style string) string {
+	c := get().lookup(locale)
+
+	var layout string
+	switch style {
+	case "long":
+		layout = c.Dates.Long
+	case "full":
+		layout = c.Dates.Full
+	default:
+		layout = c.Dates.Short
+	}
+
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+
+	//Names of months and days come from catalog, time package knows only English ones
+	if len(c.Dates.Months) == 12 {
+		layout = strings.Replace(layout, "January", monthMark, 1)
+	}
+	if len(c.Dates.Days) == 7 {
+		layout = strings.Replace(layout, "Monday", dayMark, 1)
+	}
+
+	s := t.Format(layout)
+
+	if len(c.Dates.Months) == 12 {
+		s = strings.Replace(s, monthMark, c.Dates.Months[t.Month()-1], 1)
+	}
+	if len(c.Dates.Days) == 7 {
+		s = strings.Replace(s, dayMark, c.Dates.Days[t.Weekday()], 1)
+	}
+
+	return s
+}
+
+// Time formats time of the day of t in locale (check-in and check-out), t is shown in its own time zone
+func Time(locale string, t time.Time) string {
+	layout := get().lookup(locale).Dates.Time
+	if layout == "" {
+		layout = "15:04"
+	}
+
+	return t.Format(layout)
+}
+
+// Number formats n (any integer or float) with separators of locale, e.g. 1,234.5 or 1 234,5
+func Number(locale string, n interface{}) string {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		tag = language.English
+	}
+
+	return message.NewPrinter(tag).Sprint(number.Decimal(n))
+}
+
+// AddLocale returns copy of data map with "Locale" when it has none, templates of emails and
+// text messages need it for texts and dates ({{t .Locale "..."}}); other data is returned as it is
+func AddLocale(data interface{}, locale string) interface{} {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return data
+	}
+
+	if _, ok := m["Locale"]; ok {
+		return data
+	}
+
+	copied := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		copied[k] = v
+	}
+	copied["Locale"] = locale
+
+	return copied
+}
+
+// Locale of the request is kept in context (see Locale middleware of the web application)
+type contextKey struct{}
+
+// WithLocale returns ctx with locale of the request
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns locale of the request, Default when there is none
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok && locale != "" {
+		return locale
+	}
+
+	return Default
+}
@@ -0,0 +1,181 @@
+package i18n
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var testLocales = fstest.MapFS{
+	"en.yml": {Data: []byte("name: English\ndates:\n  long: \"January 2, 2006\"\n  time: \"3:04 PM\"\n")},
+	"fr.yml": {Data: []byte(`name: Français
+dates:
+  short: "02/01/2006"
+  long: "2 January 2006"
+  full: "Monday 2 January 2006"
+  time: "15:04"
+  months: [janvier, février, mars, avril, mai, juin, juillet, août, septembre, octobre, novembre, décembre]
+  days: [dimanche, lundi, mardi, mercredi, jeudi, vendredi, samedi]
+messages:
+  "Book Now": "Réserver"
+  "Hi %s": "Bonjour %s"
+`)},
+}
+
+func TestLoad(t *testing.T) {
+	err := Load(testLocales)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	languages := Languages()
+	if len(languages) != 2 || languages[0] != (Language{"en", "English"}) || languages[1] != (Language{"fr", "Français"}) {
+		t.Errorf("unexpected languages %v", languages)
+	}
+
+	if !Supported("fr") || Supported("de") || Supported("") {
+		t.Error("unexpected supported languages")
+	}
+
+	//English catalog is required
+	err = Load(fstest.MapFS{"fr.yml": testLocales["fr.yml"]})
+	if err == nil {
+		t.Error("expected error without en.yml")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	err := Load(testLocales)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		header string
+		locale string
+	}{
+		{"fr-CA,fr;q=0.9,en;q=0.8", "fr"},
+		{"de-DE,fr;q=0.5", "fr"},
+		{"en-US,en;q=0.9", "en"},
+		{"de", "en"},
+		{"", "en"},
+		{"not a header;;", "en"},
+	}
+
+	for _, e := range tests {
+		if locale := Match(e.header); locale != e.locale {
+			t.Errorf("%q: expected %s but got %s", e.header, e.locale, locale)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	err := Load(testLocales)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		locale string
+		text   string
+		args   []interface{}
+		result string
+	}{
+		{"fr", "Book Now", nil, "Réserver"},
+		{"fr", "Hi %s", []interface{}{"Tom"}, "Bonjour Tom"},
+		{"fr", "No translation", nil, "No translation"},
+		{"en", "Hi %s", []interface{}{"Tom"}, "Hi Tom"},
+		{"de", "Book Now", nil, "Book Now"},
+	}
+
+	for _, e := range tests {
+		if result := T(e.locale, e.text, e.args...); result != e.result {
+			t.Errorf("%s %q: expected %q but got %q", e.locale, e.text, e.result, result)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	err := Load(testLocales)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2050, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		locale string
+		style  string
+		result string
+	}{
+		{"en", "long", "August 1, 2050"},
+		{"en", "short", "2050-08-01"},
+		{"fr", "short", "01/08/2050"},
+		{"fr", "long", "1 août 2050"},
+		{"fr", "full", "lundi 1 août 2050"},
+		{"de", "long", "August 1, 2050"},
+	}
+
+	for _, e := range tests {
+		if result := Date(e.locale, day, e.style); result != e.result {
+			t.Errorf("%s %s: expected %q but got %q", e.locale, e.style, e.result, result)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	err := Load(testLocales)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkIn := time.Date(2050, 8, 1, 15, 0, 0, 0, time.UTC)
+
+	if s := Time("en", checkIn); s != "3:00 PM" {
+		t.Errorf("expected 3:00 PM but got %q", s)
+	}
+
+	if s := Time("fr", checkIn); s != "15:00" {
+		t.Errorf("expected 15:00 but got %q", s)
+	}
+}
+
+func TestNumber(t *testing.T) {
+	if n := Number("en", 1234.5); n != "1,234.5" {
+		t.Errorf("expected 1,234.5 but got %q", n)
+	}
+
+	//French groups digits with no-break space
+	if n := Number("fr", 1234.5); n != "1\u00a0234,5" {
+		t.Errorf("expected 1 234,5 but got %q", n)
+	}
+}
+
+func TestAddLocale(t *testing.T) {
+	data := map[string]interface{}{"Name": "Tom"}
+
+	added := AddLocale(data, "fr").(map[string]interface{})
+	if added["Locale"] != "fr" || added["Name"] != "Tom" {
+		t.Errorf("unexpected data %v", added)
+	}
+
+	if _, ok := data["Locale"]; ok {
+		t.Error("original data is changed")
+	}
+
+	kept := AddLocale(map[string]interface{}{"Locale": "en"}, "fr").(map[string]interface{})
+	if kept["Locale"] != "en" {
+		t.Errorf("locale of data is replaced: %v", kept)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if locale := FromContext(context.Background()); locale != Default {
+		t.Errorf("expected %s without locale but got %s", Default, locale)
+	}
+
+	if locale := FromContext(WithLocale(context.Background(), "fr")); locale != "fr" {
+		t.Errorf("expected fr but got %s", locale)
+	}
+}
@@ -0,0 +1,235 @@
+// Package livereload watches template and static directories in development:
+// changed templates are parsed again and browsers reload the page (server-sent events)
+package livereload
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Editors write a file in several steps (temp file, rename, chmod), they are handled as one change
+const debounce = 100 * time.Millisecond
+
+// Reloader tells browsers to reload when files in watched directories change
+type Reloader struct {
+	watcher *fsnotify.Watcher
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	dirs    map[string]func() // watched root directory and what to do when something in it changes
+	version string            // changes with every change of files (and every start of application)
+	clients map[chan string]struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New starts watcher, add directories with Watch
+func New(logger *slog.Logger) (*Reloader, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Reloader{
+		watcher: w,
+		logger:  logger,
+		dirs:    map[string]func(){},
+		clients: map[chan string]struct{}{},
+		done:    make(chan struct{}),
+	}
+	l.bump()
+
+	go l.run()
+
+	return l, nil
+}
+
+// Watch watches dir with all its subdirectories, onChange (can be nil) runs after files in dir change
+// and before browsers are told to reload, e.g. to parse templates again
+func (l *Reloader) Watch(dir string, onChange func()) error {
+	dir = filepath.Clean(dir)
+
+	l.mu.Lock()
+	l.dirs[dir] = onChange
+	l.mu.Unlock()
+
+	return l.add(dir)
+}
+
+// add watches dir and its subdirectories (fsnotify watches only one directory, not the tree)
+func (l *Reloader) add(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		return l.watcher.Add(path)
+	})
+}
+
+// Version identifies current state of files, page is rendered with it and reloads when it changes
+func (l *Reloader) Version() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.version
+}
+
+// bump sets new version and sends it to connected browsers
+func (l *Reloader) bump() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.version = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	for ch := range l.clients {
+		//Browser that didn't get previous version yet needs only the last one
+		select {
+		case ch <- l.version:
+		default:
+		}
+	}
+}
+
+// run handles file events until Close
+func (l *Reloader) run() {
+	var timer <-chan time.Time
+	changed := map[string]bool{}
+
+	for {
+		select {
+		case ev, ok := <-l.watcher.Events:
+			if !ok {
+				return
+			}
+
+			//Only attributes changed, content is the same
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+
+			//New directory (e.g. static/img/new) is watched too
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					err = l.add(ev.Name)
+					if err != nil {
+						l.logger.Warn("can't watch directory", "dir", ev.Name, "error", err)
+					}
+				}
+			}
+
+			if root := l.root(ev.Name); root != "" {
+				changed[root] = true
+				timer = time.After(debounce)
+			}
+
+		case err, ok := <-l.watcher.Errors:
+			if !ok {
+				return
+			}
+			l.logger.Warn("file watcher", "error", err)
+
+		case <-timer:
+			for root := range changed {
+				l.logger.Info("files changed, reloading", "dir", root)
+
+				l.mu.Lock()
+				onChange := l.dirs[root]
+				l.mu.Unlock()
+
+				if onChange != nil {
+					onChange()
+				}
+			}
+
+			changed = map[string]bool{}
+			timer = nil
+			l.bump()
+
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// root returns watched directory that has path in it
+func (l *Reloader) root(path string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for dir := range l.dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return dir
+		}
+	}
+
+	return ""
+}
+
+// ServeHTTP streams versions to browser (server-sent events): current one at once, then every new one
+// Server write timeout ends the stream from time to time, browser connects again after "retry"
+func (l *Reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan string, 1)
+
+	l.mu.Lock()
+	l.clients[ch] = struct{}{}
+	version := l.version
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		delete(l.clients, ch)
+		l.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	//Page rendered before the last change (or before restart) reloads at once
+	fmt.Fprintf(w, "retry: 1000\ndata: %s\n\n", version)
+	flusher.Flush()
+
+	for {
+		select {
+		case version := <-ch:
+			fmt.Fprintf(w, "data: %s\n\n", version)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// Close stops watcher and ends streams of connected browsers (they would keep server from shutting down)
+func (l *Reloader) Close() error {
+	var err error
+
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.watcher.Close()
+	})
+
+	return err
+}
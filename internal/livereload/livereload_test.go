@@ -0,0 +1,124 @@
+package livereload
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// next returns data of the next event in the stream
+func next(t *testing.T, events chan string) string {
+	t.Helper()
+
+	select {
+	case data := <-events:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event from stream")
+		return ""
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.Mkdir(filepath.Join(dir, "css"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var parsed atomic.Int32
+	err = l.Watch(dir, func() { parsed.Add(1) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(l)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				events <- data
+			}
+		}
+		close(events)
+	}()
+
+	//Current version comes at once
+	first := next(t, events)
+	if first != l.Version() {
+		t.Errorf("expected version %q, got %q", l.Version(), first)
+	}
+
+	//Several writes of one save are one change, file in subdirectory is watched too
+	for i := 0; i < 3; i++ {
+		err = os.WriteFile(filepath.Join(dir, "css", "styles.css"), []byte("body {}"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	second := next(t, events)
+	if second == first {
+		t.Error("version didn't change")
+	}
+
+	if parsed.Load() != 1 {
+		t.Errorf("expected one reload, got %d", parsed.Load())
+	}
+
+	//Directory made after start is watched as well
+	err = os.Mkdir(filepath.Join(dir, "img"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(t, events)
+
+	err = os.WriteFile(filepath.Join(dir, "img", "logo.svg"), []byte("<svg/>"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(t, events)
+
+	//Close ends the stream, so server can shut down
+	l.Close()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("stream is not closed")
+		}
+	}
+}
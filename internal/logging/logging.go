@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// New returns leveled logger writing to w in format "json" (one object per line) or "text" (key=value)
+func New(w io.Writer, format string, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// ResolveFormat returns format for New: "auto" is "json" in production and "text" otherwise
+func ResolveFormat(format string, production bool) string {
+	if format != "auto" {
+		return format
+	}
+
+	if production {
+		return "json"
+	}
+
+	return "text"
+}
+
+// ParseLevel converts "debug", "info", "warn" or "error" to slog.Level (unknown is info)
+func ParseLevel(s string) slog.Level {
+	var level slog.Level
+
+	err := level.UnmarshalText([]byte(s))
+	if err != nil {
+		return slog.LevelInfo
+	}
+
+	return level
+}
+
+type ctxKey int
+
+const (
+	loggerKey ctxKey = iota
+	requestIDKey
+)
+
+// WithLogger returns context carrying logger l (see FromContext)
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns logger of the request (with request ID, user ID), or default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+
+	return slog.Default()
+}
+
+// FromRequest returns logger of the request with route pattern, e.g. "/admin/reservations/{src}/{id}"
+func FromRequest(r *http.Request) *slog.Logger {
+	l := FromContext(r.Context())
+
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		l = l.With("route", rctx.RoutePattern())
+	}
+
+	return l
+}
+
+// WithRequestID returns context carrying request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns ID of the request from context (empty if there is none)
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// NewRequestID returns random request ID, or id if it is a sensible ID from proxy (X-Request-Id header)
+func NewRequestID(id string) string {
+	if id != "" && len(id) <= 64 && strings.IndexFunc(id, invalidIDRune) < 0 {
+		return id
+	}
+
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// invalidIDRune reports runes we don't accept in request ID from outside (it goes to logs and headers)
+func invalidIDRune(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+}
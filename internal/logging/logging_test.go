@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestNewRequestID(t *testing.T) {
+
+	var tests = []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"empty", "", false},
+		{"from-proxy", "abc-123_X.9", true},
+		{"new-line", "abc\ninjected=1", false},
+		{"space", "abc 123", false},
+		{"too-long", strings.Repeat("a", 65), false},
+	}
+
+	for _, e := range tests {
+		id := NewRequestID(e.incoming)
+
+		if e.keep && id != e.incoming {
+			t.Errorf("%s: expected %q, got %q", e.name, e.incoming, id)
+		}
+
+		if !e.keep && (id == e.incoming || len(id) != 16) {
+			t.Errorf("%s: expected new 16 characters ID, got %q", e.name, id)
+		}
+	}
+
+	if NewRequestID("") == NewRequestID("") {
+		t.Error("generated IDs must differ")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+
+	var tests = []struct {
+		in       string
+		expected slog.Level
+	}{
+		{"debug", slog.LevelDebug},
+		{"warn", slog.LevelWarn},
+		{"error", slog.LevelError},
+		{"", slog.LevelInfo},
+		{"loud", slog.LevelInfo},
+	}
+
+	for _, e := range tests {
+		if got := ParseLevel(e.in); got != e.expected {
+			t.Errorf("%q: expected %v, got %v", e.in, e.expected, got)
+		}
+	}
+}
+
+func TestResolveFormat(t *testing.T) {
+	if ResolveFormat("auto", true) != "json" || ResolveFormat("auto", false) != "text" {
+		t.Error("auto must be json in production and text in development")
+	}
+
+	if ResolveFormat("text", true) != "text" {
+		t.Error("explicit format must be kept")
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+
+	var buf bytes.Buffer
+	l := New(&buf, "json", slog.LevelInfo).With("request_id", "r1")
+
+	//Request logger with route pattern of chi
+	mux := chi.NewRouter()
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		FromRequest(r).Info("hello")
+	})
+
+	r := httptest.NewRequest("GET", "/rooms/7", nil)
+	r = r.WithContext(WithLogger(r.Context(), l))
+	mux.ServeHTTP(httptest.NewRecorder(), r)
+
+	var line map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &line)
+	if err != nil {
+		t.Fatalf("log line is not JSON: %s", buf.String())
+	}
+
+	if line["msg"] != "hello" || line["request_id"] != "r1" || line["route"] != "/rooms/{id}" || line["level"] != "INFO" {
+		t.Errorf("unexpected log line %v", line)
+	}
+}
+
+func TestFromContextDefault(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("expected default logger without request logger")
+	}
+
+	if RequestID(context.Background()) != "" {
+		t.Error("expected empty request ID")
+	}
+
+	if RequestID(WithRequestID(context.Background(), "r2")) != "r2" {
+		t.Error("request ID is lost")
+	}
+}
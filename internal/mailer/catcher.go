@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/textproto"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+)
+
+// ErrNotCaught is returned when captured message is not found (never caught or already dropped)
+var ErrNotCaught = errors.New("mailer: message not found in catcher")
+
+// Caught is one message captured by Catcher
+type Caught struct {
+	ID       int
+	Time     time.Time
+	MailData models.MailData
+	Raw      string   // whole message as it would be sent (headers and body)
+	Headers  []Header // headers of Raw, sorted by name
+}
+
+// Header is one message header
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Catcher keeps messages in memory instead of sending them (development only)
+// Only the last Max messages are kept, older ones are dropped
+type Catcher struct {
+	Max int
+
+	mu       sync.Mutex
+	messages []Caught
+	lastID   int
+}
+
+// NewCatcher returns Catcher that keeps up to max messages
+func NewCatcher(max int) *Catcher {
+	return &Catcher{Max: max}
+}
+
+// Send captures one message
+func (c *Catcher) Send(m models.MailData) error {
+	raw, err := rawMessage(m)
+	if err != nil {
+		return err
+	}
+
+	headers, err := parseHeaders(raw)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastID++
+	c.messages = append(c.messages, Caught{
+		ID:       c.lastID,
+		Time:     time.Now(),
+		MailData: m,
+		Raw:      string(raw),
+		Headers:  headers,
+	})
+
+	if c.Max > 0 && len(c.messages) > c.Max {
+		c.messages = append([]Caught(nil), c.messages[len(c.messages)-c.Max:]...)
+	}
+
+	return nil
+}
+
+// All returns captured messages, newest first
+func (c *Catcher) All() []Caught {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	all := make([]Caught, len(c.messages))
+	for i, m := range c.messages {
+		all[len(all)-1-i] = m
+	}
+
+	return all
+}
+
+// Get returns captured message by ID
+func (c *Catcher) Get(id int) (Caught, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range c.messages {
+		if m.ID == id {
+			return m, nil
+		}
+	}
+
+	return Caught{}, ErrNotCaught
+}
+
+// Clear drops all captured messages
+func (c *Catcher) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages = nil
+}
+
+// parseHeaders reads header section of raw message
+func parseHeaders(raw []byte) ([]Header, error) {
+	mh, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw))).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []Header
+	for name, values := range mh {
+		for _, v := range values {
+			headers = append(headers, Header{Name: name, Value: v})
+		}
+	}
+
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+
+	return headers, nil
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCatcher(t *testing.T) {
+	c := NewCatcher(2)
+
+	for _, subject := range []string{"first", "second", "third"} {
+		msg := testMsg
+		msg.Subject = subject
+
+		err := c.Send(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//Only the last two are kept, newest first
+	all := c.All()
+	if len(all) != 2 || all[0].MailData.Subject != "third" || all[1].MailData.Subject != "second" {
+		t.Fatalf("unexpected messages %+v", all)
+	}
+
+	msg, err := c.Get(all[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(msg.Raw, "Subject: third") || !strings.Contains(msg.Raw, "<strong>Hello</strong>") {
+		t.Errorf("unexpected raw message:\n%s", msg.Raw)
+	}
+
+	found := false
+	for _, h := range msg.Headers {
+		if h.Name == "To" && h.Value == "<guest@here.ca>" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("To header is missing in %+v", msg.Headers)
+	}
+
+	//The first one was dropped
+	_, err = c.Get(1)
+	if err != ErrNotCaught {
+		t.Errorf("expected ErrNotCaught but got %v", err)
+	}
+
+	c.Clear()
+	if len(c.All()) != 0 {
+		t.Error("expected no messages after Clear")
+	}
+}
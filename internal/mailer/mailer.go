@@ -0,0 +1,202 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(m models.MailData) error
+}
+
+// Config holds mail settings, Transport chooses which Mailer is used
+type Config struct {
+	Transport string // "smtp", "sendmail", "file" or "log"
+	From      string // sender address for all emails
+
+	//SMTP transport
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	Encryption string // "none", "starttls" or "tls" (implicit TLS, usually port 465)
+	Auth       string // "plain", "login" or "cram-md5", used only when Username is set
+	Timeout    time.Duration
+
+	//sendmail transport
+	SendmailPath string
+
+	//file transport
+	Dir string // every message is saved there as .eml file
+}
+
+// New returns Mailer for transport from config
+func New(cfg Config, infoLog *log.Logger) (Mailer, error) {
+	switch cfg.Transport {
+	case "smtp":
+		if cfg.Host == "" {
+			return nil, errors.New("mailer: smtp host is not set")
+		}
+		return &SMTP{cfg: cfg}, nil
+	case "sendmail":
+		return &Sendmail{Path: cfg.SendmailPath}, nil
+	case "file":
+		err := os.MkdirAll(cfg.Dir, 0755)
+		if err != nil {
+			return nil, err
+		}
+		return &File{Dir: cfg.Dir}, nil
+	case "log":
+		return &Log{Logger: infoLog}, nil
+	}
+
+	return nil, fmt.Errorf("mailer: unknown transport %q", cfg.Transport)
+}
+
+// newEmail builds the message from MailData
+// With plain text part the message is multipart/alternative (text first, mail clients prefer the last part)
+func newEmail(m models.MailData) *mail.Email {
+	email := mail.NewMSG()
+	email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
+
+	if m.Text != "" {
+		email.SetBody(mail.TextPlain, m.Text)
+		email.AddAlternative(mail.TextHTML, m.Content)
+	} else {
+		email.SetBody(mail.TextHTML, m.Content)
+	}
+
+	return email
+}
+
+// rawMessage returns the message as text (headers and body), as it is saved to .eml file
+func rawMessage(m models.MailData) ([]byte, error) {
+	email := newEmail(m)
+	if email.Error != nil {
+		return nil, email.Error
+	}
+
+	return []byte(email.GetMessage()), nil
+}
+
+// SMTP sends email through mail server
+type SMTP struct {
+	cfg Config
+}
+
+// Send connects to the server and sends one message
+func (s *SMTP) Send(m models.MailData) error {
+
+	//Define mail SERVER parameters
+	server := mail.NewSMTPClient()
+	server.Host = s.cfg.Host
+	server.Port = s.cfg.Port
+	server.Username = s.cfg.Username
+	server.Password = s.cfg.Password
+	server.KeepAlive = false
+	server.ConnectTimeout = s.cfg.Timeout
+	server.SendTimeout = s.cfg.Timeout
+
+	switch s.cfg.Encryption {
+	case "starttls":
+		server.Encryption = mail.EncryptionSTARTTLS
+	case "tls":
+		server.Encryption = mail.EncryptionSSLTLS
+	default:
+		server.Encryption = mail.EncryptionNone
+	}
+
+	switch s.cfg.Auth {
+	case "login":
+		server.Authentication = mail.AuthLogin
+	case "cram-md5":
+		server.Authentication = mail.AuthCRAMMD5
+	default:
+		server.Authentication = mail.AuthPlain
+	}
+
+	//Check the message before we connect, so bad message doesn't leave connection open
+	email := newEmail(m)
+	if email.Error != nil {
+		return email.Error
+	}
+
+	client, err := server.Connect()
+	if err != nil {
+		return fmt.Errorf("smtp connect: %w", err)
+	}
+
+	return email.Send(client)
+}
+
+// Sendmail pipes the message to sendmail binary (sendmail -t reads recipients from headers)
+type Sendmail struct {
+	Path string
+}
+
+// Send runs sendmail for one message
+func (s *Sendmail) Send(m models.MailData) error {
+	msg, err := rawMessage(m)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(s.Path, "-t", "-i")
+	cmd.Stdin = bytes.NewReader(msg)
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("sendmail: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return nil
+}
+
+// File saves every message as .eml file (open it with any mail client), useful for development
+type File struct {
+	Dir string
+}
+
+// Send writes one message to new file in Dir
+func (f *File) Send(m models.MailData) error {
+	msg, err := rawMessage(m)
+	if err != nil {
+		return err
+	}
+
+	//Time first, so files are sorted by the time they were sent
+	suffix := make([]byte, 4)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), hex.EncodeToString(suffix))
+
+	return os.WriteFile(filepath.Join(f.Dir, name), msg, 0644)
+}
+
+// Log only writes recipient and subject to the log, nothing is sent
+type Log struct {
+	Logger *log.Logger
+}
+
+// Send logs one message
+func (l *Log) Send(m models.MailData) error {
+	l.Logger.Printf("Email to %s from %s: %s", m.To, m.From, m.Subject)
+	return nil
+}
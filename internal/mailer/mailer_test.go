@@ -0,0 +1,253 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+)
+
+var testMsg = models.MailData{
+	To:      "guest@here.ca",
+	From:    "booking@here.ca",
+	Subject: "Your reservation is received",
+	Content: "<strong>Hello</strong>",
+}
+
+// checkMessage makes sure raw message has the headers and the body
+func checkMessage(t *testing.T, raw string) {
+	for _, s := range []string{"To: <guest@here.ca>", "From: <booking@here.ca>", "Subject: Your reservation is received", "<strong>Hello</strong>"} {
+		if !strings.Contains(raw, s) {
+			t.Errorf("%q is missing in message:\n%s", s, raw)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+
+	m, err := New(Config{Transport: "file", Dir: dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = m.Send(testMsg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files but got %d", len(files))
+	}
+
+	b, _ := os.ReadFile(files[0])
+	checkMessage(t, string(b))
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+
+	m, err := New(Config{Transport: "log"}, log.New(&buf, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send(testMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "guest@here.ca") || !strings.Contains(buf.String(), testMsg.Subject) {
+		t.Errorf("unexpected log %q", buf.String())
+	}
+}
+
+func TestSendmail(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.eml")
+
+	//Fake sendmail saves its arguments and the message
+	script := filepath.Join(dir, "sendmail")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > "+out+".args\ncat > "+out+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := New(Config{Transport: "sendmail", SendmailPath: script}, nil)
+
+	err = m.Send(testMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(out)
+	checkMessage(t, string(b))
+
+	args, _ := os.ReadFile(out + ".args")
+	if strings.TrimSpace(string(args)) != "-t -i" {
+		t.Errorf("unexpected sendmail arguments %q", args)
+	}
+
+	//Failing sendmail must return error
+	m, _ = New(Config{Transport: "sendmail", SendmailPath: "/bin/false"}, nil)
+	if m.Send(testMsg) == nil {
+		t.Error("expected error from failing sendmail")
+	}
+}
+
+// fakeSMTP accepts one message and sends what it received to the channel
+func fakeSMTP(t *testing.T) (int, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		var data strings.Builder
+		reply("220 localhost ready")
+
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				reply("250 queued")
+				received <- data.String()
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTP(t *testing.T) {
+	port, received := fakeSMTP(t)
+
+	m, err := New(Config{Transport: "smtp", Host: "127.0.0.1", Port: port, Encryption: "none", Timeout: time.Second}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send(testMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case raw := <-received:
+		checkMessage(t, raw)
+	case <-time.After(time.Second):
+		t.Fatal("message was not received")
+	}
+}
+
+func TestSMTPConnectError(t *testing.T) {
+
+	//Get free port and close it, so nobody listens there
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	m, _ := New(Config{Transport: "smtp", Host: "127.0.0.1", Port: port, Timeout: time.Second}, nil)
+
+	err := m.Send(testMsg)
+	if err == nil || !strings.Contains(err.Error(), "smtp connect") {
+		t.Errorf("expected connect error but got %v", err)
+	}
+}
+
+func TestSMTPBadMessage(t *testing.T) {
+
+	//Nobody listens on the port: message must be refused before we try to connect
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	m, _ := New(Config{Transport: "smtp", Host: "127.0.0.1", Port: port, Timeout: time.Second}, nil)
+
+	bad := testMsg
+	bad.From = "not an address"
+
+	err := m.Send(bad)
+	if err == nil || strings.Contains(err.Error(), "smtp connect") {
+		t.Errorf("expected message error but got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"smtp", Config{Transport: "smtp", Host: "localhost", Port: 25}, true},
+		{"smtp-no-host", Config{Transport: "smtp"}, false},
+		{"sendmail", Config{Transport: "sendmail", SendmailPath: "/usr/sbin/sendmail"}, true},
+		{"log", Config{Transport: "log"}, true},
+		{"unknown", Config{Transport: "pigeon"}, false},
+	}
+
+	for _, e := range tests {
+		_, err := New(e.cfg, nil)
+		if (err == nil) != e.ok {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	msg := testMsg
+	msg.Text = "Hello in plain text"
+
+	raw, err := rawMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"multipart/alternative", "text/plain", "Hello in plain text", "text/html", "<strong>Hello</strong>"} {
+		if !strings.Contains(string(raw), s) {
+			t.Errorf("%q is missing in message:\n%s", s, raw)
+		}
+	}
+}
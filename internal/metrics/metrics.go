@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds all metrics of the application, /metrics serves it
+var Registry = prometheus.NewRegistry()
+
+// HTTP requests by chi route pattern (e.g. "/admin/reservations/{src}/{id}"), not by URL,
+// so the number of series doesn't grow with every ID
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "booking_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "booking_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+// Database calls by repository method (e.g. "SearchAvailabilityForRoomTypes")
+var dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "booking_db_query_duration_seconds",
+	Help:    "Latency of repository calls by method.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 3},
+}, []string{"method"})
+
+// Business events
+var (
+	// Searches counts availability searches, kind is "all_rooms" (search page) or "room" (room page)
+	Searches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "booking_searches_total",
+		Help: "Availability searches.",
+	}, []string{"kind"})
+
+	// EmptySearches counts searches that found nothing available
+	EmptySearches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "booking_searches_empty_total",
+		Help: "Availability searches without available rooms.",
+	}, []string{"kind"})
+
+	// ReservationsCreated counts reservations made by guests
+	ReservationsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "booking_reservations_created_total",
+		Help: "Reservations created.",
+	})
+
+	// Emails counts sending attempts, result is "sent", "failed" (will be retried) or "dead" (given up)
+	Emails = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "booking_emails_total",
+		Help: "Email sending attempts by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		dbDuration,
+		Searches,
+		EmptySearches,
+		ReservationsCreated,
+		Emails,
+	)
+}
+
+// Handler serves /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB adds connection pool stats of db (open, idle, in use connections, waits)
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "booking"))
+}
+
+// Middleware records count and latency of every request
+// Route pattern is known only after chi routed the request, so it is read after next
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		code := ww.Status()
+		if code == 0 {
+			//Handler wrote nothing
+			code = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(code)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveDB records latency of one repository call, use it with defer:
+//
+//	defer metrics.ObserveDB("GetRoomByID", time.Now())
+func ObserveDB(method string, start time.Time) {
+	dbDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
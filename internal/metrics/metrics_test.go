@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	mux := chi.NewRouter()
+	mux.Use(Middleware)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Get("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+
+	for _, path := range []string{"/rooms/1", "/rooms/2", "/broken", "/nothing"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	//Both rooms are one series, by route pattern
+	var tests = []struct {
+		route    string
+		code     string
+		expected float64
+	}{
+		{"/rooms/{id}", "200", 2},
+		{"/broken", "500", 1},
+		{"unmatched", "404", 1},
+	}
+
+	for _, e := range tests {
+		got := testutil.ToFloat64(httpRequests.WithLabelValues(e.route, "GET", e.code))
+		if got != e.expected {
+			t.Errorf("%s %s: expected %v requests but got %v", e.route, e.code, e.expected, got)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ObserveDB("GetRoomByID", time.Now())
+	Searches.WithLabelValues("all_rooms").Inc()
+	EmptySearches.WithLabelValues("all_rooms").Inc()
+	ReservationsCreated.Inc()
+	Emails.WithLabelValues("sent").Inc()
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := io.ReadAll(rr.Body)
+
+	for _, s := range []string{
+		`booking_db_query_duration_seconds_count{method="GetRoomByID"} 1`,
+		`booking_searches_total{kind="all_rooms"} 1`,
+		`booking_searches_empty_total{kind="all_rooms"} 1`,
+		`booking_reservations_created_total 1`,
+		`booking_emails_total{result="sent"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), s) {
+			t.Errorf("%q is missing in metrics", s)
+		}
+	}
+}
@@ -14,14 +14,88 @@ type User struct {
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	AccessLevel int
+	Notify      Notifications
+}
+
+// AccessLevelAdmin is access level of administrators, only they add properties and staff
+const AccessLevelAdmin = 3
+
+// Events that staff can be notified about (see Notifications)
+const (
+	EventNewReservation = "new"
+	EventModified       = "modified"
+	EventCancelled      = "cancelled"
+	EventBlocked        = "blocked"
+)
+
+// Notifications are events the user wants to get email about
+type Notifications struct {
+	New       bool
+	Modified  bool
+	Cancelled bool
+	Blocked   bool
+}
+
+// Property is the model for property (one bed and breakfast, hotel etc.), rooms belong to it
+// Empty TimeZone, CheckIn and CheckOut mean settings from configuration (see package property)
+type Property struct {
+	ID           int
+	Name         string
+	ContactEmail string // guests can write here, it is shown in emails
+	TimeZone     string // IANA time zone, e.g. "America/Halifax"
+	CheckIn      string // e.g. "15:00"
+	CheckOut     string // e.g. "11:00"
+	LogoURL      string // logo in the header of emails
+	BrandColor   string // color of the header of emails, e.g. "#2c3e50"
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RoomType is the model for type of rooms: identical physical rooms of the property
+// Guests book a type, physical room is assigned to the reservation later (see Reservation.RoomID)
+type RoomType struct {
+	ID          int
+	PropertyID  int
+	Property    Property
+	Name        string
+	Description string
+	Available   int // rooms of the type free for every night of searched dates (see SearchAvailabilityForRoomTypes)
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
 
 // Room is the model for room
 type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID             int
+	RoomName       string
+	PropertyID     int
+	Property       Property
+	RoomTypeID     int
+	RoomType       RoomType
+	Housekeeping   string    // one of Room* statuses
+	HousekeepingAt time.Time // when status was changed last time, zero if never
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Housekeeping statuses of the room
+const (
+	RoomDirty      = "dirty" // guest left (check-out sets it)
+	RoomCleaning   = "cleaning"
+	RoomClean      = "clean"
+	RoomInspected  = "inspected"    // clean and checked by supervisor
+	RoomOutOfOrder = "out_of_order" // can't be sold or assigned
+)
+
+// RoomStatuses lists housekeeping statuses in the order housekeepers go through them
+var RoomStatuses = []string{RoomDirty, RoomCleaning, RoomClean, RoomInspected, RoomOutOfOrder}
+
+// HousekeepingTask is the room on daily task list of housekeeping (see HousekeepingBoard of repository)
+type HousekeepingTask struct {
+	Room      Room
+	Departure bool // guest leaves today: clean after check-out
+	Stayover  bool // guest stays tonight: daily service
+	Arrival   bool // guest arrives today: room must be ready for check-in
 }
 
 // Restriction is the model for restriction
@@ -34,18 +108,27 @@ type Restriction struct {
 
 // Reservation is the model for reservation
 type Reservation struct {
-	ID        int
-	FirstName string
-	LastName  string
-	Email     string
-	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
-	RoomID    int
-	Room      Room
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Processed int
+	ID         int
+	FirstName  string
+	LastName   string
+	Email      string
+	Phone      string
+	StartDate  time.Time
+	EndDate    time.Time
+	RoomTypeID int      // type guest booked
+	RoomType   RoomType // with its property
+	RoomID     int      // physical room, 0 until it is assigned
+	Room       Room
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Processed  int
+	SMSOptIn   bool   // guest wants text messages about the reservation (to Phone)
+	Locale     string // language guest booked in, their emails and text messages are in it (see package i18n)
+
+	//Front desk (see CheckIn and CheckOut of repository), zero time until it happens
+	CheckedInAt  time.Time
+	CheckedOutAt time.Time
+	ArrivalNotes string // e.g. "late arrival, key in the box"
 }
 
 // RoomRestriction is the model for room restriction
@@ -57,16 +140,66 @@ type RoomRestriction struct {
 	Reservation   Reservation
 	RestrictionID int
 	Restriction   Restriction
-	RoomID        int
+	RoomID        int // 0 for reservation without assigned room
 	Room          Room
+	RoomTypeID    int // type of reserved room, 0 for owner blocks (they block one room)
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
 
+// UserSession is the model for logged in session of the user (who owns which session)
+type UserSession struct {
+	ID        int
+	Token     string
+	UserID    int
+	User      User
+	IPAddress string
+	UserAgent string
+	Expiry    time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
 // MailData contains all data related to email message
 type MailData struct {
 	To      string
 	From    string
 	Subject string
-	Content string
+	Content string // HTML
+	Text    string // plain text alternative of Content (can be empty)
+
+	PropertyID int // property the email is about, admin pages show it only to its staff (0 for none)
 }
+
+// SMSData contains text message to the guest phone
+type SMSData struct {
+	To   string // phone number, e.g. "+15551234567"
+	Body string
+}
+
+// Statuses of the message in mail outbox
+const (
+	MailPending = "pending" // waiting to be sent (or to be retried)
+	MailSending = "sending" // taken by one of mail workers
+	MailSent    = "sent"
+	MailDead    = "dead" // all attempts failed, can be resent from admin page
+)
+
+// MailMessage is the model for message in mail outbox
+type MailMessage struct {
+	ID            int
+	MailData      MailData
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	SentAt        time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Kinds of scheduled guest emails (see package reminders)
+const (
+	ReminderArrival  = "arrival"
+	ReminderFollowUp = "follow-up"
+)
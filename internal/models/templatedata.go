@@ -1,20 +1,29 @@
 package models
 
-import "github.com/victorluk72/booking/internal/forms"
+import (
+	"github.com/victorluk72/booking/internal/forms"
+	"github.com/victorluk72/booking/internal/i18n"
+)
 
 // Create type that would hold all data types to pass from handlers to tempalte
 // Special notes:
 //    Form use to pass form object from standatd library
 //    Data use to pass values of the form fileds
 type TemplateData struct {
-	StringMap map[string]string      //this holds all possible string type data
-	IntMap    map[string]int         //this holds all possible integer type data
-	FloatMap  map[string]float32     //this holds all possible float type data
-	Data      map[string]interface{} //this holds all possible type of data-anything
-	CSRFToken string                 // string for CSRF token (for form safety)
-	Flash     string                 // string for flash message
-	Warning   string                 // string for warning message
-	Error     string                 // string for error message
-	Form      *forms.Form            // form type from standard library
-	IsAuth    bool                   // Check if user is authenticated
+	StringMap  map[string]string      //this holds all possible string type data
+	IntMap     map[string]int         //this holds all possible integer type data
+	FloatMap   map[string]float32     //this holds all possible float type data
+	Data       map[string]interface{} //this holds all possible type of data-anything
+	CSRFToken  string                 // string for CSRF token (for form safety)
+	Flash      string                 // string for flash message
+	Warning    string                 // string for warning message
+	Error      string                 // string for error message
+	Form       *forms.Form            // form type from standard library
+	IsAuth     bool                   // Check if user is authenticated
+	DevMail    bool                   // Emails are caught, not sent (development), see /admin/dev/mail
+	LiveReload string                 // Version of files for live reload script (development), empty when it is off
+	Locale     string                 // Language of the page, e.g. "fr" (see package i18n)
+	Languages  []i18n.Language        // Languages for the language menu
+	Property   Property               // Property admin pages show (property switcher), empty on public pages
+	Properties []Property             // Properties the user manages, choices of property switcher
 }
@@ -0,0 +1,238 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/victorluk72/booking/internal/metrics"
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Store is the part of repository that outbox needs (postgresDBRepo implements it)
+type Store interface {
+	InsertMail(ctx context.Context, m models.MailData) error
+	ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.MailMessage, error)
+	UpdateMail(ctx context.Context, msg models.MailMessage, claimedUntil time.Time) error
+}
+
+// SendFunc delivers one message, error means the attempt failed and will be retried
+type SendFunc func(m models.MailData) error
+
+// Config holds settings of worker pool
+type Config struct {
+	Workers      int           // how many messages are sent at the same time
+	MaxAttempts  int           // after this many failed attempts the message is "dead"
+	RetryDelay   time.Duration // delay after first failure, it doubles after every next one
+	MaxDelay     time.Duration // retry delay never grows above this
+	PollInterval time.Duration // how often outbox is checked for due messages
+	Lease        time.Duration // how long claimed message is locked for one worker
+}
+
+// Pool is a group of workers sending messages from outbox table
+type Pool struct {
+	cfg      Config
+	store    Store
+	send     SendFunc
+	errorLog *log.Logger
+
+	jobs    chan models.MailMessage
+	wake    chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	running atomic.Bool
+}
+
+// New creates worker pool, call Start to run it
+func New(cfg Config, store Store, send SendFunc, errorLog *log.Logger) *Pool {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = time.Minute
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+
+	return &Pool{
+		cfg:      cfg,
+		store:    store,
+		send:     send,
+		errorLog: errorLog,
+		jobs:     make(chan models.MailMessage),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the dispatcher (reads outbox) and the workers (send messages)
+func (p *Pool) Start() {
+	p.running.Store(true)
+
+	p.wg.Add(1)
+	go p.dispatch()
+
+	for i := 0; i < p.cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+}
+
+// Stop waits until messages in progress are finished and stops all workers
+// Close the channel given to Listen first: Stop waits until everything left in it is stored in outbox
+func (p *Pool) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+// Running tells if dispatcher is working (Start was called, Stop was not)
+func (p *Pool) Running() bool {
+	return p.running.Load()
+}
+
+// Listen stores every message from channel in the outbox until the channel is closed
+// This keeps app.MailChan as the way to send email from any part of application
+func (p *Pool) Listen(mailChan <-chan models.MailData) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		for msg := range mailChan {
+			err := p.store.InsertMail(context.Background(), msg)
+			if err != nil {
+				p.errorLog.Println("Can't add email to outbox:", err)
+				continue
+			}
+			p.Wake()
+		}
+	}()
+}
+
+// Wake tells dispatcher to check outbox now instead of waiting for next poll
+func (p *Pool) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+		//dispatcher is already woken up
+	}
+}
+
+// dispatch claims due messages and hands them to workers
+func (p *Pool) dispatch() {
+	defer p.wg.Done()
+	defer close(p.jobs)
+	defer p.running.Store(false)
+
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		//Keep claiming while there is something to send
+		for {
+			messages, err := p.store.ClaimMail(context.Background(), p.cfg.Workers, p.cfg.Lease)
+			if err != nil {
+				p.errorLog.Println("Can't read mail outbox:", err)
+				break
+			}
+
+			for _, msg := range messages {
+				select {
+				case p.jobs <- msg:
+				case <-p.stop:
+					//Not sent messages will be claimed again after the lease
+					return
+				}
+			}
+
+			if len(messages) < p.cfg.Workers {
+				break
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-p.wake:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// work sends messages one by one
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for msg := range p.jobs {
+		p.process(msg)
+	}
+}
+
+// process makes one sending attempt and saves the result
+// Every attempt is a trace of its own: sending and saving of the result
+func (p *Pool) process(msg models.MailMessage) {
+	ctx, span := tracing.Start(context.Background(), "mail.send", trace.WithAttributes(
+		attribute.Int("mail.id", msg.ID),
+		attribute.Int("mail.attempt", msg.Attempts+1),
+	))
+	defer span.End()
+
+	//Result is saved only while the message is still ours (see UpdateMail)
+	claimedUntil := msg.NextAttemptAt
+
+	_, sendSpan := tracing.Start(ctx, "mail.deliver")
+	err := p.send(msg.MailData)
+	tracing.End(sendSpan, err)
+
+	msg.Attempts++
+
+	switch {
+	case err == nil:
+		msg.Status = models.MailSent
+		msg.SentAt = time.Now()
+		msg.LastError = ""
+		metrics.Emails.WithLabelValues("sent").Inc()
+	case msg.Attempts >= p.cfg.MaxAttempts:
+		msg.Status = models.MailDead
+		metrics.Emails.WithLabelValues("dead").Inc()
+		msg.LastError = err.Error()
+		p.errorLog.Printf("Email %d to %s failed %d times, giving up: %s", msg.ID, msg.MailData.To, msg.Attempts, err)
+	default:
+		msg.Status = models.MailPending
+		metrics.Emails.WithLabelValues("failed").Inc()
+		msg.NextAttemptAt = time.Now().Add(Backoff(msg.Attempts, p.cfg.RetryDelay, p.cfg.MaxDelay))
+		msg.LastError = err.Error()
+	}
+
+	span.SetAttributes(attribute.String("mail.status", msg.Status))
+
+	err = p.store.UpdateMail(ctx, msg, claimedUntil)
+	if err != nil {
+		p.errorLog.Println("Can't update email in outbox:", err)
+	}
+}
+
+// Backoff returns delay before next attempt: base, 2*base, 4*base ... but not more than max
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+
+	if d > max {
+		return max
+	}
+
+	return d
+}
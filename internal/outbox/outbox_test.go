@@ -0,0 +1,214 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+)
+
+// memStore is outbox kept in memory
+type memStore struct {
+	sync.Mutex
+	messages []models.MailMessage
+}
+
+func (s *memStore) InsertMail(ctx context.Context, m models.MailData) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.messages = append(s.messages, models.MailMessage{
+		ID:            len(s.messages) + 1,
+		MailData:      m,
+		Status:        models.MailPending,
+		NextAttemptAt: time.Now(),
+	})
+	return nil
+}
+
+func (s *memStore) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.MailMessage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var claimed []models.MailMessage
+	for i, m := range s.messages {
+		if len(claimed) == limit {
+			break
+		}
+		if (m.Status == models.MailPending || m.Status == models.MailSending) && !m.NextAttemptAt.After(time.Now()) {
+			s.messages[i].Status = models.MailSending
+			s.messages[i].NextAttemptAt = time.Now().Add(lease)
+			claimed = append(claimed, s.messages[i])
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memStore) UpdateMail(ctx context.Context, msg models.MailMessage, claimedUntil time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	//Same check as in postgres: message is still claimed by this worker
+	m := s.messages[msg.ID-1]
+	if m.Status != models.MailSending || !m.NextAttemptAt.Equal(claimedUntil) {
+		return errors.New("lease has expired")
+	}
+
+	s.messages[msg.ID-1] = msg
+	return nil
+}
+
+func (s *memStore) get(id int) models.MailMessage {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.messages[id-1]
+}
+
+// waitFor checks condition until it is true or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+var testConfig = Config{
+	Workers:      3,
+	MaxAttempts:  3,
+	RetryDelay:   time.Millisecond,
+	MaxDelay:     10 * time.Millisecond,
+	PollInterval: 5 * time.Millisecond,
+	Lease:        time.Minute,
+}
+
+func TestPoolSendsAllMessages(t *testing.T) {
+	store := &memStore{}
+
+	var mu sync.Mutex
+	sent := make(map[string]int)
+
+	p := New(testConfig, store, func(m models.MailData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent[m.To]++
+		return nil
+	}, log.New(io.Discard, "", 0))
+
+	mailChan := make(chan models.MailData)
+	p.Listen(mailChan)
+	p.Start()
+	defer p.Stop()
+
+	//Channel used to block after the first message, all of these must go through
+	recipients := []string{"a@here.ca", "b@here.ca", "c@here.ca", "d@here.ca", "e@here.ca"}
+	for _, to := range recipients {
+		mailChan <- models.MailData{To: to}
+	}
+	close(mailChan)
+
+	waitFor(t, "all messages", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == len(recipients)
+	})
+
+	for i := range recipients {
+		waitFor(t, "status sent", func() bool { return store.get(i+1).Status == models.MailSent })
+	}
+
+	for to, n := range sent {
+		if n != 1 {
+			t.Errorf("%s got %d messages", to, n)
+		}
+	}
+}
+
+func TestPoolRetriesAndDeadLetter(t *testing.T) {
+	store := &memStore{}
+	_ = store.InsertMail(context.Background(), models.MailData{To: "flaky@here.ca"})
+	_ = store.InsertMail(context.Background(), models.MailData{To: "broken@here.ca"})
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+
+	p := New(testConfig, store, func(m models.MailData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[m.To]++
+
+		//flaky works on second attempt, broken never works
+		if m.To == "flaky@here.ca" && attempts[m.To] == 2 {
+			return nil
+		}
+		return errors.New("connection refused")
+	}, log.New(io.Discard, "", 0))
+
+	p.Start()
+	defer p.Stop()
+
+	waitFor(t, "flaky sent", func() bool { return store.get(1).Status == models.MailSent })
+	waitFor(t, "broken dead", func() bool { return store.get(2).Status == models.MailDead })
+
+	flaky := store.get(1)
+	if flaky.Attempts != 2 || flaky.LastError != "" || flaky.SentAt.IsZero() {
+		t.Errorf("unexpected flaky message %+v", flaky)
+	}
+
+	broken := store.get(2)
+	if broken.Attempts != 3 || broken.LastError != "connection refused" {
+		t.Errorf("unexpected broken message %+v", broken)
+	}
+}
+
+func TestPoolKeepsResultOfNewClaim(t *testing.T) {
+	store := &memStore{}
+	_ = store.InsertMail(context.Background(), models.MailData{To: "slow@here.ca"})
+
+	//First worker's lease expires at once and another worker claims the message
+	first, _ := store.ClaimMail(context.Background(), 1, 0)
+	second, _ := store.ClaimMail(context.Background(), 1, time.Minute)
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatal("message was not claimed twice")
+	}
+
+	p := New(testConfig, store, func(m models.MailData) error {
+		return errors.New("timeout")
+	}, log.New(io.Discard, "", 0))
+
+	//Late result of the first worker must not overwrite the second claim
+	p.process(first[0])
+
+	got := store.get(1)
+	if got.Status != models.MailSending || got.Attempts != 0 || !got.NextAttemptAt.Equal(second[0].NextAttemptAt) {
+		t.Errorf("expired lease overwrote the message: %+v", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	var tests = []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{10, time.Hour},
+	}
+
+	for _, e := range tests {
+		got := Backoff(e.attempts, time.Minute, time.Hour)
+		if got != e.expected {
+			t.Errorf("attempt %d: expected %s but got %s", e.attempts, e.expected, got)
+		}
+	}
+}
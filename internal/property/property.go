@@ -0,0 +1,189 @@
+// Package property knows local time of the property: what day it is there, when guests can
+// arrive (check-in) and when they must leave (check-out)
+//
+// Days of stays (arrival, departure, owner blocks) are calendar days, not moments: they are kept as
+// midnight UTC, the same way database returns date columns and ParseDate reads them from forms.
+// Clock turns them into moments in time zone of the property (Arrival, Departure) and tells which
+// day is today there, so the result doesn't depend on time zone of the server.
+//
+// One deployment serves several properties (models.Property). Clock from configuration is the default one,
+// Clock.For gives clock of the property with its own settings.
+package property
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+
+	//Time zones are built into binary, the server may have no zoneinfo (e.g. scratch container)
+	_ "time/tzdata"
+)
+
+// DateLayout is the format of days in forms and URLs, e.g. "2050-01-31"
+const DateLayout = "2006-01-02"
+
+// Config holds settings of the property
+type Config struct {
+	TimeZone string // IANA time zone, e.g. "America/Halifax"
+	CheckIn  string // guests can arrive from this time, e.g. "15:00"
+	CheckOut string // guests must leave until this time, e.g. "11:00"
+}
+
+// Clock is local time of the property
+type Clock struct {
+	cfg      Config
+	location *time.Location
+	checkIn  time.Duration // since midnight
+	checkOut time.Duration
+	now      func() time.Time // time.Now, tests replace it
+}
+
+// NewClock checks cfg and creates clock of the property
+func NewClock(cfg Config) (*Clock, error) {
+	location, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("time zone %q: %w", cfg.TimeZone, err)
+	}
+
+	checkIn, err := timeOfDay(cfg.CheckIn)
+	if err != nil {
+		return nil, fmt.Errorf("check-in: %w", err)
+	}
+
+	checkOut, err := timeOfDay(cfg.CheckOut)
+	if err != nil {
+		return nil, fmt.Errorf("check-out: %w", err)
+	}
+
+	return &Clock{cfg: cfg, location: location, checkIn: checkIn, checkOut: checkOut, now: time.Now}, nil
+}
+
+// timeOfDay reads "15:04" as time since midnight
+func timeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("expected time of the day like 15:00, got %q", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// clocks keeps clocks of properties by their settings (see For), time zone is read only once
+var clocks sync.Map
+
+// For returns clock of property p. Settings p leaves empty are the ones of c (configuration)
+// c itself is returned when p has no settings of its own or they are wrong (they are checked when saved)
+func (c *Clock) For(p models.Property) *Clock {
+	cfg := Merge(p, c.cfg)
+	if cfg == c.cfg {
+		return c
+	}
+
+	if clock, ok := clocks.Load(cfg); ok {
+		return clock.(*Clock)
+	}
+
+	clock, err := NewClock(cfg)
+	if err != nil {
+		return c
+	}
+	clock.now = c.now
+
+	actual, _ := clocks.LoadOrStore(cfg, clock)
+	return actual.(*Clock)
+}
+
+// Merge returns settings of property p, the ones it leaves empty come from def
+func Merge(p models.Property, def Config) Config {
+	cfg := def
+
+	if p.TimeZone != "" {
+		cfg.TimeZone = p.TimeZone
+	}
+	if p.CheckIn != "" {
+		cfg.CheckIn = p.CheckIn
+	}
+	if p.CheckOut != "" {
+		cfg.CheckOut = p.CheckOut
+	}
+
+	return cfg
+}
+
+// Location returns time zone of the property
+func (c *Clock) Location() *time.Location {
+	return c.location
+}
+
+// Now returns current time in time zone of the property
+func (c *Clock) Now() time.Time {
+	return c.now().In(c.location)
+}
+
+// Today returns current day of the property (midnight UTC, like other days of stays)
+// Near midnight it can differ from the day of the server
+func (c *Clock) Today() time.Time {
+	return Date(c.Now())
+}
+
+// Arrival returns moment from which guests can check in on day
+func (c *Clock) Arrival(day time.Time) time.Time {
+	return c.at(day, c.checkIn)
+}
+
+// Departure returns moment until which guests must check out on day
+func (c *Clock) Departure(day time.Time) time.Time {
+	return c.at(day, c.checkOut)
+}
+
+// at returns moment on day at time of the day d in time zone of the property
+// time.Date handles days when clocks change (e.g. 02:30 that doesn't exist)
+func (c *Clock) at(day time.Time, d time.Duration) time.Time {
+	y, m, dd := day.Date()
+	return time.Date(y, m, dd, int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, c.location)
+}
+
+// Date returns calendar day of t (in location of t) as midnight UTC
+func Date(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// ParseDate reads day from form or URL ("2050-01-31")
+func ParseDate(s string) (time.Time, error) {
+	return time.Parse(DateLayout, s)
+}
+
+// Scope is what admin pages work with: the property chosen in the property switcher
+// and all properties the user manages
+type Scope struct {
+	Current    models.Property
+	Properties []models.Property
+}
+
+// Has tells if property with id is one of the user's properties
+func (s Scope) Has(id int) bool {
+	for _, p := range s.Properties {
+		if p.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+type contextKey struct{}
+
+// WithScope returns copy of ctx with properties of the user
+func WithScope(ctx context.Context, s Scope) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns properties of the user, empty Scope outside of admin area
+func FromContext(ctx context.Context) Scope {
+	s, _ := ctx.Value(contextKey{}).(Scope)
+	return s
+}
@@ -0,0 +1,141 @@
+package property
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+)
+
+func testClock(t *testing.T, now time.Time) *Clock {
+	c, err := NewClock(Config{TimeZone: "America/Halifax", CheckIn: "15:00", CheckOut: "11:30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.now = func() time.Time { return now }
+
+	return c
+}
+
+func TestNewClock(t *testing.T) {
+	var tests = []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"valid", Config{TimeZone: "Europe/Paris", CheckIn: "14:00", CheckOut: "10:00"}, true},
+		{"utc", Config{TimeZone: "UTC", CheckIn: "15:00", CheckOut: "11:00"}, true},
+		{"unknown zone", Config{TimeZone: "Mars/Olympus", CheckIn: "15:00", CheckOut: "11:00"}, false},
+		{"bad check-in", Config{TimeZone: "UTC", CheckIn: "3pm", CheckOut: "11:00"}, false},
+		{"bad check-out", Config{TimeZone: "UTC", CheckIn: "15:00", CheckOut: ""}, false},
+	}
+
+	for _, e := range tests {
+		_, err := NewClock(e.cfg)
+		if (err == nil) != e.ok {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+	}
+}
+
+func TestToday(t *testing.T) {
+	//It is still December 31 in Halifax (UTC-4) when it is January 1 in UTC
+	c := testClock(t, time.Date(2050, 1, 1, 2, 0, 0, 0, time.UTC))
+
+	today := c.Today()
+	if !today.Equal(time.Date(2049, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 2049-12-31 but got %s", today)
+	}
+
+	c = testClock(t, time.Date(2050, 1, 1, 5, 0, 0, 0, time.UTC))
+
+	today = c.Today()
+	if !today.Equal(time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 2050-01-01 but got %s", today)
+	}
+}
+
+func TestArrivalDeparture(t *testing.T) {
+	c := testClock(t, time.Now())
+
+	day, err := ParseDate("2050-07-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Summer time in Halifax is UTC-3
+	arrival := c.Arrival(day)
+	if !arrival.Equal(time.Date(2050, 7, 1, 18, 0, 0, 0, time.UTC)) || arrival.Format("15:04") != "15:00" {
+		t.Errorf("unexpected arrival %s", arrival)
+	}
+
+	departure := c.Departure(day)
+	if !departure.Equal(time.Date(2050, 7, 1, 14, 30, 0, 0, time.UTC)) || departure.Format("15:04") != "11:30" {
+		t.Errorf("unexpected departure %s", departure)
+	}
+
+	//Winter time is UTC-4
+	arrival = c.Arrival(time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC))
+	if !arrival.Equal(time.Date(2050, 1, 1, 19, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected arrival %s", arrival)
+	}
+}
+
+func TestDate(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Day is taken in location of the time, not in UTC
+	day := Date(time.Date(2050, 1, 1, 0, 30, 0, 0, paris))
+	if !day.Equal(time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 2050-01-01 but got %s", day)
+	}
+}
+
+func TestFor(t *testing.T) {
+	c := testClock(t, time.Now())
+
+	//Property without own settings uses the clock from configuration
+	if got := c.For(models.Property{ID: 1}); got != c {
+		t.Error("expected default clock for property without settings")
+	}
+
+	//Own time zone, check-in and check-out from configuration
+	paris := c.For(models.Property{ID: 2, TimeZone: "Europe/Paris"})
+	if paris.Location().String() != "Europe/Paris" {
+		t.Errorf("expected Europe/Paris but got %s", paris.Location())
+	}
+
+	day, _ := ParseDate("2050-07-01")
+	if got := paris.Departure(day).Format("15:04 MST"); got != "11:30 CEST" {
+		t.Errorf("expected 11:30 CEST but got %s", got)
+	}
+
+	//The same settings give the same clock
+	if c.For(models.Property{ID: 3, TimeZone: "Europe/Paris"}) != paris {
+		t.Error("expected clock from cache")
+	}
+
+	//Wrong settings fall back to configuration
+	if got := c.For(models.Property{ID: 4, TimeZone: "Mars/Olympus"}); got != c {
+		t.Error("expected default clock for wrong time zone")
+	}
+}
+
+func TestScope(t *testing.T) {
+	s := FromContext(context.Background())
+	if s.Has(1) {
+		t.Error("expected empty scope outside of admin area")
+	}
+
+	s = Scope{Current: models.Property{ID: 2}, Properties: []models.Property{{ID: 1}, {ID: 2}}}
+	s = FromContext(WithScope(context.Background(), s))
+
+	if s.Current.ID != 2 || !s.Has(1) || s.Has(3) {
+		t.Errorf("unexpected scope %+v", s)
+	}
+}
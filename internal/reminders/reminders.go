@@ -0,0 +1,242 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
+	"github.com/victorluk72/booking/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config holds settings of scheduled guest emails
+type Config struct {
+	ArrivalDays      int    // reminder is sent this many days before arrival (0 switches it off)
+	ArrivalTemplate  string // email template of the reminder (see email-templates)
+	FollowUpDays     int    // follow-up is sent this many days after departure (0 switches it off)
+	FollowUpTemplate string
+	RunAt            string // time of the day when scheduler runs, e.g. "09:00"
+	AssignDays       int    // rooms are assigned to bookings arriving in this many days (0 leaves it to staff)
+}
+
+// How many days late follow-up is still sent (e.g. application was stopped for a few days)
+const followUpCatchUp = 7
+
+// Store is the part of repository that scheduler needs (postgresDBRepo implements it)
+type Store interface {
+	AllProperties(ctx context.Context) ([]models.Property, error)
+	ReservationsForReminder(ctx context.Context, propertyID int, kind string, from, to time.Time) ([]models.Reservation, error)
+	InsertReminderWithMail(ctx context.Context, reservationID int, kind string, mail models.MailData) (bool, error)
+	AssignRooms(ctx context.Context, propertyID int, from, to time.Time) (int, error)
+}
+
+// BuildFunc makes email from template (emails.Message)
+type BuildFunc func(to, name string, data interface{}) (models.MailData, error)
+
+// SMSFunc queues text message from template for the guest who opted in (sms.Notifier.Reservation)
+type SMSFunc func(res models.Reservation, name string, data interface{}) error
+
+// Scheduler sends reminders once a day
+type Scheduler struct {
+	cfg      Config
+	clock    *property.Clock
+	store    Store
+	build    BuildFunc
+	sms      SMSFunc
+	infoLog  *log.Logger
+	errorLog *log.Logger
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates scheduler, call Start to run it every day or Run for one pass
+// clock is the default one (configuration), RunAt is in its time zone and every property gets its own day from it.
+// Text messages use SMS templates with the same names as email templates, sms can be nil (no text messages)
+func New(cfg Config, clock *property.Clock, store Store, build BuildFunc, sms SMSFunc, infoLog, errorLog *log.Logger) *Scheduler {
+	return &Scheduler{
+		cfg:      cfg,
+		clock:    clock,
+		store:    store,
+		build:    build,
+		sms:      sms,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run queues reminders that are due today and returns how many were queued
+// Every property has its own today (time zones differ), day that isn't zero is today for all of them (-date of cmd/reminders).
+// Emails go to mail outbox, the same reminder is never queued twice
+// Property that fails is logged and skipped, errors of all properties are returned together
+func (s *Scheduler) Run(ctx context.Context, day time.Time) (count int, err error) {
+	ctx, span := tracing.Start(ctx, "reminders.run")
+	defer func() {
+		span.SetAttributes(attribute.Int("reminders.queued", count))
+		tracing.End(span, err)
+	}()
+
+	properties, err := s.store.AllProperties(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("reminders: %w", err)
+	}
+
+	var errs []error
+
+	for _, p := range properties {
+		today := property.Date(day)
+		if day.IsZero() {
+			today = s.clock.For(p).Today()
+		}
+
+		//One broken property must not leave guests of the others without reminders
+		n, err := s.runProperty(ctx, p.ID, today)
+		count += n
+		if err != nil {
+			err = fmt.Errorf("property %d: %w", p.ID, err)
+			s.errorLog.Println("Reminders:", err)
+			errs = append(errs, err)
+		}
+	}
+
+	return count, errors.Join(errs...)
+}
+
+// runProperty queues reminders of one property that are due on today (day of the property)
+func (s *Scheduler) runProperty(ctx context.Context, propertyID int, today time.Time) (count int, err error) {
+	ctx, span := tracing.Start(ctx, "reminders.property", trace.WithAttributes(
+		attribute.Int("property.id", propertyID),
+		attribute.String("reminders.day", today.Format(property.DateLayout))))
+	defer func() {
+		span.SetAttributes(attribute.Int("reminders.queued", count))
+		tracing.End(span, err)
+	}()
+
+	//Guests book type of room, they get the room itself before arrival (reminder then tells which one).
+	//Bookings left without room (no free room of the type) are on the calendar for staff, reminders still go
+	if s.cfg.AssignDays > 0 {
+		assigned, err := s.store.AssignRooms(ctx, propertyID, today, today.AddDate(0, 0, s.cfg.AssignDays))
+		span.SetAttributes(attribute.Int("reminders.rooms_assigned", assigned))
+		if err != nil {
+			s.errorLog.Printf("Assigning rooms of property %d: %v", propertyID, err)
+		}
+	}
+
+	//Everybody who arrives in next ArrivalDays days (reservation can be made after the exact day passed)
+	if s.cfg.ArrivalDays > 0 {
+		n, err := s.send(ctx, propertyID, models.ReminderArrival, s.cfg.ArrivalTemplate, s.cfg.ArrivalDays,
+			today, today.AddDate(0, 0, s.cfg.ArrivalDays))
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+
+	//Everybody who left FollowUpDays days ago (or a few days before that, if we missed them)
+	if s.cfg.FollowUpDays > 0 {
+		last := today.AddDate(0, 0, -s.cfg.FollowUpDays)
+		n, err := s.send(ctx, propertyID, models.ReminderFollowUp, s.cfg.FollowUpTemplate, s.cfg.FollowUpDays,
+			last.AddDate(0, 0, -followUpCatchUp), last)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// send queues one kind of reminder for reservations of the property between from and to
+func (s *Scheduler) send(ctx context.Context, propertyID int, kind, template string, days int, from, to time.Time) (int, error) {
+	reservations, err := s.store.ReservationsForReminder(ctx, propertyID, kind, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("%s reminders: %w", kind, err)
+	}
+
+	count := 0
+
+	for _, res := range reservations {
+		data := map[string]interface{}{
+			"Reservation": res,
+			"Days":        days,
+			"Locale":      res.Locale, // language guest booked in
+			"Property":    res.RoomType.Property,
+		}
+
+		msg, err := s.build(res.Email, template, data)
+		if err != nil {
+			return count, fmt.Errorf("%s reminders: %w", kind, err)
+		}
+
+		queued, err := s.store.InsertReminderWithMail(ctx, res.ID, kind, msg)
+		if err != nil {
+			return count, fmt.Errorf("%s reminders: %w", kind, err)
+		}
+
+		if !queued {
+			continue
+		}
+
+		count++
+
+		//Text message goes only once too (together with the email), its failure doesn't stop the others
+		if s.sms != nil {
+			err = s.sms(res, template, data)
+			if err != nil {
+				s.errorLog.Printf("%s reminder SMS for reservation %d: %v", kind, res.ID, err)
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// Start runs the scheduler now (to catch up after restart) and then every day at RunAt
+func (s *Scheduler) Start() {
+	go func() {
+		defer close(s.done)
+
+		for {
+			n, err := s.Run(context.Background(), time.Time{})
+			if err != nil {
+				s.errorLog.Println("Reminders:", err)
+			} else {
+				s.infoLog.Println("Reminders queued:", n)
+			}
+
+			timer := time.NewTimer(time.Until(NextRun(s.clock.Now(), s.cfg.RunAt)))
+
+			select {
+			case <-timer.C:
+			case <-s.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler started with Start
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// NextRun returns next time after now when clock shows runAt ("15:04" format, invalid means midnight)
+func NextRun(now time.Time, runAt string) time.Time {
+	t, _ := time.Parse("15:04", runAt)
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
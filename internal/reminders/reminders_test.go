@@ -0,0 +1,309 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
+)
+
+// memStore keeps reservations and sent reminders in memory
+type memStore struct {
+	properties   []models.Property
+	reservations []models.Reservation
+	sent         map[string]bool
+	mail         []models.MailData
+	assigned     map[int]time.Time // first day rooms were assigned from, by property
+	broken       int               // reservations of this property can't be read
+}
+
+func (s *memStore) AllProperties(ctx context.Context) ([]models.Property, error) {
+	return s.properties, nil
+}
+
+func (s *memStore) ReservationsForReminder(ctx context.Context, propertyID int, kind string, from, to time.Time) ([]models.Reservation, error) {
+	var found []models.Reservation
+
+	if propertyID == s.broken {
+		return nil, errors.New("connection reset")
+	}
+
+	for _, r := range s.reservations {
+		if r.RoomType.PropertyID != propertyID {
+			continue
+		}
+
+		d := r.StartDate
+		if kind == models.ReminderFollowUp {
+			d = r.EndDate
+		}
+
+		if !d.Before(from) && !d.After(to) && !s.sent[fmt.Sprintf("%d-%s", r.ID, kind)] {
+			found = append(found, r)
+		}
+	}
+
+	return found, nil
+}
+
+func (s *memStore) InsertReminderWithMail(ctx context.Context, reservationID int, kind string, mail models.MailData) (bool, error) {
+	key := fmt.Sprintf("%d-%s", reservationID, kind)
+	if s.sent[key] {
+		return false, nil
+	}
+
+	s.sent[key] = true
+	s.mail = append(s.mail, mail)
+	return true, nil
+}
+
+// AssignRooms gives room 1 to reservations of the property arriving between from and to
+func (s *memStore) AssignRooms(ctx context.Context, propertyID int, from, to time.Time) (int, error) {
+	s.assigned[propertyID] = from
+
+	count := 0
+
+	for i, r := range s.reservations {
+		if r.RoomType.PropertyID == propertyID && r.RoomID == 0 && !r.StartDate.Before(from) && !r.StartDate.After(to) {
+			s.reservations[i].RoomID = 1
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// build returns email with template name as subject
+func build(to, name string, data interface{}) (models.MailData, error) {
+	return models.MailData{To: to, Subject: name}, nil
+}
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+var testConfig = Config{
+	ArrivalDays:      2,
+	ArrivalTemplate:  "arrival-reminder",
+	FollowUpDays:     1,
+	FollowUpTemplate: "follow-up",
+	RunAt:            "09:00",
+}
+
+// reservation of property 1
+func reservation(id int, email, start, end string) models.Reservation {
+	return models.Reservation{ID: id, Email: email, StartDate: date(start), EndDate: date(end),
+		RoomType: models.RoomType{PropertyID: 1}}
+}
+
+func newStore() *memStore {
+	return &memStore{
+		properties: []models.Property{{ID: 1}},
+		sent:       make(map[string]bool),
+		assigned:   make(map[int]time.Time),
+		reservations: []models.Reservation{
+			reservation(1, "soon@here.ca", "2050-01-12", "2050-01-14"),
+			reservation(2, "later@here.ca", "2050-01-20", "2050-01-22"),
+			reservation(3, "left@here.ca", "2050-01-05", "2050-01-09"),
+			reservation(4, "long-ago@here.ca", "2049-12-01", "2049-12-03"),
+		},
+	}
+}
+
+// testClock is the default clock of configuration
+func testClock(t *testing.T) *property.Clock {
+	clock, err := property.NewClock(property.Config{TimeZone: "UTC", CheckIn: "15:00", CheckOut: "11:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return clock
+}
+
+func TestRun(t *testing.T) {
+	store := newStore()
+	s := New(testConfig, testClock(t), store, build, nil, nil, nil)
+
+	n, err := s.Run(context.Background(), date("2050-01-10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 || len(store.mail) != 2 {
+		t.Fatalf("expected 2 reminders but got %d", n)
+	}
+
+	if store.mail[0].To != "soon@here.ca" || store.mail[0].Subject != "arrival-reminder" {
+		t.Errorf("unexpected arrival reminder %+v", store.mail[0])
+	}
+
+	if store.mail[1].To != "left@here.ca" || store.mail[1].Subject != "follow-up" {
+		t.Errorf("unexpected follow-up %+v", store.mail[1])
+	}
+
+	//Second run on the same day sends nothing
+	n, _ = s.Run(context.Background(), date("2050-01-10"))
+	if n != 0 {
+		t.Errorf("expected no reminders on second run but got %d", n)
+	}
+
+	//Next day (missed days are caught up, but nothing is sent twice)
+	n, _ = s.Run(context.Background(), date("2050-01-11"))
+	if n != 0 {
+		t.Errorf("expected no reminders next day but got %d", n)
+	}
+}
+
+func TestRunAssignsRooms(t *testing.T) {
+	store := newStore()
+
+	cfg := testConfig
+	cfg.AssignDays = 3
+
+	_, err := New(cfg, testClock(t), store, build, nil, nil, nil).Run(context.Background(), date("2050-01-10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Only reservation arriving in next 3 days gets room
+	for _, r := range store.reservations {
+		if assigned := r.RoomID != 0; assigned != (r.ID == 1) {
+			t.Errorf("reservation %d: unexpected room %d", r.ID, r.RoomID)
+		}
+	}
+}
+
+func TestRunPerProperty(t *testing.T) {
+	store := newStore()
+
+	//Property 2 has guests too, they get reminders from their property only once
+	other := reservation(5, "other@here.ca", "2050-01-11", "2050-01-13")
+	other.RoomType.PropertyID = 2
+	store.reservations = append(store.reservations, other)
+	store.properties = append(store.properties, models.Property{ID: 2})
+
+	n, err := New(testConfig, testClock(t), store, build, nil, nil, nil).Run(context.Background(), date("2050-01-10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Errorf("expected 3 reminders but got %d", n)
+	}
+}
+
+func TestRunSkipsBrokenProperty(t *testing.T) {
+	store := newStore()
+
+	//Property 1 fails, guest of property 2 still gets the reminder
+	other := reservation(5, "other@here.ca", "2050-01-11", "2050-01-13")
+	other.RoomType.PropertyID = 2
+	store.reservations = append(store.reservations, other)
+	store.properties = append(store.properties, models.Property{ID: 2})
+	store.broken = 1
+
+	var logged bytes.Buffer
+	n, err := New(testConfig, testClock(t), store, build, nil, nil, log.New(&logged, "", 0)).Run(context.Background(), date("2050-01-10"))
+
+	if n != 1 || len(store.mail) != 1 || store.mail[0].To != "other@here.ca" {
+		t.Errorf("expected reminder of property 2 only but got %d: %v", n, store.mail)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "property 1") {
+		t.Errorf("expected error of property 1 but got %v", err)
+	}
+
+	if !strings.Contains(logged.String(), "property 1") {
+		t.Errorf("error of property 1 wasn't logged: %q", logged.String())
+	}
+}
+
+func TestRunPropertyToday(t *testing.T) {
+	store := newStore()
+
+	//Kiritimati is 25 hours ahead of Pago Pago, so it is always a later day there
+	store.properties = []models.Property{
+		{ID: 1, TimeZone: "Pacific/Kiritimati"},
+		{ID: 2, TimeZone: "Pacific/Pago_Pago"},
+	}
+
+	cfg := testConfig
+	cfg.AssignDays = 1
+
+	_, err := New(cfg, testClock(t), store, build, nil, nil, nil).Run(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !store.assigned[1].After(store.assigned[2]) {
+		t.Errorf("expected each property its own today, got %s and %s",
+			store.assigned[1].Format("2006-01-02"), store.assigned[2].Format("2006-01-02"))
+	}
+}
+
+func TestRunDisabled(t *testing.T) {
+	store := newStore()
+
+	cfg := testConfig
+	cfg.ArrivalDays = 0
+	cfg.FollowUpDays = 0
+
+	n, err := New(cfg, testClock(t), store, build, nil, nil, nil).Run(context.Background(), date("2050-01-10"))
+	if err != nil || n != 0 {
+		t.Errorf("expected nothing but got %d (%v)", n, err)
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	var tests = []struct {
+		now      string
+		runAt    string
+		expected string
+	}{
+		{"2050-01-10 08:00", "09:00", "2050-01-10 09:00"},
+		{"2050-01-10 09:00", "09:00", "2050-01-11 09:00"},
+		{"2050-01-10 23:30", "09:00", "2050-01-11 09:00"},
+		{"2050-01-31 10:00", "06:15", "2050-02-01 06:15"},
+	}
+
+	for _, e := range tests {
+		now, _ := time.Parse("2006-01-02 15:04", e.now)
+
+		got := NextRun(now, e.runAt).Format("2006-01-02 15:04")
+		if got != e.expected {
+			t.Errorf("%s at %s: expected %s but got %s", e.now, e.runAt, e.expected, got)
+		}
+	}
+}
+
+func TestRunSMS(t *testing.T) {
+	store := newStore()
+
+	var texts []string
+	sms := func(res models.Reservation, name string, data interface{}) error {
+		texts = append(texts, fmt.Sprintf("%d %s", res.ID, name))
+		return nil
+	}
+
+	s := New(testConfig, testClock(t), store, build, sms, nil, nil)
+
+	_, err := s.Run(context.Background(), date("2050-01-10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Once per queued reminder, with the same template as email
+	_, _ = s.Run(context.Background(), date("2050-01-10"))
+
+	if strings.Join(texts, ",") != "1 arrival-reminder,3 follow-up" {
+		t.Errorf("unexpected text messages %v", texts)
+	}
+}
@@ -0,0 +1,96 @@
+package render
+
+import (
+	"html/template"
+	"net/http"
+	"sync"
+)
+
+// Templates of development mode (server.cache=false): parsed on first use and then again by Reload,
+// when template files change (see package livereload)
+var dev struct {
+	sync.Mutex
+	loaded bool
+	tc     map[string]*template.Template
+	err    error
+}
+
+// Reload parses templates again, parse error is shown in browser until templates are fixed
+func Reload() error {
+	tc, err := CreateTemplateCache()
+
+	dev.Lock()
+	defer dev.Unlock()
+
+	dev.loaded = true
+	dev.tc, dev.err = tc, err
+
+	return err
+}
+
+// devTemplates returns templates of development mode and error of the last parsing
+func devTemplates() (map[string]*template.Template, error) {
+	dev.Lock()
+	loaded := dev.loaded
+	dev.Unlock()
+
+	if !loaded {
+		Reload()
+	}
+
+	dev.Lock()
+	defer dev.Unlock()
+
+	return dev.tc, dev.err
+}
+
+// Page with parse error over the whole window, it can't use our layouts (they may be the broken ones)
+// With live reload it goes away by itself when the file is fixed and saved
+var overlayTemplate = template.Must(template.New("overlay").Parse(`<!doctype html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>Template error</title>
+    <style>
+        body { margin: 0; background: rgba(0, 0, 0, .85); color: #e8e8e8; font-family: Menlo, Consolas, monospace; }
+        .overlay { position: fixed; inset: 0; padding: 2rem 3rem; overflow: auto; }
+        h1 { color: #ff5555; font-size: 1.4rem; }
+        pre { background: #1e1e1e; border-left: 4px solid #ff5555; padding: 1rem; white-space: pre-wrap; font-size: 1rem; }
+        p { color: #aaa; }
+    </style>
+</head>
+<body>
+<div class="overlay">
+    <h1>Templates don't parse</h1>
+    <pre>{{.Error}}</pre>
+    {{if .LiveReload}}
+    <p>Fix the template and save it, this page reloads by itself.</p>
+    <script>
+        new EventSource("/dev/reload").onmessage = function (e) {
+            if (e.data !== "{{.LiveReload}}") { location.reload(); }
+        };
+    </script>
+    {{else}}
+    <p>Fix the template and reload the page.</p>
+    {{end}}
+</div>
+</body>
+</html>
+`))
+
+// overlay writes page with parse error of templates (development only, production uses parsed cache)
+func overlay(w http.ResponseWriter, err error) error {
+	data := struct {
+		Error      string
+		LiveReload string
+	}{Error: err.Error()}
+
+	if app.LiveReload != nil {
+		data.LiveReload = app.LiveReload.Version()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+
+	return overlayTemplate.Execute(w, data)
+}
@@ -2,39 +2,51 @@ package render
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
-	"log"
+	"html/template"
+	"io/fs"
 	"net/http"
-	"path/filepath"
-	"text/template"
+	"path"
 	"time"
 
 	"github.com/justinas/nosurf"
 	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/logging"
 	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
+	"github.com/victorluk72/booking/internal/tracing"
 )
 
 // Define var "functions". We will use it to allow our custom functions in templates
 // These will be custom functions for tempaltes (in future)
 // You can define your functions in this module and pass it to templates
+// Functions return plain values, html/template escapes them like any other value (don't return template.HTML
+// built from user input)
 var functions = template.FuncMap{
 	"humanDate":  HumaneDate,
 	"formatDate": FormatDate,
 	"iterate":    Iterate,
 	"addInt":     AddInt,
+
+	//Texts, dates and numbers in language of the page, e.g. {{t .Locale "Arrival"}}, {{date .Locale $res.StartDate "long"}}
+	"t":      i18n.T,
+	"date":   i18n.Date,
+	"number": i18n.Number,
+	"time":   i18n.Time,
+
+	//Check-in on arrival day and check-out on departure day of reservation, in time zone of its property: {{time .Locale (arrival $res)}}
+	"arrival": func(res models.Reservation) time.Time {
+		return app.Clock.For(res.RoomType.Property).Arrival(res.StartDate)
+	},
+	"departure": func(res models.Reservation) time.Time {
+		return app.Clock.For(res.RoomType.Property).Departure(res.EndDate)
+	},
 }
 
 // This variable is a pointer to my site-wide config package
 var app *config.AppConfig
 
-// This is variable to store patch to templates
-// This is sfor Windows
-//var pathToTemplates = "../../templates"
-
-//This si for Linux
-var pathToTemplates = "./templates"
-
 // NewRenderer sets the config for tempalte package
 func NewRenderer(a *config.AppConfig) {
 	app = a
@@ -96,12 +108,39 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 		td.IsAuth = true
 	}
 
+	//Language of the page (see Locale middleware) and languages for the menu
+	td.Locale = i18n.FromContext(r.Context())
+	td.Languages = i18n.Languages()
+
+	//Property switcher of admin pages (see handlers.PropertyScope)
+	scope := property.FromContext(r.Context())
+	td.Property = scope.Current
+	td.Properties = scope.Properties
+
+	//In development emails are caught and can be seen in admin area
+	td.DevMail = app.MailCatcher != nil
+
+	//In development page reloads itself when templates or static files change
+	if app.LiveReload != nil {
+		td.LiveReload = app.LiveReload.Version()
+	}
+
 	return td
 }
 
 // RenderTemplate renders the template and pass it to http.Response writer
 // it accepts 4 arguments: http.ResponseWriter, http Request, name of tempalte (templ string) and td (data for template)
 func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.TemplateData) error {
+	return TemplateStatus(w, r, http.StatusOK, tmpl, td)
+}
+
+// TemplateStatus renders the template with HTTP status code (e.g. 404 for error page)
+// Nothing is written when template fails, so caller can still send another response (500 page)
+func TemplateStatus(w http.ResponseWriter, r *http.Request, status int, tmpl string, td *models.TemplateData) error {
+
+	//Rendering is a span of request trace (see package tracing)
+	_, span := tracing.StartChild(r.Context(), "render "+tmpl)
+	defer span.End()
 
 	//If you in production mode don't use template cache, rebuild it with every request
 	var tc map[string]*template.Template
@@ -113,19 +152,31 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 		tc = app.TemplateCache
 
 	} else {
-		// This will ignore tempalte cache and rebuld tempalte cache from disc every time
+		// Templates are parsed again only when files change (see Reload)
+		// Page that doesn't parse shows the error over the page instead of blank page
 		// This is for development mode
-		tc, _ = CreateTemplateCache()
+		var err error
+		tc, err = devTemplates()
+		if err != nil {
+			logging.FromRequest(r).Error("parse templates", "error", err)
+
+			//Overlay is the response, caller has nothing more to send
+			err = overlay(w, err)
+			if err != nil {
+				logging.FromRequest(r).Warn("write template error overlay", "error", err)
+			}
+			return nil
+		}
 
 	}
 
 	//Pull individual template from my cache of tempaltes
 	//if exist run it, otherwise error
 	t, ok := tc[tmpl]
-	fmt.Println("THIS IS MY TEMPLATE:", t)
 	if !ok {
-		log.Fatal("Couldn't get template from tempalte cache")
-		return errors.New("Can't get template from cache")
+		err := fmt.Errorf("can't get template %q from cache", tmpl)
+		logging.FromRequest(r).Error("render template", "template", tmpl, "error", err)
+		return err
 	}
 
 	//Create a bytes buffer to hold the template
@@ -134,13 +185,19 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 	//This is to add defauld set of data to tempalte data
 	td = AddDefaultData(td, r)
 
-	//Execute template from buffer, pass td (tempalte data)
-	_ = t.Execute(buf, td)
+	//Execute template into buffer, pass td (tempalte data)
+	//Half rendered page is not sent to browser
+	err := t.Execute(buf, td)
+	if err != nil {
+		logging.FromRequest(r).Error("render template", "template", tmpl, "error", err)
+		return err
+	}
 
 	//Write from buffer to responce writer(this basically show content)
-	_, err := buf.WriteTo(w)
+	w.WriteHeader(status)
+	_, err = buf.WriteTo(w)
 	if err != nil {
-		fmt.Println("Error writing template to browser")
+		logging.FromRequest(r).Warn("write template to browser", "template", tmpl, "error", err)
 		return err
 	}
 
@@ -150,38 +207,44 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 
 // CreateTemplateCache is to define map that would hold all template files
 // from "template" directory index would be a file name and value is pointer to rendered tempalte
+// Templates are read from app.Assets (built into binary, or from disk with server.assets_dir)
 // INPORTANT: Using this map with cache prevent from reading templates from disk ever time when page loaded
 // instead we read if from "in memory" cache - increase speed dramatically!
 func CreateTemplateCache() (map[string]*template.Template, error) {
+	return TemplateCacheFS(app.Assets.Templates)
+}
+
+// TemplateCacheFS builds template cache from pages and layouts in fsys
+func TemplateCacheFS(fsys fs.FS) (map[string]*template.Template, error) {
 
 	// This is to hold all tempaltes as a map - pointing to template addresses
 	// Index in this map is tempalte name and value is pointer to template
 	myCache := map[string]*template.Template{}
 
-	//This give you list of all full path to files that have "page.html" in the file name
-	pages, err := filepath.Glob(fmt.Sprintf("%s/*.page.html", pathToTemplates))
+	//This give you list of all files that have "page.html" in the file name
+	pages, err := fs.Glob(fsys, "*.page.html")
 	if err != nil {
 		return myCache, err
 	}
 
 	for _, page := range pages {
 		//this is extact file name only from pages
-		name := filepath.Base(page)
+		name := path.Base(page)
 
 		//This is a tempalte set (ts)  (all tempaltes)
-		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
+		ts, err := template.New(name).Funcs(functions).ParseFS(fsys, page)
 		if err != nil {
 			return myCache, err
 		}
 
 		//Check for base.layout.html files in templates folder
-		matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.html", pathToTemplates))
+		matches, err := fs.Glob(fsys, "*.layout.html")
 		if err != nil {
 			return myCache, err
 		}
 
 		if len(matches) > 0 {
-			ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.html", pathToTemplates))
+			ts, err = ts.ParseFS(fsys, "*.layout.html")
 			if err != nil {
 				return myCache, err
 			}
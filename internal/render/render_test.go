@@ -2,8 +2,12 @@ package render
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/victorluk72/booking/internal/forms"
 	"github.com/victorluk72/booking/internal/models"
 )
 
@@ -28,8 +32,6 @@ func TestAddDefaultData(t *testing.T) {
 
 func TestRenderTemplate(t *testing.T) {
 
-	pathToTemplates = "../../templates"
-
 	//Create template cache
 	tc, err := CreateTemplateCache()
 	if err != nil {
@@ -49,21 +51,122 @@ func TestRenderTemplate(t *testing.T) {
 	//This is artificialy created type that satisfy inteface of http.ResponseWriter
 	var rw myWriter
 
-	err = RenderTemplate(&rw, r, "home.page.html", &models.TemplateData{})
+	err = Template(&rw, r, "home.page.html", &models.TemplateData{})
 	if err != nil {
 		t.Error("Error writing template to browser")
 	}
 
-	// err = RenderTemplate(&rw, r, "wrong.page.html", &models.TemplateData{})
-	// if err == nil {
-	// 	t.Error("Got template that doesn't exist")
-	// }
+	err = Template(&rw, r, "wrong.page.html", &models.TemplateData{})
+	if err == nil {
+		t.Error("Got template that doesn't exist")
+	}
 
 }
 
-func TestCreateTemplateCache(t *testing.T) {
-	pathToTemplates = "../../templates"
+func TestTemplateEscaping(t *testing.T) {
+	tc, err := CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.TemplateCache = tc
+
+	//Guest can put anything into reservation form, admin pages must show it as text
+	payload := `"><script>alert(1)</script>`
+	res := models.Reservation{
+		ID:        1,
+		FirstName: payload,
+		LastName:  "<img src=x onerror=alert(2)>",
+		Email:     payload,
+		Phone:     payload,
+		RoomID:    1,
+		Room:      models.Room{RoomName: "<script>alert(3)</script>"},
+		RoomType:  models.RoomType{Name: "<script>alert(4)</script>"},
+
+		ArrivalNotes: "<script>alert(5)</script>",
+	}
+
+	var tests = []struct {
+		name string
+		tmpl string
+		data map[string]interface{}
+	}{
+		{"admin-reservation", "admin-reservation.page.html", map[string]interface{}{"reservation": res}},
+		{"reservations-all", "reservations-all.page.html", map[string]interface{}{"reservations": []models.Reservation{res}}},
+		{"reservations-new", "reservations-new.page.html", map[string]interface{}{"reservations": []models.Reservation{res}}},
+		{"front-desk", "admin-front-desk.page.html", map[string]interface{}{"today": res.StartDate, "arrivals": []models.Reservation{res}, "staying": []models.Reservation{res}}},
+		{"housekeeping", "admin-housekeeping.page.html", map[string]interface{}{"today": res.StartDate, "labels": map[string]string{},
+			"tasks": []models.HousekeepingTask{{Room: models.Room{RoomName: payload, RoomType: res.RoomType}}}}},
+	}
+
+	for _, e := range tests {
+		r, err := getSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		err = Template(rr, r, e.tmpl, &models.TemplateData{Data: e.data, StringMap: map[string]string{"src": "all"}, Form: forms.New(nil)})
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+
+		body := rr.Body.String()
+		if strings.Contains(body, "<script>alert") || strings.Contains(body, "<img src=x") {
+			t.Errorf("%s: payload is not escaped", e.name)
+		}
+
+		if !strings.Contains(body, "&lt;script&gt;alert(") {
+			t.Errorf("%s: escaped payload is not shown", e.name)
+		}
+	}
+}
+
+func TestReloadOverlay(t *testing.T) {
+
+	//Development mode: templates are parsed again only by Reload
+	good := app.Assets.Templates
+	app.UseCache = false
+	defer func() {
+		app.Assets.Templates = good
+		Reload()
+	}()
+
+	app.Assets.Templates = fstest.MapFS{"home.page.html": {Data: []byte(`<p>{{.Flash}</p>`)}}
+	if Reload() == nil {
+		t.Fatal("expected parse error")
+	}
+
+	r, err := getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Error is shown over the page instead of blank page
+	rr := httptest.NewRecorder()
+	err = Template(rr, r, "home.page.html", &models.TemplateData{})
+	if err != nil {
+		t.Error(err)
+	}
 
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "home.page.html") {
+		t.Errorf("expected overlay with parse error, got %d:\n%s", rr.Code, rr.Body.String())
+	}
+
+	//Fixed template is used after reload
+	app.Assets.Templates = fstest.MapFS{"home.page.html": {Data: []byte(`<p>{{.Flash}}</p>`)}}
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	err = Template(rr, r, "home.page.html", &models.TemplateData{})
+	if err != nil || rr.Code != http.StatusOK {
+		t.Errorf("expected page after fix, got %d (%v)", rr.Code, err)
+	}
+}
+
+func TestCreateTemplateCache(t *testing.T) {
 	_, err := CreateTemplateCache()
 	if err != nil {
 		t.Error("Error creating template cache")
@@ -3,14 +3,19 @@ package render
 import (
 	"encoding/gob"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/victorluk72/booking"
 	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/logging"
 	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/property"
 )
 
 //variable to have ability to test render template logic
@@ -23,12 +28,21 @@ func TestMain(m *testing.M) {
 	//Change these to "true" when in Production
 	testApp.InProduction = false
 
-	//Define new INFO and ERROR logger and make it avaialble for whole application (vial app.Infolog)
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	testApp.InfoLog = infoLog
+	//Templates built into binary, the same as in production
+	testApp.Assets = booking.Embedded()
 
-	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	testApp.ErrorLog = errorLog
+	testApp.Clock, _ = property.NewClock(property.Config{TimeZone: "America/Halifax", CheckIn: "15:00", CheckOut: "11:00"})
+
+	//Translations, the same as in production
+	err := i18n.Load(testApp.Assets.Locales)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	//Structured logger, the same as in main (text format)
+	testApp.Logger = logging.New(os.Stdout, "text", slog.LevelInfo)
+	testApp.InfoLog = slog.NewLogLogger(testApp.Logger.Handler(), slog.LevelInfo)
+	testApp.ErrorLog = slog.NewLogLogger(testApp.Logger.Handler(), slog.LevelError)
 
 	//----Session managment-----------------------
 	session = scs.New()
@@ -1,10 +1,14 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	"github.com/victorluk72/booking/internal/config"
+	"github.com/victorluk72/booking/internal/metrics"
 	"github.com/victorluk72/booking/internal/repository"
+	"github.com/victorluk72/booking/internal/tracing"
 )
 
 type postgresDBRepo struct {
@@ -12,9 +16,38 @@ type postgresDBRepo struct {
 	DB  *sql.DB
 }
 
+// testDBRepo is a repository for tests, it doesn't talk to any database
+type testDBRepo struct {
+	App *config.AppConfig
+	DB  *sql.DB
+}
+
 func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
 	return &postgresDBRepo{
 		App: a,
 		DB:  conn,
 	}
 }
+
+// NewTestingRepo creates repository for tests (see handlers setup_test.go)
+func NewTestingRepo(a *config.AppConfig) repository.DatabaseRepo {
+	return &testDBRepo{
+		App: a,
+	}
+}
+
+// startQuery starts span of repository method, returned done func ends it with error of the method
+// (span is marked as failed) and records latency. Method names its error result and passes it to done:
+//
+//	func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (_ models.Room, err error) {
+//		ctx, done := startQuery(ctx, "GetRoomByID")
+//		defer func() { done(err) }()
+func startQuery(ctx context.Context, method string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.StartDB(ctx, method)
+
+	return ctx, func(err error) {
+		tracing.End(span, err)
+		metrics.ObserveDB(method, start)
+	}
+}
@@ -0,0 +1,46 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/victorluk72/booking/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartQuery(t *testing.T) {
+
+	//Finished spans are kept in memory
+	sr := tracetest.NewSpanRecorder()
+	old := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	defer otel.SetTracerProvider(old)
+
+	//Query spans are children of request span
+	ctx, request := tracing.Start(context.Background(), "GET /admin/reservations-all")
+
+	_, done := startQuery(ctx, "GetReservationByID")
+	done(nil)
+
+	_, done = startQuery(ctx, "AllReservations")
+	done(errors.New("connection refused"))
+
+	request.End()
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+
+	if spans[0].Name() != "db.GetReservationByID" || spans[0].Status().Code == codes.Error {
+		t.Errorf("query without error is marked as failed: %q %v", spans[0].Name(), spans[0].Status())
+	}
+
+	if spans[1].Name() != "db.AllReservations" || spans[1].Status().Code != codes.Error {
+		t.Errorf("failed query is not marked as failed: %q %v", spans[1].Name(), spans[1].Status())
+	}
+}
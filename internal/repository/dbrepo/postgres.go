@@ -2,9 +2,14 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/victorluk72/booking/internal/apperr"
+	"github.com/victorluk72/booking/internal/i18n"
 	"github.com/victorluk72/booking/internal/models"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -17,31 +22,54 @@ func (m *postgresDBRepo) AllUsers() bool {
 
 }
 
+// reservationLocale returns language of reservation, reservations made before translations are in English
+func reservationLocale(res models.Reservation) string {
+	if res.Locale == "" {
+		return i18n.Default
+	}
+
+	return res.Locale
+}
+
+// nullID stores id 0 (e.g. room is not assigned yet) as NULL
+func nullID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
 // InsertReservstion inserts reservation details into database
 // This to be executed from corresponded handler (PostReservation)
-func (m *postgresDBRepo) InsertReservstion(res models.Reservation) (int, error) {
+func (m *postgresDBRepo) InsertReservstion(ctx context.Context, res models.Reservation) (_ int, err error) {
+	ctx, done := startQuery(ctx, "InsertReservstion")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var newID int
 
 	// Insert into DB statement
 	stmt := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, 
-		     room_id, created_at, updated_at) 
-	         values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+		     room_id, created_at, updated_at, sms_opt_in, locale, room_type_id) 
+	         values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
 
-	err := m.DB.QueryRowContext(ctx, stmt,
+	err = m.DB.QueryRowContext(ctx, stmt,
 		res.FirstName,
 		res.LastName,
 		res.Email,
 		res.Phone,
 		res.StartDate,
 		res.EndDate,
-		res.RoomID,
+		nullID(res.RoomID),
 		time.Now(),
-		time.Now()).Scan(&newID)
+		time.Now(),
+		res.SMSOptIn,
+		reservationLocale(res),
+		res.RoomTypeID).Scan(&newID)
 
 	if err != nil {
 		return 0, err
@@ -53,24 +81,28 @@ func (m *postgresDBRepo) InsertReservstion(res models.Reservation) (int, error)
 // InsertRoomRestriction inserts room restriction details into database
 // This happend immediately after room is reserved
 // This to be executed from corresponded handler (PostReservation)
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+func (m *postgresDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) (err error) {
+	ctx, done := startQuery(ctx, "InsertRoomRestriction")
+	defer func() { done(err) }()
+
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	// Insert into DB statement
 	stmt := `insert into room_restrictions (start_date, end_date, room_id, restriction_id,
-		     reservation_id, created_at, updated_at) 
-			 values ($1, $2, $3, $4, $5, $6, $7)`
+		     reservation_id, created_at, updated_at, room_type_id) 
+			 values ($1, $2, $3, $4, $5, $6, $7, $8)`
 
-	_, err := m.DB.ExecContext(ctx, stmt,
+	_, err = m.DB.ExecContext(ctx, stmt,
 		r.StartDate,
 		r.EndDate,
-		r.RoomID,
+		nullID(r.RoomID),
 		r.RestrictionID,
 		r.ReservationID,
 		time.Now(),
-		time.Now())
+		time.Now(),
+		nullID(r.RoomTypeID))
 
 	if err != nil {
 		return err
@@ -79,88 +111,160 @@ func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 	return nil
 }
 
-// SearchAvailabilityByDates returns true when room avaialble and false when it is booked
-// This apply to given roomID only (you need to pass room id)
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+// roomTypeAvailable counts rooms of type "rt" that are free for every night from $1 to $2 (day of departure
+// is not a night): rooms of the type in service (not out of order) minus the busiest night. Night is taken by
+// every reservation of the type, assigned or not, and by every other restriction of a room in service (e.g. owner block)
+const roomTypeAvailable = `(select count(*) from rooms r where r.room_type_id = rt.id and r.housekeeping_status <> 'out_of_order') -
+	coalesce((select max(taken.n) from (
+		select count(rr.id) as n
+		from generate_series($1::date, $2::date - 1, interval '1 day') as night(d)
+		join room_restrictions rr on (rr.start_date <= night.d and rr.end_date > night.d)
+		where rr.room_type_id = rt.id or rr.room_id in (select r.id from rooms r
+		  where r.room_type_id = rt.id and r.housekeeping_status <> 'out_of_order')
+		group by night.d) taken), 0)`
+
+// SearchAvailabilityByDatesByRoomTypeID returns true when at least one room of the type is free for every night
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomTypeID(ctx context.Context, start, end time.Time, roomTypeID int) (_ bool, err error) {
+	ctx, done := startQuery(ctx, "SearchAvailabilityByDatesByRoomTypeID")
+	defer func() { done(err) }()
+
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	query := `select count(id) from room_restrictions
-	          where room_id = $1 and $2 < end_date and $3 > start_date`
+	var available int
 
-	var numRows int
-
-	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
-	err := row.Scan(&numRows)
+	row := m.DB.QueryRowContext(ctx, `select `+roomTypeAvailable+` from room_types rt where rt.id = $3`, start, end, roomTypeID)
+	err = row.Scan(&available)
 	if err != nil {
 		return false, err
 	}
 
-	//this is the case with no result - room is avaialbe
-	if numRows == 0 {
-		return true, nil
+	return available > 0, nil
+}
+
+// SearchAvailabilityForRoomTypes returns room types of the property that have free rooms for every night
+// of the stay, with number of free rooms (Available)
+func (m *postgresDBRepo) SearchAvailabilityForRoomTypes(ctx context.Context, propertyID int, start, end time.Time) (_ []models.RoomType, err error) {
+	ctx, done := startQuery(ctx, "SearchAvailabilityForRoomTypes")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var types []models.RoomType
+
+	query := `select id, property_id, name, description, available from (
+	          select rt.id, rt.property_id, rt.name, rt.description, ` + roomTypeAvailable + ` as available
+			  from room_types rt where rt.property_id = $3) t
+			  where available > 0
+			  order by name`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, propertyID)
+	if err != nil {
+		return types, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rt models.RoomType
+		err := rows.Scan(&rt.ID, &rt.PropertyID, &rt.Name, &rt.Description, &rt.Available)
+		if err != nil {
+			return types, err
+		}
+
+		types = append(types, rt)
 	}
 
-	//this is the case with 1 result - room is Not avaialbe
-	return false, nil
+	if err = rows.Err(); err != nil {
+		return types, err
+	}
 
+	return types, nil
 }
 
-// SearchAvailabilityForAllRooms search all avaialble room for period of time and return slice of rooms
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+// GetRoomTypeByID returns one room type with its property
+func (m *postgresDBRepo) GetRoomTypeByID(ctx context.Context, id int) (_ models.RoomType, err error) {
+	ctx, done := startQuery(ctx, "GetRoomTypeByID")
+	defer func() { done(err) }()
+
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	//variable for rooms (from model Room)
-	var rooms []models.Room
+	var rt models.RoomType
 
-	query := `select r.id, r.room_name from rooms r 
-	          where r.id not in 
-			  (select rr.room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)`
+	query := `select rt.id, rt.property_id, rt.name, rt.description, ` + propertyColumns + `
+	          from room_types rt
+			  join properties p on (rt.property_id = p.id)
+			  where rt.id = $1`
 
-	//get rows with list of rooms
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	row := m.DB.QueryRowContext(ctx, query, id)
+
+	err = row.Scan(append([]interface{}{&rt.ID, &rt.PropertyID, &rt.Name, &rt.Description}, propertyFields(&rt.Property)...)...)
 	if err != nil {
-		return rooms, err
+		return rt, err
+	}
+
+	return rt, nil
+}
+
+// GetRoomTypesByProperty returns all room types of the property
+func (m *postgresDBRepo) GetRoomTypesByProperty(ctx context.Context, propertyID int) (_ []models.RoomType, err error) {
+	ctx, done := startQuery(ctx, "GetRoomTypesByProperty")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var types []models.RoomType
+
+	rows, err := m.DB.QueryContext(ctx, `select id, property_id, name, description from room_types
+	          where property_id = $1 order by name`, propertyID)
+	if err != nil {
+		return types, err
 	}
 	defer rows.Close()
 
-	//Scan all rows and asign to slice of rooms
 	for rows.Next() {
-		var room models.Room
-		err := rows.Scan(&room.ID, &room.RoomName)
+		var rt models.RoomType
+		err := rows.Scan(&rt.ID, &rt.PropertyID, &rt.Name, &rt.Description)
 		if err != nil {
-			return rooms, err
+			return types, err
 		}
 
-		//append single room to slice of rooms
-		rooms = append(rooms, room)
+		types = append(types, rt)
 	}
 
-	//Additional error check
 	if err = rows.Err(); err != nil {
-		return rooms, err
+		return types, err
 	}
 
-	return rooms, nil
+	return types, nil
 }
 
-// GetRoomByID returns one room of type models.Room
-func (m *postgresDBRepo) GetRoomByID(room_id int) (models.Room, error) {
+// GetRoomByID returns one room of type models.Room (with its property)
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, room_id int) (_ models.Room, err error) {
+	ctx, done := startQuery(ctx, "GetRoomByID")
+	defer func() { done(err) }()
+
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var room models.Room
 
-	query := `select id, room_name from rooms where id = $1`
+	query := `select rm.id, rm.room_name, rm.property_id, rm.room_type_id, ` + propertyColumns + `
+	          from rooms rm
+			  join properties p on (rm.property_id = p.id)
+			  where rm.id = $1`
 
 	row := m.DB.QueryRowContext(ctx, query, room_id)
 
 	//Scan into variables
-	err := row.Scan(&room.ID, &room.RoomName)
+	err = row.Scan(append([]interface{}{&room.ID, &room.RoomName, &room.PropertyID, &room.RoomTypeID}, propertyFields(&room.Property)...)...)
 	if err != nil {
 		return room, err
 	}
@@ -168,18 +272,25 @@ func (m *postgresDBRepo) GetRoomByID(room_id int) (models.Room, error) {
 	return room, nil
 }
 
-func (m *postgresDBRepo) GetAllRooms() ([]models.Room, error) {
+// GetRoomsByProperty returns all rooms of the property
+func (m *postgresDBRepo) GetRoomsByProperty(ctx context.Context, propertyID int) (_ []models.Room, err error) {
+	ctx, done := startQuery(ctx, "GetRoomsByProperty")
+	defer func() { done(err) }()
+
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	//variable for rooms - slise of models (from model Room)
 	var rooms []models.Room
 
-	query := `select id, room_name, created_at, updated_at from rooms order by room_name`
+	query := `select rm.id, rm.room_name, rm.property_id, rm.room_type_id, rt.name, rm.created_at, rm.updated_at
+	          from rooms rm
+			  join room_types rt on (rm.room_type_id = rt.id)
+	          where rm.property_id = $1 order by rt.name, rm.room_name`
 
 	//get rows with list of rooms
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, propertyID)
 	if err != nil {
 		return rooms, err
 	}
@@ -191,6 +302,9 @@ func (m *postgresDBRepo) GetAllRooms() ([]models.Room, error) {
 		var room models.Room
 		err := rows.Scan(&room.ID,
 			&room.RoomName,
+			&room.PropertyID,
+			&room.RoomTypeID,
+			&room.RoomType.Name,
 			&room.CreatedAt,
 			&room.UpdatedAt,
 		)
@@ -211,38 +325,101 @@ func (m *postgresDBRepo) GetAllRooms() ([]models.Room, error) {
 }
 
 // GetUserByID returns user type models.Uset
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (_ models.User, err error) {
+	ctx, done := startQuery(ctx, "GetUserByID")
+	defer func() { done(err) }()
+
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var u models.User
 
-	query := `select id, first_name, last_name, email, pasword, access_level
-	          created_at, updated_at from users where id = $1`
+	query := `select id, first_name, last_name, email, access_level, created_at, updated_at,
+	          notify_new, notify_modified, notify_cancelled, notify_blocked
+	          from users where id = $1`
 
 	row := m.DB.QueryRowContext(ctx, query, id)
 
 	//Scan into variables
-	err := row.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.AccessLevel, &u.CreatedAt, &u.UpdatedAt)
+	err = row.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.AccessLevel, &u.CreatedAt, &u.UpdatedAt,
+		&u.Notify.New, &u.Notify.Modified, &u.Notify.Cancelled, &u.Notify.Blocked)
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+
+}
+
+// GetUserByEmail returns user by email (returns sql.ErrNoRows if there is no such user)
+func (m *postgresDBRepo) GetUserByEmail(ctx context.Context, email string) (_ models.User, err error) {
+	ctx, done := startQuery(ctx, "GetUserByEmail")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var u models.User
+
+	query := `select id, first_name, last_name, email, access_level, created_at, updated_at
+	          from users where lower(email) = lower($1)`
+
+	row := m.DB.QueryRowContext(ctx, query, email)
+
+	//Scan into variables
+	err = row.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.AccessLevel, &u.CreatedAt, &u.UpdatedAt)
 	if err != nil {
 		return u, err
 	}
 
 	return u, nil
+}
+
+// InsertUser adds new user to the database and returns its id
+// Users that log in with single sign-on have no password (they can't use login form)
+func (m *postgresDBRepo) InsertUser(ctx context.Context, u models.User) (_ int, err error) {
+	ctx, done := startQuery(ctx, "InsertUser")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into users (first_name, last_name, email, password, access_level, created_at, updated_at)
+	         values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		u.Password,
+		u.AccessLevel,
+		time.Now(),
+		time.Now()).Scan(&newID)
 
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
 }
 
 // UpdateUser updates user in the database
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, u models.User) (err error) {
+	ctx, done := startQuery(ctx, "UpdateUser")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	query := `update users set first_name=$1 last_name=$2, email = $3, access_level = $4, updated_at = $5`
 
-	_, err := m.DB.ExecContext(ctx, query, u.FirstName, u.LastName, u.Email, u.AccessLevel, time.Now())
+	_, err = m.DB.ExecContext(ctx, query, u.FirstName, u.LastName, u.Email, u.AccessLevel, time.Now())
 	if err != nil {
 		return err
 	}
@@ -251,10 +428,12 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 }
 
 // Authenticate check if password and email at matching
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (_ int, _ string, err error) {
+	ctx, done := startQuery(ctx, "Authenticate")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	//variable for authenticated user and it's password
@@ -264,7 +443,7 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	row := m.DB.QueryRowContext(ctx, "select id, password from users where email = $1", email)
 
 	//Scan into variables
-	err := row.Scan(&id, &hashedPassword)
+	err = row.Scan(&id, &hashedPassword)
 	if err != nil {
 		return id, "", err
 	}
@@ -285,24 +464,28 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 
 }
 
-// AllReservations returns the slice of all reservations
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
+// AllReservations returns the slice of all reservations of the property
+func (m *postgresDBRepo) AllReservations(ctx context.Context, propertyID int) (_ []models.Reservation, err error) {
+	ctx, done := startQuery(ctx, "AllReservations")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	//variable for all reservations from db
 	var reservations []models.Reservation
 
 	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-	          r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-			  rm.id, rm.room_name
+	          r.end_date, coalesce(r.room_id, 0), r.created_at, r.updated_at, r.processed,
+			  coalesce(rm.id, 0), coalesce(rm.room_name, ''), r.room_type_id, rt.name, rt.property_id
 			  from reservations r
+			  join room_types rt on (r.room_type_id = rt.id)
 			  left join rooms rm on (r.room_id = rm.id)
+			  where rt.property_id = $1
 			  order by r.start_date asc  
 	         `
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, propertyID)
 	if err != nil {
 		return reservations, err
 	}
@@ -328,6 +511,9 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 			&i.Processed,
 			&i.Room.ID,
 			&i.Room.RoomName,
+			&i.RoomTypeID,
+			&i.RoomType.Name,
+			&i.RoomType.PropertyID,
 		)
 		if err != nil {
 			return reservations, err
@@ -346,25 +532,28 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 	return reservations, nil
 }
 
-// NewReservations returns the slice of new reservations
-func (m *postgresDBRepo) NewReservations() ([]models.Reservation, error) {
+// NewReservations returns the slice of new reservations of the property
+func (m *postgresDBRepo) NewReservations(ctx context.Context, propertyID int) (_ []models.Reservation, err error) {
+	ctx, done := startQuery(ctx, "NewReservations")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	//variable for all reservations from db
 	var reservations []models.Reservation
 
 	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-	          r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-			  rm.id, rm.room_name
+	          r.end_date, coalesce(r.room_id, 0), r.created_at, r.updated_at, r.processed,
+			  coalesce(rm.id, 0), coalesce(rm.room_name, ''), r.room_type_id, rt.name, rt.property_id
 			  from reservations r
+			  join room_types rt on (r.room_type_id = rt.id)
 			  left join rooms rm on (r.room_id = rm.id)
-			  where r.processed=0
+			  where r.processed=0 and rt.property_id = $1
 			  order by r.start_date asc  
 	         `
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, propertyID)
 	if err != nil {
 		return reservations, err
 	}
@@ -390,6 +579,9 @@ func (m *postgresDBRepo) NewReservations() ([]models.Reservation, error) {
 			&i.Processed,
 			&i.Room.ID,
 			&i.Room.RoomName,
+			&i.RoomTypeID,
+			&i.RoomType.Name,
+			&i.RoomType.PropertyID,
 		)
 		if err != nil {
 			return reservations, err
@@ -409,26 +601,33 @@ func (m *postgresDBRepo) NewReservations() ([]models.Reservation, error) {
 }
 
 // GetReservationByID returns single reservation (model) by ID
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+func (m *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (_ models.Reservation, err error) {
+	ctx, done := startQuery(ctx, "GetReservationByID")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	//variable to hold informaton about single reservation
 	var res models.Reservation
 
 	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, 
-	          r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at,
-			  r.processed, rm.id, rm.room_name
+	          r.start_date, r.end_date, coalesce(r.room_id, 0), r.created_at, r.updated_at,
+			  r.processed, r.sms_opt_in, r.locale, coalesce(rm.id, 0), coalesce(rm.room_name, ''),
+			  r.room_type_id, rt.name, rt.property_id, ` + frontDeskColumns + `, r.arrival_notes, ` + propertyColumns + `
 			  from reservations r
+			  join room_types rt on (r.room_type_id = rt.id)
+			  join properties p on (rt.property_id = p.id)
 			  left join rooms rm on (r.room_id = rm.id)
 			  where r.id=$1`
 
 	row := m.DB.QueryRowContext(ctx, query, id)
 
+	var fd frontDesk
+
 	//Scan into variables
-	err := row.Scan(
+	err = row.Scan(append([]interface{}{
 		&res.ID,
 		&res.FirstName,
 		&res.LastName,
@@ -440,28 +639,38 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&res.SMSOptIn,
+		&res.Locale,
 		&res.Room.ID,
 		&res.Room.RoomName,
-	)
+		&res.RoomTypeID,
+		&res.RoomType.Name,
+		&res.RoomType.PropertyID,
+		&fd.in, &fd.out, &res.ArrivalNotes,
+	}, propertyFields(&res.RoomType.Property)...)...)
 	if err != nil {
 		return res, err
 	}
 
+	fd.set(&res)
+
 	return res, nil
 
 }
 
 // UpdateReservation updates model for reservation in the database
-func (m *postgresDBRepo) UpdateReservation(r models.Reservation) error {
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, r models.Reservation) (err error) {
+	ctx, done := startQuery(ctx, "UpdateReservation")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	query := `update reservations set first_name=$1, last_name=$2, email = $3, 
 	          phone = $4, updated_at = $5 where id = $6 `
 
-	_, err := m.DB.ExecContext(ctx, query, r.FirstName, r.LastName, r.Email, r.Phone, time.Now(), r.ID)
+	_, err = m.DB.ExecContext(ctx, query, r.FirstName, r.LastName, r.Email, r.Phone, time.Now(), r.ID)
 	if err != nil {
 		return err
 	}
@@ -470,15 +679,17 @@ func (m *postgresDBRepo) UpdateReservation(r models.Reservation) error {
 }
 
 // DeleteReservation deletes reservation by from the database
-func (m *postgresDBRepo) DeleteReservation(id int) error {
+func (m *postgresDBRepo) DeleteReservation(ctx context.Context, id int) (err error) {
+	ctx, done := startQuery(ctx, "DeleteReservation")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	query := `delete from reservations where id=$1`
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	_, err = m.DB.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -487,15 +698,17 @@ func (m *postgresDBRepo) DeleteReservation(id int) error {
 }
 
 // UpdateProcessedForReservation updates field process for single reservation
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
+func (m *postgresDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) (err error) {
+	ctx, done := startQuery(ctx, "UpdateProcessedForReservation")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	query := `update reservations set processed=$1 where id=$2`
 
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
+	_, err = m.DB.ExecContext(ctx, query, processed, id)
 	if err != nil {
 		return err
 	}
@@ -504,10 +717,12 @@ func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error
 }
 
 // GetRestrictionsForRoomByDate return current restriction for date range
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) (_ []models.RoomRestriction, err error) {
+	ctx, done := startQuery(ctx, "GetRestrictionsForRoomByDate")
+	defer func() { done(err) }()
 
 	//If transaction takes longeer than 3 seconds cancel it
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var restrictions []models.RoomRestriction
@@ -550,3 +765,1529 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 	return restrictions, nil
 
 }
+
+// InsertUserSession records who owns the session (call it right after login)
+// It also removes records of expired sessions
+func (m *postgresDBRepo) InsertUserSession(ctx context.Context, s models.UserSession) (err error) {
+	ctx, done := startQuery(ctx, "InsertUserSession")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `delete from user_sessions where expiry < $1`, time.Now())
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into user_sessions (token, user_id, ip_address, user_agent, expiry, created_at, updated_at)
+	         values ($1, $2, $3, $4, $5, $6, $7)
+			 on conflict (token) do update set user_id = excluded.user_id, expiry = excluded.expiry,
+			 updated_at = excluded.updated_at`
+
+	_, err = m.DB.ExecContext(ctx, stmt,
+		s.Token,
+		s.UserID,
+		s.IPAddress,
+		s.UserAgent,
+		s.Expiry,
+		time.Now(),
+		time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllUserSessions returns active sessions of staff of the property (newest first)
+func (m *postgresDBRepo) AllUserSessions(ctx context.Context, propertyID int) (_ []models.UserSession, err error) {
+	ctx, done := startQuery(ctx, "AllUserSessions")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var sessions []models.UserSession
+
+	query := `select s.id, s.token, s.user_id, s.ip_address, s.user_agent, s.expiry, s.created_at,
+	          s.updated_at, u.id, u.first_name, u.last_name, u.email
+			  from user_sessions s
+			  left join users u on (s.user_id = u.id)
+			  where s.expiry > $1 and s.user_id in (select user_id from user_properties where property_id = $2)
+			  order by s.created_at desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now(), propertyID)
+	if err != nil {
+		return sessions, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.UserSession
+
+		err := rows.Scan(
+			&s.ID,
+			&s.Token,
+			&s.UserID,
+			&s.IPAddress,
+			&s.UserAgent,
+			&s.Expiry,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+			&s.User.ID,
+			&s.User.FirstName,
+			&s.User.LastName,
+			&s.User.Email,
+		)
+		if err != nil {
+			return sessions, err
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return sessions, err
+	}
+
+	return sessions, nil
+}
+
+// GetUserSessionByID returns single session by id
+func (m *postgresDBRepo) GetUserSessionByID(ctx context.Context, id int) (_ models.UserSession, err error) {
+	ctx, done := startQuery(ctx, "GetUserSessionByID")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var s models.UserSession
+
+	query := `select id, token, user_id, ip_address, user_agent, expiry, created_at, updated_at
+	          from user_sessions where id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+
+	err = row.Scan(&s.ID, &s.Token, &s.UserID, &s.IPAddress, &s.UserAgent, &s.Expiry, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// DeleteUserSession removes the record of the session (on logout or revoke)
+func (m *postgresDBRepo) DeleteUserSession(ctx context.Context, token string) (err error) {
+	ctx, done := startQuery(ctx, "DeleteUserSession")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `delete from user_sessions where token = $1`, token)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertReservationWithMail inserts reservation, its room restriction and emails for outbox
+// in one transaction, so we never have reservation without confirmation email (or the other way round)
+func (m *postgresDBRepo) InsertReservationWithMail(ctx context.Context, res models.Reservation, restriction models.RoomRestriction, mail []models.MailData) (_ int, err error) {
+	ctx, done := startQuery(ctx, "InsertReservationWithMail")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	//Rollback does nothing after Commit
+	defer tx.Rollback()
+
+	//Room of the type may be taken since guest searched: check it again while nobody else can book the type
+	err = lockRoomType(ctx, tx, res.RoomTypeID)
+	if err != nil {
+		return 0, err
+	}
+
+	var available int
+
+	err = tx.QueryRowContext(ctx, `select `+roomTypeAvailable+` from room_types rt where rt.id = $3`,
+		res.StartDate, res.EndDate, res.RoomTypeID).Scan(&available)
+	if err != nil {
+		return 0, err
+	}
+
+	if available < 1 {
+		return 0, apperr.NewConflict("No rooms of this type are left for these dates", nil)
+	}
+
+	var newID int
+
+	stmt := `insert into reservations (first_name, last_name, email, phone, start_date, end_date,
+		     room_id, created_at, updated_at, sms_opt_in, locale, room_type_id)
+	         values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		nullID(res.RoomID),
+		time.Now(),
+		time.Now(),
+		res.SMSOptIn,
+		reservationLocale(res),
+		res.RoomTypeID).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `insert into room_restrictions (start_date, end_date, room_id, restriction_id,
+		     reservation_id, created_at, updated_at, room_type_id)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		restriction.StartDate,
+		restriction.EndDate,
+		nullID(restriction.RoomID),
+		restriction.RestrictionID,
+		newID,
+		time.Now(),
+		time.Now(),
+		nullID(restriction.RoomTypeID))
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range mail {
+		_, err = tx.ExecContext(ctx, insertMailStmt, mailArgs(msg)...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// insertMailStmt adds new pending message to the outbox (see mailArgs for values)
+const insertMailStmt = `insert into mail_outbox (to_address, from_address, subject, content, text_content,
+	status, attempts, next_attempt_at, last_error, created_at, updated_at, property_id)
+	values ($1, $2, $3, $4, $5, $6, 0, $7, '', $7, $7, $8)`
+
+func mailArgs(msg models.MailData) []interface{} {
+	return []interface{}{msg.To, msg.From, msg.Subject, msg.Content, msg.Text, models.MailPending, time.Now(), nullID(msg.PropertyID)}
+}
+
+// InsertMail adds message to mail outbox, mail workers will send it
+func (m *postgresDBRepo) InsertMail(ctx context.Context, msg models.MailData) (err error) {
+	ctx, done := startQuery(ctx, "InsertMail")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, insertMailStmt, mailArgs(msg)...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// mailColumns are the columns scanned by scanMail
+const mailColumns = `id, to_address, from_address, subject, content, text_content, status, attempts,
+	next_attempt_at, last_error, coalesce(sent_at, '0001-01-01'), created_at, updated_at, coalesce(property_id, 0)`
+
+// scanMail reads one outbox row (selected with mailColumns)
+func scanMail(row interface{ Scan(...interface{}) error }) (models.MailMessage, error) {
+	var msg models.MailMessage
+
+	err := row.Scan(
+		&msg.ID,
+		&msg.MailData.To,
+		&msg.MailData.From,
+		&msg.MailData.Subject,
+		&msg.MailData.Content,
+		&msg.MailData.Text,
+		&msg.Status,
+		&msg.Attempts,
+		&msg.NextAttemptAt,
+		&msg.LastError,
+		&msg.SentAt,
+		&msg.CreatedAt,
+		&msg.UpdatedAt,
+		&msg.MailData.PropertyID,
+	)
+
+	return msg, err
+}
+
+// ClaimMail takes up to limit messages that are due for sending and marks them as "sending"
+// Taken messages are locked for the lease time, if worker dies they will be taken again after it.
+// Several workers (or several application instances) never get the same message (skip locked)
+func (m *postgresDBRepo) ClaimMail(ctx context.Context, limit int, lease time.Duration) (_ []models.MailMessage, err error) {
+	ctx, done := startQuery(ctx, "ClaimMail")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var messages []models.MailMessage
+
+	now := time.Now()
+
+	query := `update mail_outbox set status = $1, next_attempt_at = $2, updated_at = $3
+	          where id in (
+				select id from mail_outbox
+				where status in ($4, $1) and next_attempt_at <= $3
+				order by next_attempt_at
+				limit $5
+				for update skip locked)
+			  returning ` + mailColumns
+
+	rows, err := m.DB.QueryContext(ctx, query, models.MailSending, now.Add(lease), now, models.MailPending, limit)
+	if err != nil {
+		return messages, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanMail(rows)
+		if err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return messages, err
+	}
+
+	return messages, nil
+}
+
+// UpdateMail saves the result of sending attempt (status, attempts, next attempt, error)
+// claimedUntil is next_attempt_at set by ClaimMail: if lease has expired and another worker claimed
+// the message again, the result is not saved (that worker will save its own)
+func (m *postgresDBRepo) UpdateMail(ctx context.Context, msg models.MailMessage, claimedUntil time.Time) (err error) {
+	ctx, done := startQuery(ctx, "UpdateMail")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var sentAt interface{}
+	if !msg.SentAt.IsZero() {
+		sentAt = msg.SentAt
+	}
+
+	stmt := `update mail_outbox set status = $1, attempts = $2, next_attempt_at = $3, last_error = $4,
+	         sent_at = $5, updated_at = $6
+			 where id = $7 and status = $8 and next_attempt_at = $9`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		msg.Status,
+		msg.Attempts,
+		msg.NextAttemptAt,
+		msg.LastError,
+		sentAt,
+		time.Now(),
+		msg.ID,
+		models.MailSending,
+		claimedUntil)
+
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return apperr.NewConflict("Lease of the email has expired, it belongs to another worker now", nil)
+	}
+
+	return nil
+}
+
+// AllMail returns messages about the property from outbox with given status (all messages for empty status), newest first
+func (m *postgresDBRepo) AllMail(ctx context.Context, propertyID int, status string) (_ []models.MailMessage, err error) {
+	ctx, done := startQuery(ctx, "AllMail")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var messages []models.MailMessage
+
+	query := `select ` + mailColumns + ` from mail_outbox
+	          where property_id = $2 and ($1 = '' or status = $1)
+			  order by created_at desc
+			  limit 500`
+
+	rows, err := m.DB.QueryContext(ctx, query, status, propertyID)
+	if err != nil {
+		return messages, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanMail(rows)
+		if err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return messages, err
+	}
+
+	return messages, nil
+}
+
+// GetMailByID returns single message from outbox
+func (m *postgresDBRepo) GetMailByID(ctx context.Context, id int) (_ models.MailMessage, err error) {
+	ctx, done := startQuery(ctx, "GetMailByID")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `select `+mailColumns+` from mail_outbox where id = $1`, id)
+
+	return scanMail(row)
+}
+
+// ResendMail puts message back to the queue with fresh attempts
+func (m *postgresDBRepo) ResendMail(ctx context.Context, id int) (err error) {
+	ctx, done := startQuery(ctx, "ResendMail")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `update mail_outbox set status = $1, attempts = 0, next_attempt_at = $2, last_error = '',
+	         updated_at = $2
+			 where id = $3`
+
+	_, err = m.DB.ExecContext(ctx, stmt, models.MailPending, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateUserNotifications saves which events the user wants to get email about
+func (m *postgresDBRepo) UpdateUserNotifications(ctx context.Context, userID int, n models.Notifications) (err error) {
+	ctx, done := startQuery(ctx, "UpdateUserNotifications")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `update users set notify_new = $1, notify_modified = $2, notify_cancelled = $3,
+	         notify_blocked = $4, updated_at = $5
+			 where id = $6`
+
+	_, err = m.DB.ExecContext(ctx, stmt, n.New, n.Modified, n.Cancelled, n.Blocked, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// notifyColumns maps event to the column of users table
+var notifyColumns = map[string]string{
+	models.EventNewReservation: "notify_new",
+	models.EventModified:       "notify_modified",
+	models.EventCancelled:      "notify_cancelled",
+	models.EventBlocked:        "notify_blocked",
+}
+
+// UsersToNotify returns users of the property that want email about the event (see models.Event* constants)
+func (m *postgresDBRepo) UsersToNotify(ctx context.Context, propertyID int, event string) (_ []models.User, err error) {
+	ctx, done := startQuery(ctx, "UsersToNotify")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var users []models.User
+
+	column, ok := notifyColumns[event]
+	if !ok {
+		return users, errors.New("unknown event " + event)
+	}
+
+	//column comes from the map above, never from user input
+	query := `select u.id, u.first_name, u.last_name, u.email from users u
+	          join user_properties up on (up.user_id = u.id)
+	          where up.property_id = $1 and u.` + column + ` = true order by u.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, propertyID)
+	if err != nil {
+		return users, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+
+		err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email)
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
+// InsertBlockForRoom adds owner block (restriction without reservation) for one day
+// Block takes a night of the room type too, so it is refused (Conflict) when the room is taken
+// or no room of the type would be left for guests who booked the type
+func (m *postgresDBRepo) InsertBlockForRoom(ctx context.Context, roomID int, date time.Time) (err error) {
+	ctx, done := startQuery(ctx, "InsertBlockForRoom")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	//Rollback does nothing after Commit
+	defer tx.Rollback()
+
+	var roomTypeID int
+
+	err = tx.QueryRowContext(ctx, `select room_type_id from rooms where id = $1`, roomID).Scan(&roomTypeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperr.NewNotFound("Room not found", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	//Bookings and assignments of the type wait until we are done
+	err = lockRoomType(ctx, tx, roomTypeID)
+	if err != nil {
+		return err
+	}
+
+	end := date.AddDate(0, 0, 1)
+
+	var free bool
+
+	err = tx.QueryRowContext(ctx, `select exists (select 1 from (`+freeRoomsQuery+`) f where f.id = $5)`,
+		roomTypeID, date, end, 0, roomID).Scan(&free)
+	if err != nil {
+		return err
+	}
+
+	if !free {
+		return apperr.NewConflict("Room is not free on this day", nil)
+	}
+
+	var available int
+
+	err = tx.QueryRowContext(ctx, `select `+roomTypeAvailable+` from room_types rt where rt.id = $3`,
+		date, end, roomTypeID).Scan(&available)
+	if err != nil {
+		return err
+	}
+
+	if available < 1 {
+		return apperr.NewConflict("All rooms of this type are booked on this day", nil)
+	}
+
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, restriction_id,
+	         created_at, updated_at)
+			 values ($1, $2, $3, $4, $5, $6)`
+
+	_, err = tx.ExecContext(ctx, stmt, date, end, roomID, 2, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteBlockByID removes owner block
+func (m *postgresDBRepo) DeleteBlockByID(ctx context.Context, id int) (err error) {
+	ctx, done := startQuery(ctx, "DeleteBlockByID")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `delete from room_restrictions where id = $1 and reservation_id is null`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// reminderColumns maps kind of reminder to the date it is counted from
+var reminderColumns = map[string]string{
+	models.ReminderArrival:  "start_date",
+	models.ReminderFollowUp: "end_date",
+}
+
+// ReservationsForReminder returns reservations of the property that arrive (or leave for follow-up) between from and to
+// and didn't get this kind of reminder yet
+func (m *postgresDBRepo) ReservationsForReminder(ctx context.Context, propertyID int, kind string, from, to time.Time) (_ []models.Reservation, err error) {
+	ctx, done := startQuery(ctx, "ReservationsForReminder")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	column, ok := reminderColumns[kind]
+	if !ok {
+		return reservations, errors.New("unknown reminder " + kind)
+	}
+
+	//column comes from the map above, never from user input
+	query := `select r.id, r.first_name, r.last_name, r.email, r.phone,
+	          r.start_date, r.end_date, coalesce(r.room_id, 0), r.sms_opt_in, r.locale,
+			  coalesce(rm.id, 0), coalesce(rm.room_name, ''), r.room_type_id, rt.name, rt.property_id, ` + propertyColumns + `
+			  from reservations r
+			  join room_types rt on (r.room_type_id = rt.id)
+			  join properties p on (rt.property_id = p.id)
+			  left join rooms rm on (r.room_id = rm.id)
+			  where r.` + column + ` between $1 and $2 and rt.property_id = $4
+			  and not exists (select 1 from sent_reminders s where s.reservation_id = r.id and s.kind = $3)
+			  order by r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, from, to, kind, propertyID)
+	if err != nil {
+		return reservations, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.Reservation
+
+		err := rows.Scan(append([]interface{}{
+			&res.ID,
+			&res.FirstName,
+			&res.LastName,
+			&res.Email,
+			&res.Phone,
+			&res.StartDate,
+			&res.EndDate,
+			&res.RoomID,
+			&res.SMSOptIn,
+			&res.Locale,
+			&res.Room.ID,
+			&res.Room.RoomName,
+			&res.RoomTypeID,
+			&res.RoomType.Name,
+			&res.RoomType.PropertyID,
+		}, propertyFields(&res.RoomType.Property)...)...)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// InsertReminderWithMail remembers that reminder was sent and puts the email to outbox (in one transaction)
+// If the reminder was already sent nothing happens, so running scheduler twice never sends it twice
+func (m *postgresDBRepo) InsertReminderWithMail(ctx context.Context, reservationID int, kind string, mail models.MailData) (_ bool, err error) {
+	ctx, done := startQuery(ctx, "InsertReminderWithMail")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	//Rollback does nothing after Commit
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `insert into sent_reminders (reservation_id, kind, created_at, updated_at)
+	          values ($1, $2, $3, $3)
+			  on conflict (reservation_id, kind) do nothing`, reservationID, kind, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if inserted == 0 {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, insertMailStmt, mailArgs(mail)...)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// propertyColumns are columns of properties table (alias "p") in the order of propertyFields
+const propertyColumns = `p.id, p.name, p.contact_email, p.time_zone, p.check_in, p.check_out, p.logo_url, p.brand_color`
+
+// propertyFields returns destinations for propertyColumns, add them to the end of Scan arguments
+func propertyFields(p *models.Property) []interface{} {
+	return []interface{}{&p.ID, &p.Name, &p.ContactEmail, &p.TimeZone, &p.CheckIn, &p.CheckOut, &p.LogoURL, &p.BrandColor}
+}
+
+// queryProperties runs query that selects propertyColumns
+func (m *postgresDBRepo) queryProperties(ctx context.Context, query string, args ...interface{}) ([]models.Property, error) {
+	var properties []models.Property
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return properties, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Property
+
+		err := rows.Scan(propertyFields(&p)...)
+		if err != nil {
+			return properties, err
+		}
+
+		properties = append(properties, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return properties, err
+	}
+
+	return properties, nil
+}
+
+// AllProperties returns all properties (for search form of guests)
+func (m *postgresDBRepo) AllProperties(ctx context.Context) (_ []models.Property, err error) {
+	ctx, done := startQuery(ctx, "AllProperties")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.queryProperties(ctx, `select `+propertyColumns+` from properties p order by p.name`)
+}
+
+// PropertiesForUser returns properties the user manages
+func (m *postgresDBRepo) PropertiesForUser(ctx context.Context, userID int) (_ []models.Property, err error) {
+	ctx, done := startQuery(ctx, "PropertiesForUser")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.queryProperties(ctx, `select `+propertyColumns+` from properties p
+	          join user_properties up on (up.property_id = p.id)
+	          where up.user_id = $1 order by p.name`, userID)
+}
+
+// GetPropertyByID returns single property (sql.ErrNoRows if there is no such property)
+func (m *postgresDBRepo) GetPropertyByID(ctx context.Context, id int) (_ models.Property, err error) {
+	ctx, done := startQuery(ctx, "GetPropertyByID")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var p models.Property
+
+	row := m.DB.QueryRowContext(ctx, `select `+propertyColumns+` from properties p where p.id = $1`, id)
+
+	err = row.Scan(propertyFields(&p)...)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// InsertProperty adds new property and makes the user one of its staff (in one transaction), returns its id
+func (m *postgresDBRepo) InsertProperty(ctx context.Context, p models.Property, userID int) (_ int, err error) {
+	ctx, done := startQuery(ctx, "InsertProperty")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	//Rollback does nothing after Commit
+	defer tx.Rollback()
+
+	var newID int
+
+	stmt := `insert into properties (name, contact_email, time_zone, check_in, check_out, logo_url, brand_color,
+	         created_at, updated_at)
+			 values ($1, $2, $3, $4, $5, $6, $7, $8, $8) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		p.Name,
+		p.ContactEmail,
+		p.TimeZone,
+		p.CheckIn,
+		p.CheckOut,
+		p.LogoURL,
+		p.BrandColor,
+		time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	//Nobody is logged in when admin area is open (development)
+	if userID != 0 {
+		_, err = tx.ExecContext(ctx, `insert into user_properties (user_id, property_id, created_at, updated_at)
+		          values ($1, $2, $3, $3)`, userID, newID, time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return newID, tx.Commit()
+}
+
+// UpdateProperty saves settings of the property
+func (m *postgresDBRepo) UpdateProperty(ctx context.Context, p models.Property) (err error) {
+	ctx, done := startQuery(ctx, "UpdateProperty")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	stmt := `update properties set name = $1, contact_email = $2, time_zone = $3, check_in = $4, check_out = $5,
+	         logo_url = $6, brand_color = $7, updated_at = $8
+			 where id = $9`
+
+	_, err = m.DB.ExecContext(ctx, stmt,
+		p.Name,
+		p.ContactEmail,
+		p.TimeZone,
+		p.CheckIn,
+		p.CheckOut,
+		p.LogoURL,
+		p.BrandColor,
+		time.Now(),
+		p.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UsersForProperty returns staff of the property
+func (m *postgresDBRepo) UsersForProperty(ctx context.Context, propertyID int) (_ []models.User, err error) {
+	ctx, done := startQuery(ctx, "UsersForProperty")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var users []models.User
+
+	query := `select u.id, u.first_name, u.last_name, u.email from users u
+	          join user_properties up on (up.user_id = u.id)
+	          where up.property_id = $1 order by u.last_name, u.first_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, propertyID)
+	if err != nil {
+		return users, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+
+		err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email)
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
+// AddUserToProperty makes the user one of the staff of the property (nothing happens if they already are)
+func (m *postgresDBRepo) AddUserToProperty(ctx context.Context, userID, propertyID int) (err error) {
+	ctx, done := startQuery(ctx, "AddUserToProperty")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `insert into user_properties (user_id, property_id, created_at, updated_at)
+	          values ($1, $2, $3, $3)
+			  on conflict (user_id, property_id) do nothing`, userID, propertyID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// lockRoomType locks room type until the end of transaction tx, so only one transaction at a time
+// counts and takes its rooms (no overbooking when two guests book the last room together)
+func lockRoomType(ctx context.Context, tx *sql.Tx, roomTypeID int) error {
+	var id int
+
+	err := tx.QueryRowContext(ctx, `select id from room_types where id = $1 for update`, roomTypeID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperr.NewNotFound("Room type not found", err)
+	}
+
+	return err
+}
+
+// UnassignedReservations returns reservations of the property that stay between start and end
+// (at least one night) and have no room yet
+func (m *postgresDBRepo) UnassignedReservations(ctx context.Context, propertyID int, start, end time.Time) (_ []models.Reservation, err error) {
+	ctx, done := startQuery(ctx, "UnassignedReservations")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `select r.id, r.first_name, r.last_name, r.start_date, r.end_date,
+	          r.room_type_id, rt.name, rt.property_id
+	          from reservations r
+			  join room_types rt on (r.room_type_id = rt.id)
+			  where r.room_id is null and rt.property_id = $1
+			  and r.start_date <= $3 and r.end_date > $2
+			  order by r.start_date, rt.name`
+
+	rows, err := m.DB.QueryContext(ctx, query, propertyID, start, end)
+	if err != nil {
+		return reservations, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.Reservation
+
+		err := rows.Scan(&res.ID, &res.FirstName, &res.LastName, &res.StartDate, &res.EndDate,
+			&res.RoomTypeID, &res.RoomType.Name, &res.RoomType.PropertyID)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// freeRoomsQuery selects rooms of type $1 in service that have no restrictions from $2 to $3 except the ones of reservation $4
+const freeRoomsQuery = `select rm.id, rm.room_name, rm.property_id, rm.room_type_id
+	          from rooms rm
+			  where rm.room_type_id = $1 and rm.housekeeping_status <> 'out_of_order' and not exists (
+			    select 1 from room_restrictions rr
+				where rr.room_id = rm.id and rr.start_date < $3 and rr.end_date > $2
+				and rr.reservation_id is distinct from $4)
+			  order by rm.room_name`
+
+// FreeRoomsForReservation returns rooms of the booked type that are free for the whole stay
+// (room the reservation already has is one of them)
+func (m *postgresDBRepo) FreeRoomsForReservation(ctx context.Context, res models.Reservation) (_ []models.Room, err error) {
+	ctx, done := startQuery(ctx, "FreeRoomsForReservation")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var rooms []models.Room
+
+	rows, err := m.DB.QueryContext(ctx, freeRoomsQuery, res.RoomTypeID, res.StartDate, res.EndDate, res.ID)
+	if err != nil {
+		return rooms, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.Room
+
+		err := rows.Scan(&room.ID, &room.RoomName, &room.PropertyID, &room.RoomTypeID)
+		if err != nil {
+			return rooms, err
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// AssignRoom gives reservation the room (or moves it to another one)
+// Room must be of the booked type and free for the whole stay, otherwise apperr Validation or Conflict is returned
+func (m *postgresDBRepo) AssignRoom(ctx context.Context, reservationID, roomID int) (err error) {
+	ctx, done := startQuery(ctx, "AssignRoom")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	//Rollback does nothing after Commit
+	defer tx.Rollback()
+
+	var res models.Reservation
+
+	err = tx.QueryRowContext(ctx, `select id, room_type_id, start_date, end_date from reservations where id = $1`,
+		reservationID).Scan(&res.ID, &res.RoomTypeID, &res.StartDate, &res.EndDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperr.NewNotFound("Reservation not found", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	//Other assignments and bookings of the type wait until we are done
+	err = lockRoomType(ctx, tx, res.RoomTypeID)
+	if err != nil {
+		return err
+	}
+
+	var roomTypeID int
+
+	err = tx.QueryRowContext(ctx, `select room_type_id from rooms where id = $1`, roomID).Scan(&roomTypeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperr.NewNotFound("Room not found", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if roomTypeID != res.RoomTypeID {
+		return apperr.NewValidation("Room is not of the booked type", nil)
+	}
+
+	var free bool
+
+	err = tx.QueryRowContext(ctx, `select exists (select 1 from (`+freeRoomsQuery+`) f where f.id = $5)`,
+		res.RoomTypeID, res.StartDate, res.EndDate, res.ID, roomID).Scan(&free)
+	if err != nil {
+		return err
+	}
+
+	if !free {
+		return apperr.NewConflict("Room is not free for these dates", nil)
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set room_id = $1, updated_at = $2 where id = $3`, roomID, time.Now(), res.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update room_restrictions set room_id = $1, updated_at = $2 where reservation_id = $3`, roomID, time.Now(), res.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AssignRooms gives rooms to reservations of the property that arrive between from and to and have no room yet
+// (first free room of the booked type), returns how many reservations got a room.
+// Reservations without free room are left for staff (see calendar)
+func (m *postgresDBRepo) AssignRooms(ctx context.Context, propertyID int, from, to time.Time) (_ int, err error) {
+	ctx, done := startQuery(ctx, "AssignRooms")
+	defer func() { done(err) }()
+
+	var reservations []models.Reservation
+
+	err = func() error {
+		//If transaction takes longeer than 3 seconds cancel it
+		ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+
+		rows, err := m.DB.QueryContext(ctx, `select r.id, r.room_type_id, r.start_date, r.end_date from reservations r
+		          join room_types rt on (r.room_type_id = rt.id)
+		          where r.room_id is null and r.start_date >= $1 and r.start_date <= $2 and rt.property_id = $3
+				  order by r.start_date, r.id`, from, to, propertyID)
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var res models.Reservation
+
+			err := rows.Scan(&res.ID, &res.RoomTypeID, &res.StartDate, &res.EndDate)
+			if err != nil {
+				return err
+			}
+
+			reservations = append(reservations, res)
+		}
+
+		return rows.Err()
+	}()
+	if err != nil {
+		return 0, err
+	}
+
+	assigned := 0
+
+	for _, res := range reservations {
+		rooms, err := m.FreeRoomsForReservation(ctx, res)
+		if err != nil {
+			return assigned, err
+		}
+
+		if len(rooms) == 0 {
+			continue
+		}
+
+		//Someone may take the room in between, then the reservation waits for the next run
+		err = m.AssignRoom(ctx, res.ID, rooms[0].ID)
+		if apperr.KindOf(err) == apperr.Conflict {
+			continue
+		}
+		if err != nil {
+			return assigned, err
+		}
+
+		assigned++
+	}
+
+	return assigned, nil
+}
+
+// frontDeskColumns are check-in and check-out times of reservations (alias "r"), scan them into frontDesk
+const frontDeskColumns = `r.checked_in_at, r.checked_out_at`
+
+// frontDesk holds check-in and check-out times while scanning (they are NULL until it happens)
+type frontDesk struct {
+	in, out sql.NullTime
+}
+
+// set copies scanned times to reservation, NULL becomes zero time
+func (f frontDesk) set(res *models.Reservation) {
+	res.CheckedInAt = f.in.Time
+	res.CheckedOutAt = f.out.Time
+}
+
+// FrontDeskReservations returns reservations of the property the front desk works with on day:
+// guests arriving (or late and not checked in yet), staying and leaving, and guests who stayed over departure
+func (m *postgresDBRepo) FrontDeskReservations(ctx context.Context, propertyID int, day time.Time) (_ []models.Reservation, err error) {
+	ctx, done := startQuery(ctx, "FrontDeskReservations")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+	          coalesce(r.room_id, 0), coalesce(rm.room_name, ''), r.room_type_id, rt.name, rt.property_id,
+			  r.arrival_notes, ` + frontDeskColumns + `
+			  from reservations r
+			  join room_types rt on (r.room_type_id = rt.id)
+			  left join rooms rm on (r.room_id = rm.id)
+			  where rt.property_id = $1
+			  and ((r.start_date <= $2 and r.end_date >= $2) or (r.checked_in_at is not null and r.checked_out_at is null))
+			  order by r.start_date, r.last_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, propertyID, day)
+	if err != nil {
+		return reservations, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.Reservation
+		var fd frontDesk
+
+		err := rows.Scan(&res.ID, &res.FirstName, &res.LastName, &res.Email, &res.Phone, &res.StartDate, &res.EndDate,
+			&res.RoomID, &res.Room.RoomName, &res.RoomTypeID, &res.RoomType.Name, &res.RoomType.PropertyID,
+			&res.ArrivalNotes, &fd.in, &fd.out)
+		if err != nil {
+			return reservations, err
+		}
+
+		res.Room.ID = res.RoomID
+		fd.set(&res)
+
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// CheckIn records that guest arrived (at is the actual time, day is the day of the property) with notes of the front desk
+// Guest can check in from the day of arrival until the last night of the stay, reservation must have a room
+// and not be checked in yet, otherwise apperr Validation or Conflict is returned
+func (m *postgresDBRepo) CheckIn(ctx context.Context, reservationID int, at, day time.Time, notes string) (err error) {
+	ctx, done := startQuery(ctx, "CheckIn")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	//Rollback does nothing after Commit
+	defer tx.Rollback()
+
+	var roomID int
+	var start, end time.Time
+	var checkedIn sql.NullTime
+
+	err = tx.QueryRowContext(ctx, `select coalesce(room_id, 0), start_date, end_date, checked_in_at from reservations where id = $1 for update`,
+		reservationID).Scan(&roomID, &start, &end, &checkedIn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperr.NewNotFound("Reservation not found", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if checkedIn.Valid {
+		return apperr.NewConflict("Guest is already checked in", nil)
+	}
+
+	if day.Before(start) || !day.Before(end) {
+		return apperr.NewValidation("Check-in is possible from the day of arrival until the day before departure", nil)
+	}
+
+	if roomID == 0 {
+		return apperr.NewValidation("Assign a room before check-in", nil)
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set checked_in_at = $1, arrival_notes = $2, updated_at = $3 where id = $4`,
+		at, notes, time.Now(), reservationID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CheckOut records that guest left (at is the actual time, day is the day of the property) and marks the room dirty
+// Guest leaving before departure day frees the rest of the stay: departure of reservation and end of its
+// room restriction move to day (the night of arrival is always kept). Returns departure day of the stay
+func (m *postgresDBRepo) CheckOut(ctx context.Context, reservationID int, at, day time.Time) (_ time.Time, err error) {
+	ctx, done := startQuery(ctx, "CheckOut")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	//Rollback does nothing after Commit
+	defer tx.Rollback()
+
+	var start, end time.Time
+	var checkedIn, checkedOut sql.NullTime
+
+	err = tx.QueryRowContext(ctx, `select start_date, end_date, checked_in_at, checked_out_at from reservations where id = $1 for update`,
+		reservationID).Scan(&start, &end, &checkedIn, &checkedOut)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, apperr.NewNotFound("Reservation not found", err)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !checkedIn.Valid {
+		return time.Time{}, apperr.NewValidation("Guest is not checked in", nil)
+	}
+
+	if checkedOut.Valid {
+		return time.Time{}, apperr.NewConflict("Guest is already checked out", nil)
+	}
+
+	//Early departure: the nights left are free for other guests
+	if day.Before(end) {
+		end = day
+		if !end.After(start) {
+			end = start.AddDate(0, 0, 1)
+		}
+
+		_, err = tx.ExecContext(ctx, `update room_restrictions set end_date = $1, updated_at = $2 where reservation_id = $3`,
+			end, time.Now(), reservationID)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set end_date = $1, checked_out_at = $2, updated_at = $3 where id = $4`,
+		end, at, time.Now(), reservationID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	//Room needs cleaning after the guest (out of order room stays out of order)
+	_, err = tx.ExecContext(ctx, `update rooms set housekeeping_status = $1, housekeeping_updated_at = $2
+	          where id = (select room_id from reservations where id = $3) and housekeeping_status <> $4`,
+		models.RoomDirty, time.Now(), reservationID, models.RoomOutOfOrder)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return end, tx.Commit()
+}
+
+// HousekeepingBoard returns all rooms of the property with their housekeeping status and what is
+// to be done in them on day (guests leaving, staying and arriving)
+func (m *postgresDBRepo) HousekeepingBoard(ctx context.Context, propertyID int, day time.Time) (_ []models.HousekeepingTask, err error) {
+	ctx, done := startQuery(ctx, "HousekeepingBoard")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var tasks []models.HousekeepingTask
+
+	query := `select rm.id, rm.room_name, rm.property_id, rm.room_type_id, rt.name, rm.housekeeping_status, rm.housekeeping_updated_at,
+	          exists (select 1 from reservations r where r.room_id = rm.id and r.end_date = $2),
+			  exists (select 1 from reservations r where r.room_id = rm.id and r.start_date < $2 and r.end_date > $2),
+			  exists (select 1 from reservations r where r.room_id = rm.id and r.start_date = $2)
+			  from rooms rm
+			  join room_types rt on (rm.room_type_id = rt.id)
+			  where rm.property_id = $1
+			  order by rm.room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, propertyID, day)
+	if err != nil {
+		return tasks, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.HousekeepingTask
+		var updated sql.NullTime
+
+		err := rows.Scan(&t.Room.ID, &t.Room.RoomName, &t.Room.PropertyID, &t.Room.RoomTypeID, &t.Room.RoomType.Name,
+			&t.Room.Housekeeping, &updated, &t.Departure, &t.Stayover, &t.Arrival)
+		if err != nil {
+			return tasks, err
+		}
+
+		t.Room.HousekeepingAt = updated.Time
+
+		tasks = append(tasks, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tasks, err
+	}
+
+	return tasks, nil
+}
+
+// UpdateRoomHousekeeping saves housekeeping status of the room (one of models.Room* statuses)
+// Room can't go out of order (Conflict) while reservations that didn't leave before today (day of the property)
+// have it: staff moves them to other rooms first, the message lists them
+func (m *postgresDBRepo) UpdateRoomHousekeeping(ctx context.Context, roomID int, status string, today time.Time) (err error) {
+	ctx, done := startQuery(ctx, "UpdateRoomHousekeeping")
+	defer func() { done(err) }()
+
+	//If transaction takes longeer than 3 seconds cancel it
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	//Rollback does nothing after Commit
+	defer tx.Rollback()
+
+	var roomTypeID int
+
+	err = tx.QueryRowContext(ctx, `select room_type_id from rooms where id = $1`, roomID).Scan(&roomTypeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperr.NewNotFound("Room not found", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if status == models.RoomOutOfOrder {
+		//Nobody can assign the room while we check it
+		err = lockRoomType(ctx, tx, roomTypeID)
+		if err != nil {
+			return err
+		}
+
+		err = roomHasNoReservations(ctx, tx, roomID, today)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `update rooms set housekeeping_status = $1, housekeeping_updated_at = $2 where id = $3`,
+		status, time.Now(), roomID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// roomHasNoReservations returns Conflict listing reservations that have the room and leave after today
+func roomHasNoReservations(ctx context.Context, tx *sql.Tx, roomID int, today time.Time) error {
+	rows, err := tx.QueryContext(ctx, `select id, last_name, start_date, end_date from reservations
+	          where room_id = $1 and end_date > $2
+			  order by start_date, id`, roomID, today)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	var found []string
+
+	for rows.Next() {
+		var res models.Reservation
+
+		err := rows.Scan(&res.ID, &res.LastName, &res.StartDate, &res.EndDate)
+		if err != nil {
+			return err
+		}
+
+		found = append(found, fmt.Sprintf("#%d %s %s - %s", res.ID, res.LastName,
+			res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02")))
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(found) > 0 {
+		return apperr.NewConflict("Room has reservations, move them to other rooms first: "+strings.Join(found, ", "), nil)
+	}
+
+	return nil
+}
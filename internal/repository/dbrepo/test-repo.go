@@ -0,0 +1,426 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/victorluk72/booking/internal/apperr"
+	"github.com/victorluk72/booking/internal/models"
+)
+
+//-- These are the functions of my interface DatabaseRepo for testing (no real database behind)
+
+// AllUsers
+func (m *testDBRepo) AllUsers() bool {
+	return true
+}
+
+// InsertReservstion inserts reservation details into database
+func (m *testDBRepo) InsertReservstion(ctx context.Context, res models.Reservation) (int, error) {
+	return 1, nil
+}
+
+// InsertRoomRestriction inserts room restriction details into database
+func (m *testDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	return nil
+}
+
+// SearchAvailabilityByDatesByRoomTypeID returns true when a room of the type is free and false when all are booked
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomTypeID(ctx context.Context, start, end time.Time, roomTypeID int) (bool, error) {
+	return false, nil
+}
+
+// SearchAvailabilityForRoomTypes returns room types with free rooms for period of time
+func (m *testDBRepo) SearchAvailabilityForRoomTypes(ctx context.Context, propertyID int, start, end time.Time) ([]models.RoomType, error) {
+	var types []models.RoomType
+	return types, nil
+}
+
+// GetRoomTypeByID returns one room type with its property
+func (m *testDBRepo) GetRoomTypeByID(ctx context.Context, id int) (models.RoomType, error) {
+	var rt models.RoomType
+
+	//Room type with id above 2 doesn't exist in test database
+	if id > 2 {
+		return rt, errors.New("room type not found")
+	}
+
+	rt.ID = id
+	rt.PropertyID = 1
+	rt.Property = testProperty
+	return rt, nil
+}
+
+// GetRoomTypesByProperty returns all room types of the property
+func (m *testDBRepo) GetRoomTypesByProperty(ctx context.Context, propertyID int) ([]models.RoomType, error) {
+	var types []models.RoomType
+	return types, nil
+}
+
+// GetRoomByID returns one room of type models.Room
+func (m *testDBRepo) GetRoomByID(ctx context.Context, room_id int) (models.Room, error) {
+	var room models.Room
+
+	//Room with id above 2 doesn't exist in test database
+	if room_id > 2 {
+		return room, errors.New("room not found")
+	}
+
+	room.ID = room_id
+	room.RoomTypeID = room_id
+	room.PropertyID = 1
+	room.Property = testProperty
+	return room, nil
+}
+
+// GetRoomsByProperty returns all rooms of the property
+func (m *testDBRepo) GetRoomsByProperty(ctx context.Context, propertyID int) ([]models.Room, error) {
+	rooms := []models.Room{{ID: 1, RoomName: "General's Quarters", RoomTypeID: 1, PropertyID: 1}}
+	return rooms, nil
+}
+
+// GetUserByID returns user type models.Uset
+func (m *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	u := models.User{ID: id, AccessLevel: 1}
+
+	//User 3 is administrator, others are normal staff
+	if id == 3 {
+		u.AccessLevel = models.AccessLevelAdmin
+	}
+
+	return u, nil
+}
+
+// GetUserByEmail returns user by email, only "me@here.ca" exists in test database
+func (m *testDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	var u models.User
+
+	if email != "me@here.ca" {
+		return u, sql.ErrNoRows
+	}
+
+	u.ID = 1
+	u.Email = email
+	return u, nil
+}
+
+// InsertUser adds new user to the database
+func (m *testDBRepo) InsertUser(ctx context.Context, u models.User) (int, error) {
+	return 2, nil
+}
+
+// UpdateUser updates user in the database
+func (m *testDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	return nil
+}
+
+// Authenticate check if password and email at matching
+func (m *testDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	if email == "me@here.ca" {
+		return 1, "", nil
+	}
+	return 0, "", errors.New("incorrect password")
+}
+
+// AllReservations returns the slice of all reservations
+func (m *testDBRepo) AllReservations(ctx context.Context, propertyID int) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// NewReservations returns the slice of new reservations
+func (m *testDBRepo) NewReservations(ctx context.Context, propertyID int) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// GetReservationByID returns single reservation (model) by ID
+// Reservation 3 is in the other property of test database
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	var res models.Reservation
+
+	res.ID = id
+	res.RoomTypeID = 1
+	res.RoomType.ID = 1
+	res.RoomType.PropertyID = 1
+	res.RoomType.Property = testProperty
+
+	if id == 3 {
+		res.RoomType.PropertyID = 2
+		res.RoomType.Property = models.Property{ID: 2, Name: "Other Property"}
+	}
+
+	return res, nil
+}
+
+// UpdateReservation updates model for reservation in the database
+func (m *testDBRepo) UpdateReservation(ctx context.Context, r models.Reservation) error {
+	return nil
+}
+
+// DeleteReservation deletes reservation by from the database
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	return nil
+}
+
+// UpdateProcessedForReservation updates field process for single reservation
+func (m *testDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	return nil
+}
+
+// GetRestrictionsForRoomByDate return current restriction for date range
+func (m *testDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+	return restrictions, nil
+}
+
+// InsertUserSession records who owns the session
+func (m *testDBRepo) InsertUserSession(ctx context.Context, s models.UserSession) error {
+	return nil
+}
+
+// AllUserSessions returns active sessions of staff of the property
+func (m *testDBRepo) AllUserSessions(ctx context.Context, propertyID int) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	return sessions, nil
+}
+
+// GetUserSessionByID returns single session by id
+func (m *testDBRepo) GetUserSessionByID(ctx context.Context, id int) (models.UserSession, error) {
+	var s models.UserSession
+
+	//Session 3 is of user 2, staff of property 2 only
+	if id == 3 {
+		return models.UserSession{ID: id, Token: "other-token", UserID: 2}, nil
+	}
+
+	if id > 1 {
+		return s, sql.ErrNoRows
+	}
+
+	s.ID = id
+	s.Token = "test-token"
+	s.UserID = 1
+	return s, nil
+}
+
+// DeleteUserSession removes session record by token
+func (m *testDBRepo) DeleteUserSession(ctx context.Context, token string) error {
+	return nil
+}
+
+// InsertReservationWithMail inserts reservation, restriction and emails in one transaction
+func (m *testDBRepo) InsertReservationWithMail(ctx context.Context, res models.Reservation, restriction models.RoomRestriction, mail []models.MailData) (int, error) {
+	return 1, nil
+}
+
+// InsertMail adds message to mail outbox
+func (m *testDBRepo) InsertMail(ctx context.Context, msg models.MailData) error {
+	return nil
+}
+
+// ClaimMail takes messages that are due for sending
+func (m *testDBRepo) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.MailMessage, error) {
+	var messages []models.MailMessage
+	return messages, nil
+}
+
+// UpdateMail saves the result of sending attempt
+func (m *testDBRepo) UpdateMail(ctx context.Context, msg models.MailMessage, claimedUntil time.Time) error {
+	return nil
+}
+
+// AllMail returns messages from outbox with given status
+func (m *testDBRepo) AllMail(ctx context.Context, propertyID int, status string) ([]models.MailMessage, error) {
+	var messages []models.MailMessage
+	return messages, nil
+}
+
+// GetMailByID returns single message from outbox
+func (m *testDBRepo) GetMailByID(ctx context.Context, id int) (models.MailMessage, error) {
+	var msg models.MailMessage
+
+	//Message 3 is about property 2, the test user isn't its staff
+	if id == 3 {
+		return models.MailMessage{ID: id, Status: models.MailDead, MailData: models.MailData{PropertyID: 2}}, nil
+	}
+
+	if id > 1 {
+		return msg, sql.ErrNoRows
+	}
+
+	msg.ID = id
+	msg.Status = models.MailDead
+	msg.MailData.PropertyID = 1
+	return msg, nil
+}
+
+// ResendMail puts message back to the queue
+func (m *testDBRepo) ResendMail(ctx context.Context, id int) error {
+	return nil
+}
+
+// UpdateUserNotifications saves which events the user wants to get email about
+func (m *testDBRepo) UpdateUserNotifications(ctx context.Context, userID int, n models.Notifications) error {
+	return nil
+}
+
+// UsersToNotify returns users that want email about the event
+func (m *testDBRepo) UsersToNotify(ctx context.Context, propertyID int, event string) ([]models.User, error) {
+	users := []models.User{
+		{ID: 1, Email: "me@here.ca"},
+	}
+	return users, nil
+}
+
+// InsertBlockForRoom adds owner block for one day, rooms are fully booked on 2050-01-31
+func (m *testDBRepo) InsertBlockForRoom(ctx context.Context, roomID int, date time.Time) error {
+	if date.Format("2006-01-02") == "2050-01-31" {
+		return apperr.NewConflict("All rooms of this type are booked on this day", nil)
+	}
+
+	return nil
+}
+
+// DeleteBlockByID removes owner block
+func (m *testDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	return nil
+}
+
+// ReservationsForReminder returns reservations that should get the reminder
+func (m *testDBRepo) ReservationsForReminder(ctx context.Context, propertyID int, kind string, from, to time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// InsertReminderWithMail remembers that reminder was sent and puts the email to outbox
+func (m *testDBRepo) InsertReminderWithMail(ctx context.Context, reservationID int, kind string, mail models.MailData) (bool, error) {
+	return true, nil
+}
+
+// testProperty is the only property of test users (me@here.ca), property 2 exists but isn't theirs
+var testProperty = models.Property{ID: 1, Name: "Fort Smythe Bed and Breakfast", ContactEmail: "me@here.ca"}
+
+// AllProperties returns all properties
+func (m *testDBRepo) AllProperties(ctx context.Context) ([]models.Property, error) {
+	return []models.Property{testProperty, {ID: 2, Name: "Other Property"}}, nil
+}
+
+// PropertiesForUser returns properties the user manages
+func (m *testDBRepo) PropertiesForUser(ctx context.Context, userID int) ([]models.Property, error) {
+	if userID == 2 {
+		return []models.Property{{ID: 2, Name: "Other Property"}}, nil
+	}
+
+	return []models.Property{testProperty}, nil
+}
+
+// GetPropertyByID returns single property
+func (m *testDBRepo) GetPropertyByID(ctx context.Context, id int) (models.Property, error) {
+	if id != 1 {
+		return models.Property{}, sql.ErrNoRows
+	}
+
+	return testProperty, nil
+}
+
+// InsertProperty adds new property and makes the user one of its staff
+func (m *testDBRepo) InsertProperty(ctx context.Context, p models.Property, userID int) (int, error) {
+	return 2, nil
+}
+
+// UpdateProperty saves settings of the property
+func (m *testDBRepo) UpdateProperty(ctx context.Context, p models.Property) error {
+	return nil
+}
+
+// UsersForProperty returns staff of the property
+func (m *testDBRepo) UsersForProperty(ctx context.Context, propertyID int) ([]models.User, error) {
+	users := []models.User{
+		{ID: 1, Email: "me@here.ca"},
+	}
+	return users, nil
+}
+
+// AddUserToProperty makes the user one of the staff of the property
+func (m *testDBRepo) AddUserToProperty(ctx context.Context, userID, propertyID int) error {
+	return nil
+}
+
+// UnassignedReservations returns reservations that have no room yet
+func (m *testDBRepo) UnassignedReservations(ctx context.Context, propertyID int, start, end time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// FreeRoomsForReservation returns rooms of the booked type that are free for the whole stay
+func (m *testDBRepo) FreeRoomsForReservation(ctx context.Context, res models.Reservation) ([]models.Room, error) {
+	rooms := []models.Room{
+		{ID: 1, RoomName: "General's Quarters", RoomTypeID: 1, PropertyID: 1},
+	}
+	return rooms, nil
+}
+
+// AssignRoom gives reservation the room, only room 1 is of the booked type (1) in test database
+func (m *testDBRepo) AssignRoom(ctx context.Context, reservationID, roomID int) error {
+	if roomID != 1 {
+		return apperr.NewValidation("Room is not of the booked type", nil)
+	}
+
+	return nil
+}
+
+// AssignRooms gives rooms to reservations that arrive soon and have no room yet
+func (m *testDBRepo) AssignRooms(ctx context.Context, propertyID int, from, to time.Time) (int, error) {
+	return 0, nil
+}
+
+// FrontDeskReservations returns reservations of the day: 1 arrives, 2 is staying (checked in), 4 leaves
+func (m *testDBRepo) FrontDeskReservations(ctx context.Context, propertyID int, day time.Time) ([]models.Reservation, error) {
+	checkedIn := day.AddDate(0, 0, -1).Add(15 * time.Hour)
+
+	reservations := []models.Reservation{
+		{ID: 1, LastName: "Arriving", StartDate: day, EndDate: day.AddDate(0, 0, 2), RoomID: 1},
+		{ID: 2, LastName: "Staying", StartDate: day.AddDate(0, 0, -1), EndDate: day.AddDate(0, 0, 1), RoomID: 2, CheckedInAt: checkedIn},
+		{ID: 4, LastName: "Leaving", StartDate: day.AddDate(0, 0, -2), EndDate: day, RoomID: 1, CheckedInAt: checkedIn.AddDate(0, 0, -1)},
+	}
+	return reservations, nil
+}
+
+// CheckIn records that guest arrived, guest of reservation 2 is already checked in
+func (m *testDBRepo) CheckIn(ctx context.Context, reservationID int, at, day time.Time, notes string) error {
+	if reservationID == 2 {
+		return apperr.NewConflict("Guest is already checked in", nil)
+	}
+
+	return nil
+}
+
+// CheckOut records that guest left, guest of reservation 1 is not checked in yet
+func (m *testDBRepo) CheckOut(ctx context.Context, reservationID int, at, day time.Time) (time.Time, error) {
+	if reservationID == 1 {
+		return time.Time{}, apperr.NewValidation("Guest is not checked in", nil)
+	}
+
+	return day, nil
+}
+
+// HousekeepingBoard returns rooms of the property: guest leaves room 1 and another arrives, guest stays in room 2
+func (m *testDBRepo) HousekeepingBoard(ctx context.Context, propertyID int, day time.Time) ([]models.HousekeepingTask, error) {
+	tasks := []models.HousekeepingTask{
+		{Room: models.Room{ID: 1, RoomName: "General's Quarters", PropertyID: 1, Housekeeping: models.RoomDirty}, Departure: true, Arrival: true},
+		{Room: models.Room{ID: 2, RoomName: "Major's Suite", PropertyID: 1, Housekeeping: models.RoomClean}, Stayover: true},
+	}
+	return tasks, nil
+}
+
+// UpdateRoomHousekeeping saves housekeeping status of the room, room 2 has guest staying (reservation 2)
+func (m *testDBRepo) UpdateRoomHousekeeping(ctx context.Context, roomID int, status string, today time.Time) error {
+	if roomID == 2 && status == models.RoomOutOfOrder {
+		return apperr.NewConflict("Room has reservations, move them to other rooms first: #2 Staying", nil)
+	}
+
+	return nil
+}
@@ -1,31 +1,78 @@
 package repository
 
 import (
+	"context"
 	"time"
 
 	"github.com/victorluk72/booking/internal/models"
 )
 
 //Interface for database repo. It should cover all possible functions for DB CRUD
+//Methods take context of the request: queries are cancelled with the request and traced as its part
 type DatabaseRepo interface {
 	AllUsers() bool
 
-	InsertReservstion(res models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(room_id int) (models.Room, error)
-	GetAllRooms() ([]models.Room, error)
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(u models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
-
-	AllReservations() ([]models.Reservation, error)
-	NewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(u models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
-
-	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	InsertReservstion(ctx context.Context, res models.Reservation) (int, error)
+	InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error
+	SearchAvailabilityByDatesByRoomTypeID(ctx context.Context, start, end time.Time, roomTypeID int) (bool, error)
+	SearchAvailabilityForRoomTypes(ctx context.Context, propertyID int, start, end time.Time) ([]models.RoomType, error)
+	GetRoomTypeByID(ctx context.Context, id int) (models.RoomType, error)
+	GetRoomTypesByProperty(ctx context.Context, propertyID int) ([]models.RoomType, error)
+	GetRoomByID(ctx context.Context, room_id int) (models.Room, error)
+	GetRoomsByProperty(ctx context.Context, propertyID int) ([]models.Room, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	InsertUser(ctx context.Context, u models.User) (int, error)
+	UpdateUser(ctx context.Context, u models.User) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+
+	AllReservations(ctx context.Context, propertyID int) ([]models.Reservation, error)
+	NewReservations(ctx context.Context, propertyID int) ([]models.Reservation, error)
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, u models.Reservation) error
+	DeleteReservation(ctx context.Context, id int) error
+	UpdateProcessedForReservation(ctx context.Context, id, processed int) error
+
+	GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+
+	InsertUserSession(ctx context.Context, s models.UserSession) error
+	AllUserSessions(ctx context.Context, propertyID int) ([]models.UserSession, error)
+	GetUserSessionByID(ctx context.Context, id int) (models.UserSession, error)
+	DeleteUserSession(ctx context.Context, token string) error
+
+	InsertReservationWithMail(ctx context.Context, res models.Reservation, restriction models.RoomRestriction, mail []models.MailData) (int, error)
+	InsertMail(ctx context.Context, m models.MailData) error
+	ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.MailMessage, error)
+	UpdateMail(ctx context.Context, msg models.MailMessage, claimedUntil time.Time) error
+	AllMail(ctx context.Context, propertyID int, status string) ([]models.MailMessage, error)
+	GetMailByID(ctx context.Context, id int) (models.MailMessage, error)
+	ResendMail(ctx context.Context, id int) error
+
+	UpdateUserNotifications(ctx context.Context, userID int, n models.Notifications) error
+	UsersToNotify(ctx context.Context, propertyID int, event string) ([]models.User, error)
+	InsertBlockForRoom(ctx context.Context, roomID int, date time.Time) error
+	DeleteBlockByID(ctx context.Context, id int) error
+
+	ReservationsForReminder(ctx context.Context, propertyID int, kind string, from, to time.Time) ([]models.Reservation, error)
+	InsertReminderWithMail(ctx context.Context, reservationID int, kind string, mail models.MailData) (bool, error)
+
+	AllProperties(ctx context.Context) ([]models.Property, error)
+	PropertiesForUser(ctx context.Context, userID int) ([]models.Property, error)
+	GetPropertyByID(ctx context.Context, id int) (models.Property, error)
+	InsertProperty(ctx context.Context, p models.Property, userID int) (int, error)
+	UpdateProperty(ctx context.Context, p models.Property) error
+	UsersForProperty(ctx context.Context, propertyID int) ([]models.User, error)
+	AddUserToProperty(ctx context.Context, userID, propertyID int) error
+
+	UnassignedReservations(ctx context.Context, propertyID int, start, end time.Time) ([]models.Reservation, error)
+	FreeRoomsForReservation(ctx context.Context, res models.Reservation) ([]models.Room, error)
+	AssignRoom(ctx context.Context, reservationID, roomID int) error
+	AssignRooms(ctx context.Context, propertyID int, from, to time.Time) (int, error)
+
+	FrontDeskReservations(ctx context.Context, propertyID int, day time.Time) ([]models.Reservation, error)
+	CheckIn(ctx context.Context, reservationID int, at, day time.Time, notes string) error
+	CheckOut(ctx context.Context, reservationID int, at, day time.Time) (time.Time, error)
+
+	HousekeepingBoard(ctx context.Context, propertyID int, day time.Time) ([]models.HousekeepingTask, error)
+	UpdateRoomHousekeeping(ctx context.Context, roomID int, status string, today time.Time) error
 }
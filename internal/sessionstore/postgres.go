@@ -0,0 +1,123 @@
+package sessionstore
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// PostgresStore keeps scs sessions in Postgres table "sessions"
+// Sessions survive application restarts and can be shared between several instances
+type PostgresStore struct {
+	db          *sql.DB
+	stopCleanup chan bool
+	errorLog    *log.Logger
+}
+
+// New creates PostgresStore. Expired sessions are deleted every cleanupInterval
+// Use cleanupInterval = 0 to switch the cleanup off. Failed cleanups are written to errorLog
+func New(db *sql.DB, cleanupInterval time.Duration, errorLog *log.Logger) *PostgresStore {
+	p := &PostgresStore{db: db, errorLog: errorLog}
+
+	if cleanupInterval > 0 {
+		p.stopCleanup = make(chan bool)
+		go p.startCleanup(cleanupInterval)
+	}
+
+	return p
+}
+
+// Find returns the data for given session token
+// If the session is not found or expired "found" is false
+func (p *PostgresStore) Find(token string) ([]byte, bool, error) {
+	var b []byte
+
+	row := p.db.QueryRow("select data from sessions where token = $1 and current_timestamp < expiry", token)
+
+	err := row.Scan(&b)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit adds the session token and data to the store (or updates existing session)
+func (p *PostgresStore) Commit(token string, b []byte, expiry time.Time) error {
+	stmt := `insert into sessions (token, data, expiry) values ($1, $2, $3)
+	         on conflict (token) do update set data = excluded.data, expiry = excluded.expiry`
+
+	_, err := p.db.Exec(stmt, token, b, expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes the session from the store (used for logout and revoke)
+func (p *PostgresStore) Delete(token string) error {
+	_, err := p.db.Exec("delete from sessions where token = $1", token)
+	return err
+}
+
+// All returns all active sessions, key is session token
+func (p *PostgresStore) All() (map[string][]byte, error) {
+	rows, err := p.db.Query("select token, data from sessions where current_timestamp < expiry")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make(map[string][]byte)
+
+	for rows.Next() {
+		var token string
+		var data []byte
+
+		err = rows.Scan(&token, &data)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions[token] = data
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// StopCleanup terminates background cleanup of expired sessions
+func (p *PostgresStore) StopCleanup() {
+	if p.stopCleanup != nil {
+		p.stopCleanup <- true
+	}
+}
+
+// startCleanup deletes expired sessions every interval until StopCleanup is called
+func (p *PostgresStore) startCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			err := p.deleteExpired()
+			if err != nil {
+				p.errorLog.Println("Can't delete expired sessions:", err)
+			}
+		case <-p.stopCleanup:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func (p *PostgresStore) deleteExpired() error {
+	_, err := p.db.Exec("delete from sessions where expiry < current_timestamp")
+	return err
+}
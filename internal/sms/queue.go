@@ -0,0 +1,84 @@
+package sms
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+	"github.com/victorluk72/booking/internal/outbox"
+)
+
+// Queue sends text messages from the channel in background and retries failed ones
+// Unlike mail outbox the queue is in memory: messages waiting there are lost on restart
+type Queue struct {
+	cfg      Config
+	sender   SMSSender
+	errorLog *log.Logger
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewQueue creates the queue, call Listen to start it
+func NewQueue(cfg Config, sender SMSSender, errorLog *log.Logger) *Queue {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	return &Queue{
+		cfg:      cfg,
+		sender:   sender,
+		errorLog: errorLog,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Listen starts the workers, they send everything that comes to the channel until it is closed
+func (q *Queue) Listen(ch <-chan models.SMSData) {
+	for i := 0; i < q.cfg.Workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+
+			for m := range ch {
+				q.send(m)
+			}
+		}()
+	}
+}
+
+// send tries to deliver one message up to MaxAttempts times
+func (q *Queue) send(m models.SMSData) {
+	for attempt := 1; ; attempt++ {
+		err := q.sender.Send(m)
+		if err == nil {
+			return
+		}
+
+		if attempt >= q.cfg.MaxAttempts {
+			q.errorLog.Printf("SMS to %s failed after %d attempts: %v", m.To, attempt, err)
+			return
+		}
+
+		q.errorLog.Printf("SMS to %s failed (attempt %d): %v", m.To, attempt, err)
+
+		timer := time.NewTimer(outbox.Backoff(attempt, q.cfg.RetryDelay, time.Hour))
+		select {
+		case <-timer.C:
+		case <-q.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Stop waits until messages left in the channel are sent and stops the workers
+// Close the channel given to Listen first. After Stop failed messages are not retried any more
+func (q *Queue) Stop() {
+	close(q.stop)
+	q.wg.Wait()
+}
@@ -0,0 +1,150 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/victorluk72/booking/internal/models"
+)
+
+// SMSSender delivers text messages
+type SMSSender interface {
+	Send(m models.SMSData) error
+}
+
+// Config holds SMS settings, Provider chooses which SMSSender is used
+type Config struct {
+	Provider string // "http", "fake", "log" or "none" (SMS switched off)
+	From     string // sender number or name shown to the guest
+
+	//http provider
+	URL     string // messages are posted there as JSON: {"from": ..., "to": ..., "body": ...}
+	Token   string // sent as "Authorization: Bearer <token>" when set
+	Timeout time.Duration
+
+	//Queue
+	Workers     int
+	MaxAttempts int
+	RetryDelay  time.Duration // delay before first retry, doubled after every failure
+}
+
+// New returns SMSSender for provider from config (nil for "none")
+func New(cfg Config, infoLog *log.Logger) (SMSSender, error) {
+	switch cfg.Provider {
+	case "none", "":
+		return nil, nil
+	case "http":
+		if cfg.URL == "" {
+			return nil, errors.New("sms: url of http provider is not set")
+		}
+		return &HTTP{URL: cfg.URL, Token: cfg.Token, From: cfg.From, Client: &http.Client{Timeout: cfg.Timeout}}, nil
+	case "fake":
+		return &Fake{}, nil
+	case "log":
+		return &Log{Logger: infoLog}, nil
+	}
+
+	return nil, fmt.Errorf("sms: unknown provider %q", cfg.Provider)
+}
+
+// NormalizePhone removes spaces, dashes, dots and brackets from phone number, e.g. "+1 (555) 123-4567" is "+15551234567"
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '+' || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// HTTP posts every message to the gateway of SMS provider
+type HTTP struct {
+	URL    string
+	Token  string
+	From   string
+	Client *http.Client
+}
+
+// Send posts one message, any status other than 2xx is an error
+func (h *HTTP) Send(m models.SMSData) error {
+	body, err := json.Marshal(map[string]string{
+		"from": h.From,
+		"to":   m.To,
+		"body": m.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sms: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		//Provider usually explains the problem in response
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sms: provider returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// Fake keeps messages in memory, nothing is sent (for tests and development)
+type Fake struct {
+	Err error // when set, Send fails with it
+
+	mu   sync.Mutex
+	sent []models.SMSData
+}
+
+// Send remembers one message
+func (f *Fake) Send(m models.SMSData) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+// Sent returns messages sent so far
+func (f *Fake) Sent() []models.SMSData {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]models.SMSData(nil), f.sent...)
+}
+
+// Log only writes recipient and text to the log, nothing is sent
+type Log struct {
+	Logger *log.Logger
+}
+
+// Send logs one message
+func (l *Log) Send(m models.SMSData) error {
+	l.Logger.Printf("SMS to %s: %s", m.To, m.Body)
+	return nil
+}
@@ -0,0 +1,194 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/victorluk72/booking"
+	"github.com/victorluk72/booking/internal/models"
+)
+
+var testMsg = models.SMSData{To: "+15551234567", Body: "Your reservation is confirmed"}
+
+func TestHTTP(t *testing.T) {
+	var got map[string]string
+	var auth string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	s, err := New(Config{Provider: "http", URL: ts.URL, Token: "abc", From: "Booking", Timeout: time.Second}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Send(testMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got["to"] != testMsg.To || got["body"] != testMsg.Body || got["from"] != "Booking" {
+		t.Errorf("unexpected request %v", got)
+	}
+
+	if auth != "Bearer abc" {
+		t.Errorf("unexpected authorization %q", auth)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid number", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	s, _ := New(Config{Provider: "http", URL: ts.URL, Timeout: time.Second}, nil)
+
+	err := s.Send(testMsg)
+	if err == nil || !strings.Contains(err.Error(), "invalid number") {
+		t.Errorf("expected error from provider but got %v", err)
+	}
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+
+	s, _ := New(Config{Provider: "log"}, log.New(&buf, "", 0))
+
+	_ = s.Send(testMsg)
+	if !strings.Contains(buf.String(), testMsg.To) || !strings.Contains(buf.String(), testMsg.Body) {
+		t.Errorf("unexpected log %q", buf.String())
+	}
+}
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{"none", Config{Provider: "none"}, true},
+		{"http", Config{Provider: "http", URL: "http://localhost"}, true},
+		{"http-no-url", Config{Provider: "http"}, false},
+		{"fake", Config{Provider: "fake"}, true},
+		{"unknown", Config{Provider: "pigeon"}, false},
+	}
+
+	for _, e := range tests {
+		_, err := New(e.cfg, nil)
+		if (err == nil) != e.ok {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	for phone, expected := range map[string]string{
+		"+1 (555) 123-4567": "+15551234567",
+		"555.123.4567":      "5551234567",
+		"call me":           "",
+	} {
+		if got := NormalizePhone(phone); got != expected {
+			t.Errorf("%q: expected %q but got %q", phone, expected, got)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	fake := &Fake{Err: errors.New("provider is down")}
+
+	q := NewQueue(Config{Workers: 1, MaxAttempts: 3, RetryDelay: 10 * time.Millisecond}, fake, log.New(io.Discard, "", 0))
+
+	ch := make(chan models.SMSData)
+	q.Listen(ch)
+
+	ch <- testMsg
+
+	//Provider comes back before the last attempt
+	time.Sleep(15 * time.Millisecond)
+	fake.mu.Lock()
+	fake.Err = nil
+	fake.mu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for len(fake.Sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(ch)
+	q.Stop()
+
+	if len(fake.Sent()) != 1 || fake.Sent()[0] != testMsg {
+		t.Errorf("expected message to be sent after retry but got %v", fake.Sent())
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	templates, err := NewTemplates(booking.Embedded().SMSTemplates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan models.SMSData, 1)
+	n := NewNotifier(templates, ch)
+
+	res := models.Reservation{
+		FirstName: "Tom",
+		Phone:     "+1 555 123 4567",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+		RoomType:  models.RoomType{Name: "Major's Suite"},
+	}
+	data := map[string]interface{}{"Reservation": res}
+
+	//Guest didn't opt in
+	_ = n.Reservation(res, "confirmation", data)
+	if len(ch) != 0 {
+		t.Fatal("SMS sent without opt-in")
+	}
+
+	res.SMSOptIn = true
+
+	err = n.Reservation(res, "confirmation", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-ch
+	expected := "Hi Tom, your reservation of Major's Suite room from 2050-01-01 to 2050-01-02 is confirmed. See you soon!"
+	if msg.To != "+15551234567" || msg.Body != expected {
+		t.Errorf("unexpected SMS %+v", msg)
+	}
+
+	//Every reminder template works
+	for _, name := range []string{"arrival-reminder", "follow-up"} {
+		_, err = templates.Message(res.Phone, name, data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	//Full queue doesn't block
+	_ = n.Reservation(res, "confirmation", data)
+	if err = n.Reservation(res, "confirmation", data); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull but got %v", err)
+	}
+
+	//Nil notifier (SMS is off) does nothing
+	var off *Notifier
+	if err = off.Reservation(res, "confirmation", data); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
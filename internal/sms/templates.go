@@ -0,0 +1,111 @@
+package sms
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/victorluk72/booking/internal/i18n"
+	"github.com/victorluk72/booking/internal/models"
+)
+
+// ErrQueueFull is returned when messages come faster than they are sent
+var ErrQueueFull = errors.New("sms: queue is full")
+
+// Text messages are in language of the reservation, e.g. {{t .Locale "Hi %s" $res.FirstName}}
+var functions = template.FuncMap{
+	"t":    i18n.T,
+	"date": i18n.Date,
+}
+
+// Templates are text messages read from fsys: every name.sms.txt is one message
+type Templates struct {
+	cache map[string]*template.Template
+}
+
+// NewTemplates reads all messages from fsys (see sms-templates)
+func NewTemplates(fsys fs.FS) (*Templates, error) {
+	pages, err := fs.Glob(fsys, "*.sms.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pages) == 0 {
+		return nil, errors.New("no sms templates found")
+	}
+
+	t := &Templates{cache: map[string]*template.Template{}}
+
+	for _, page := range pages {
+		tmpl, err := template.New(path.Base(page)).Funcs(functions).ParseFS(fsys, page)
+		if err != nil {
+			return nil, err
+		}
+
+		t.cache[strings.TrimSuffix(path.Base(page), ".sms.txt")] = tmpl
+	}
+
+	return t, nil
+}
+
+// Message builds text message from template "name" (e.g. "confirmation") for phone "to"
+// Message is in language of data["Locale"], in i18n.Default without it
+func (t *Templates) Message(to, name string, data interface{}) (models.SMSData, error) {
+	data = i18n.AddLocale(data, i18n.Default)
+
+	tmpl, ok := t.cache[name]
+	if !ok {
+		return models.SMSData{}, fmt.Errorf("sms template %q not found", name)
+	}
+
+	var body bytes.Buffer
+
+	err := tmpl.Execute(&body, data)
+	if err != nil {
+		return models.SMSData{}, err
+	}
+
+	//Templates are easier to read with line breaks, but SMS is one line
+	return models.SMSData{
+		To:   NormalizePhone(to),
+		Body: strings.Join(strings.Fields(body.String()), " "),
+	}, nil
+}
+
+// Notifier sends text messages to guests who asked for them (Reservation.SMSOptIn)
+// Nil Notifier does nothing, so callers don't need to check if SMS is switched on
+type Notifier struct {
+	templates *Templates
+	queue     chan<- models.SMSData
+}
+
+// NewNotifier returns Notifier that puts messages to queue (see Queue.Listen)
+func NewNotifier(t *Templates, queue chan<- models.SMSData) *Notifier {
+	return &Notifier{templates: t, queue: queue}
+}
+
+// Reservation queues message from template "name" for the guest of reservation
+// Nothing is sent if the guest didn't opt in or has no phone
+func (n *Notifier) Reservation(res models.Reservation, name string, data interface{}) error {
+	if n == nil || !res.SMSOptIn || NormalizePhone(res.Phone) == "" {
+		return nil
+	}
+
+	//Guest gets messages in language they booked in
+	msg, err := n.templates.Message(res.Phone, name, i18n.AddLocale(data, res.Locale))
+	if err != nil {
+		return err
+	}
+
+	//Never block the request when the provider is slow
+	select {
+	case n.queue <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
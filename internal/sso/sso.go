@@ -0,0 +1,129 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrEmailNotVerified is returned when the provider didn't confirm the email of the user
+var ErrEmailNotVerified = errors.New("email is not verified by identity provider")
+
+// Config holds settings for OpenID Connect provider (company identity provider)
+type Config struct {
+	IssuerURL          string
+	ClientID           string
+	ClientSecret       string
+	RedirectURL        string
+	DefaultAccessLevel int // access level for auto-provisioned users
+}
+
+// Provider is the OpenID Connect client for staff single sign-on
+// It uses authorization code flow with PKCE
+type Provider struct {
+	Config   Config
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Identity is the user information we get from verified ID token
+type Identity struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	FirstName     string `json:"given_name"`
+	LastName      string `json:"family_name"`
+	Nonce         string `json:"nonce"`
+}
+
+// New creates new Provider. It reads provider metadata from {IssuerURL}/.well-known/openid-configuration
+// so any provider (including local mock provider for tests) can be used
+func New(ctx context.Context, c Config) (*Provider, error) {
+
+	if c.IssuerURL == "" || c.ClientID == "" || c.RedirectURL == "" {
+		return nil, errors.New("sso: issuer url, client id and redirect url are required")
+	}
+
+	p, err := oidc.NewProvider(ctx, c.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("sso: cannot discover provider %s: %w", c.IssuerURL, err)
+	}
+
+	return &Provider{
+		Config: c,
+		oauth2: oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: p.Verifier(&oidc.Config{ClientID: c.ClientID}),
+	}, nil
+}
+
+// AuthCodeURL returns URL of provider login page
+// state and nonce protect against CSRF and replay, verifier is PKCE code verifier
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange trades authorization code for tokens, verifies ID token and returns the identity of the user
+func (p *Provider) Exchange(ctx context.Context, code, nonce, verifier string) (Identity, error) {
+
+	var id Identity
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return id, fmt.Errorf("sso: cannot exchange code: %w", err)
+	}
+
+	//ID token comes as an extra field of OAuth2 token
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return id, errors.New("sso: no id_token in token response")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return id, fmt.Errorf("sso: cannot verify id_token: %w", err)
+	}
+
+	err = idToken.Claims(&id)
+	if err != nil {
+		return id, err
+	}
+
+	if id.Nonce != nonce {
+		return id, errors.New("sso: nonce mismatch")
+	}
+
+	//We map users by email, so we trust only emails confirmed by provider
+	if id.Email == "" || !id.EmailVerified {
+		return id, ErrEmailNotVerified
+	}
+
+	return id, nil
+}
+
+// NewVerifier returns new PKCE code verifier
+func NewVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// RandomString returns URL safe random string (use it for state and nonce)
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,125 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/victorluk72/booking/internal/sso/ssotest"
+)
+
+// login walks through provider login page and returns the code from redirect
+func login(t *testing.T, p *Provider, state, nonce, verifier string) string {
+
+	//Don't follow redirect back to application, we just need the code
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(p.AuthCodeURL(state, nonce, verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loc.Query().Get("state") != state {
+		t.Errorf("expected state %s but got %s", state, loc.Query().Get("state"))
+	}
+
+	return loc.Query().Get("code")
+}
+
+func newProvider(t *testing.T, mock *ssotest.Provider) *Provider {
+	p, err := New(context.Background(), Config{
+		IssuerURL:    mock.URL,
+		ClientID:     ssotest.ClientID,
+		ClientSecret: ssotest.ClientSecret,
+		RedirectURL:  "http://localhost/user/login/sso/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExchange(t *testing.T) {
+
+	mock := ssotest.NewProvider(ssotest.User{
+		Subject:       "1234",
+		Email:         "staff@here.ca",
+		EmailVerified: true,
+		FirstName:     "John",
+		LastName:      "Smith",
+	})
+	defer mock.Close()
+
+	p := newProvider(t, mock)
+
+	verifier := NewVerifier()
+	code := login(t, p, "state", "nonce", verifier)
+
+	id, err := p.Exchange(context.Background(), code, "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id.Email != "staff@here.ca" || id.FirstName != "John" || id.Subject != "1234" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+
+	mock := ssotest.NewProvider(ssotest.User{Subject: "1", Email: "staff@here.ca", EmailVerified: true})
+	defer mock.Close()
+
+	p := newProvider(t, mock)
+
+	code := login(t, p, "state", "nonce", NewVerifier())
+
+	_, err := p.Exchange(context.Background(), code, "nonce", NewVerifier())
+	if err == nil {
+		t.Error("expected error for wrong PKCE verifier")
+	}
+}
+
+func TestExchangeWrongNonce(t *testing.T) {
+
+	mock := ssotest.NewProvider(ssotest.User{Subject: "1", Email: "staff@here.ca", EmailVerified: true})
+	defer mock.Close()
+
+	p := newProvider(t, mock)
+
+	verifier := NewVerifier()
+	code := login(t, p, "state", "nonce", verifier)
+
+	_, err := p.Exchange(context.Background(), code, "other-nonce", verifier)
+	if err == nil {
+		t.Error("expected error for wrong nonce")
+	}
+}
+
+func TestExchangeUnverifiedEmail(t *testing.T) {
+
+	mock := ssotest.NewProvider(ssotest.User{Subject: "1", Email: "staff@here.ca", EmailVerified: false})
+	defer mock.Close()
+
+	p := newProvider(t, mock)
+
+	verifier := NewVerifier()
+	code := login(t, p, "state", "nonce", verifier)
+
+	_, err := p.Exchange(context.Background(), code, "nonce", verifier)
+	if !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("expected ErrEmailNotVerified but got %v", err)
+	}
+}
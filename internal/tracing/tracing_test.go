@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// record installs tracer provider that keeps finished spans in memory
+func record(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+
+	old := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(old) })
+
+	return sr
+}
+
+func TestMiddleware(t *testing.T) {
+	sr := record(t)
+
+	_, err := Setup(context.Background(), Config{Exporter: "none"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Handler makes one query, its span must be a child of request span
+	mux := chi.NewRouter()
+	mux.Use(Middleware)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := StartDB(r.Context(), "GetRoomByID")
+		span.End()
+
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/rooms/7", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	db, request := spans[0], spans[1]
+
+	if request.Name() != "GET /rooms/{id}" {
+		t.Errorf("unexpected request span name %q", request.Name())
+	}
+
+	if request.Status().Code != codes.Error {
+		t.Error("request with status 500 must be marked as error")
+	}
+
+	//Trace of the caller is continued
+	if request.SpanContext().TraceID().String() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("traceparent is ignored, trace ID %s", request.SpanContext().TraceID())
+	}
+
+	if db.Name() != "db.GetRoomByID" || db.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Errorf("query span %q is not a child of request span", db.Name())
+	}
+}
+
+func TestStartChild(t *testing.T) {
+	sr := record(t)
+
+	//Without trace in context nothing is recorded (e.g. mail outbox polling)
+	_, span := StartChild(context.Background(), "db.ClaimMail")
+	span.End()
+
+	if len(sr.Ended()) != 0 {
+		t.Errorf("expected no spans, got %d", len(sr.Ended()))
+	}
+
+	ctx, root := Start(context.Background(), "mail.send")
+	_, child := StartChild(ctx, "db.UpdateMail")
+	End(child, errors.New("boom"))
+	root.End()
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	if spans[0].Status().Code != codes.Error || len(spans[0].Events()) == 0 {
+		t.Error("error is not recorded in span")
+	}
+
+	if TraceID(ctx) != root.SpanContext().TraceID().String() || TraceID(context.Background()) != "" {
+		t.Error("unexpected trace ID")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	old := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(old) })
+
+	_, err := Setup(context.Background(), Config{Exporter: "zipkin"}, nil)
+	if err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+
+	//Spans are written to stdout when provider is shut down (batches are flushed)
+	var buf bytes.Buffer
+
+	shutdown, err := Setup(context.Background(), Config{Exporter: "stdout", SampleRatio: 1, Service: "booking"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := Start(context.Background(), "reminders.run")
+	span.End()
+
+	err = shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "reminders.run") || !strings.Contains(buf.String(), "booking") {
+		t.Errorf("span is not exported:\n%s", buf.String())
+	}
+}